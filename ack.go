@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	errFingerprint        = errors.New("expected a SHA-256 fingerprint of 64 hex characters")
+	errExpectedAckTargets = errors.New("expected fingerprints as arguments, or -list")
+)
+
+// suppression acknowledges a certificate, or any certificate of a public key, so it no longer
+// alerts, for good or until a snooze ends
+type suppression struct {
+	// Fingerprint is the SHA-256 of the certificate or of its SubjectPublicKeyInfo, hex encoded,
+	// a key's lets certificates for it be acknowledged before they are issued
+	Fingerprint string     `json:"fingerprint"`
+	Reason      string     `json:"reason,omitempty"`
+	At          time.Time  `json:"at"`
+	Until       *time.Time `json:"until,omitempty"`
+}
+
+// active at now, acknowledged or snoozed until later
+func (s suppression) active(now time.Time) bool {
+	return s.Until == nil || now.Before(*s.Until)
+}
+
+// String describes s for logs
+func (s suppression) String() string {
+	desc := "acknowledged"
+	if s.Until != nil {
+		desc = "snoozed until " + s.Until.UTC().Format(time.RFC3339)
+	}
+	if s.Reason != "" {
+		desc += ", " + s.Reason
+	}
+
+	return desc
+}
+
+// parseFingerprint normalized to lower case hex
+func parseFingerprint(s string) (string, error) {
+	s = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(s), ":", ""))
+	if b, err := hex.DecodeString(s); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("%w (%v)", errFingerprint, s)
+	}
+
+	return s, nil
+}
+
+// suppressionOf r at now in suppressions, by its certificate's or its public key's fingerprint
+func suppressionOf(suppressions map[string]suppression, r result, now time.Time) (suppression, bool) {
+	certSum := r.fingerprint()
+	keySum := sha256.Sum256(r.cert().RawSubjectPublicKeyInfo)
+
+	for _, sum := range [][sha256.Size]byte{certSum, keySum} {
+		if s, ok := suppressions[hex.EncodeToString(sum[:])]; ok && s.active(now) {
+			return s, true
+		}
+	}
+
+	return suppression{}, false
+}
+
+// stateSuppressions reads the suppressions of the state file at path on each call, so those added
+// by findcert ack or the API apply from the next poll
+func stateSuppressions(path string) func() map[string]suppression {
+	return func() map[string]suppression {
+		s, err := readWatchState(path)
+		if err != nil {
+			log.Printf("could not read suppressions (%v)\n", err)
+			return nil
+		}
+		return s.Suppressions
+	}
+}
+
+// acknowledge fingerprint in the state file at path, snoozed for snooze if positive
+func acknowledge(path, fingerprint, reason string, snooze time.Duration, now time.Time) (suppression, error) {
+	s := suppression{Fingerprint: fingerprint, Reason: reason, At: now.UTC()}
+	if snooze > 0 {
+		until := now.Add(snooze).UTC()
+		s.Until = &until
+	}
+
+	return s, updateWatchState(path, func(state *watchState) {
+		state.Suppressions[fingerprint] = s
+	})
+}
+
+// unacknowledge fingerprint in the state file at path
+func unacknowledge(path, fingerprint string) error {
+	return updateWatchState(path, func(state *watchState) {
+		delete(state.Suppressions, fingerprint)
+	})
+}
+
+// sortedSuppressions of state, most recent first
+func sortedSuppressions(state watchState) []suppression {
+	list := make([]suppression, 0, len(state.Suppressions))
+	for _, s := range state.Suppressions {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].At.After(list[j].At) })
+
+	return list
+}
+
+func runAck(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	statePath := fs.String("state", "", "state file of findcert watch -state")
+	configPath := fs.String("config", "", "JSON config file of the daemon, whose state_file is used")
+	snooze := fs.Duration("for", 0, "snooze for this long instead of acknowledging for good (ex: 72h)")
+	reason := fs.String("reason", "", "why the certificates are expected, shown in logs")
+	list := fs.Bool("list", false, "list the acknowledged and snoozed fingerprints")
+	remove := fs.Bool("remove", false, "remove the fingerprints given, so they alert again")
+	output := addOutputFileFlag(fs)
+	parseFlags(fs, args)
+
+	path := *statePath
+	if *configPath != "" {
+		cfg, _, err := readDaemonConfig(*configPath)
+		if err != nil {
+			return err
+		}
+		path = cfg.StateFile
+	}
+	if path == "" {
+		return errExpectedStateTarget
+	}
+
+	if *list {
+		state, err := readWatchState(path)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		return writeOutput(*output, func(out io.Writer) error {
+			for _, s := range sortedSuppressions(state) {
+				status := "active"
+				if !s.active(now) {
+					status = "expired"
+				}
+				fmt.Fprintf(out, "%v (%v) %v\n", s.Fingerprint, status, s)
+			}
+			return nil
+		})
+	}
+
+	if fs.NArg() == 0 {
+		return errExpectedAckTargets
+	}
+
+	return writeOutput(*output, func(out io.Writer) error {
+		for _, arg := range fs.Args() {
+			fingerprint, err := parseFingerprint(arg)
+			if err != nil {
+				return err
+			}
+
+			if *remove {
+				if err = unacknowledge(path, fingerprint); err != nil {
+					return err
+				}
+				fmt.Fprintf(out, "removed (%v)\n", fingerprint)
+				continue
+			}
+
+			s, err := acknowledge(path, fingerprint, *reason, *snooze, time.Now())
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "%v (%v)\n", fingerprint, s)
+		}
+		return nil
+	})
+}
+
+// ackHandler serves the daemon's suppressions at /acks, GET lists them, POST {"fingerprint",
+// "reason", "for"} adds one and DELETE ?fingerprint=<sha256> removes one
+type ackHandler struct {
+	statePath string
+}
+
+func (h ackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		state, err := readWatchState(h.statePath)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "could not read suppressions")
+			return
+		}
+		writeJSON(w, http.StatusOK, sortedSuppressions(state))
+	case http.MethodPost:
+		var req struct {
+			Fingerprint string `json:"fingerprint"`
+			Reason      string `json:"reason"`
+			For         string `json:"for"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "could not decode acknowledgement")
+			return
+		}
+		fingerprint, err := parseFingerprint(req.Fingerprint)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		var snooze time.Duration
+		if req.For != "" {
+			if snooze, err = time.ParseDuration(req.For); err != nil {
+				writeJSONError(w, http.StatusBadRequest, "could not parse for as a duration (ex: 72h)")
+				return
+			}
+		}
+
+		s, err := acknowledge(h.statePath, fingerprint, req.Reason, snooze, time.Now())
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "could not save acknowledgement")
+			return
+		}
+		writeJSON(w, http.StatusOK, s)
+	case http.MethodDelete:
+		fingerprint, err := parseFingerprint(r.URL.Query().Get("fingerprint"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err = unacknowledge(h.statePath, fingerprint); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "could not remove acknowledgement")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	defaultAdmissionTimeout    = 10 * time.Second
+	defaultAdmissionMaxMatches = 100000
+)
+
+// crtshAdmission is checked before running patterns on crt.sh, set by the -force, -admission-timeout
+// and -admission-max-rows flags
+var crtshAdmission = &admission{timeout: defaultAdmissionTimeout, maxMatches: defaultAdmissionMaxMatches}
+
+// admission of patterns that look broad enough to overload crt.sh, only once a preliminary count of
+// their matches finishes within timeout and is at most maxMatches
+type admission struct {
+	force      bool
+	timeout    time.Duration
+	maxMatches int64
+}
+
+// broadPattern is why the LIKE pattern looks broad enough to be counted before it is run, "" if it doesn't
+func broadPattern(pattern string) string {
+	var (
+		suffix   strings.Builder
+		wildcard bool
+		escaped  bool
+	)
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+			continue
+		case r == '%', r == '_':
+			wildcard = true
+			suffix.Reset()
+			continue
+		}
+		suffix.WriteRune(r)
+	}
+
+	switch {
+	case !wildcard:
+		return ""
+	case suffix.Len() == 0:
+		// crt.sh looks names up by their reversed value, only a literal ending narrows the scan
+		return "it doesn't end in a literal name, so crt.sh has to scan every name"
+	}
+
+	if s := strings.TrimPrefix(suffix.String(), "."); s != "" && !strings.HasSuffix(s, ".") {
+		if ps, _ := publicsuffix.PublicSuffix(s); ps == s {
+			return fmt.Sprintf("it matches every name under the public suffix %v", s)
+		}
+	}
+
+	return ""
+}
+
+// admit set, counting the matches of its broad patterns on crt.sh first unless forced
+func (a *admission) admit(ctx context.Context, set patternSet) error {
+	if a.force {
+		return nil
+	}
+
+	broad := patternSet{exclude: set.exclude}
+	for _, pattern := range set.include {
+		if reason := broadPattern(pattern); reason != "" {
+			log.Printf("Pattern: (%v) looks broad as %v, counting its matches first\n", pattern, reason)
+			broad.include = append(broad.include, pattern)
+		}
+	}
+	if len(broad.include) == 0 {
+		return nil
+	}
+
+	countCtx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	count, err := countCertificatesByPatterns(countCtx, broad)
+	if err != nil {
+		if ctx.Err() == nil && errors.Is(countCtx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%w (%v), counting its matches took over %v, pass -force to run it anyway", errBroadPattern, broad, a.timeout)
+		}
+		return fmt.Errorf("could not count certificates of (%v) (%w)", broad, err)
+	}
+	if a.maxMatches > 0 && count > a.maxMatches {
+		return fmt.Errorf("%w (%v), it matches (%v) names over the -admission-max-rows of %v, pass -force to run it anyway", errBroadPattern, broad, count, a.maxMatches)
+	}
+
+	return nil
+}
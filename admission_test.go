@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBroadPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		broad   bool
+	}{
+		{pattern: "example.com"},
+		{pattern: "%.example.com"},
+		{pattern: "www.%.example.co.uk"},
+		{pattern: `a\%b.example.com`},
+		{pattern: "%", broad: true},
+		{pattern: "%example.com%", broad: true},
+		{pattern: "example._", broad: true},
+		{pattern: "%.com", broad: true},
+		{pattern: "%.co.uk", broad: true},
+	}
+
+	for _, tt := range tests {
+		if reason := broadPattern(tt.pattern); (reason != "") != tt.broad {
+			t.Errorf("broadPattern(%v) = (%v), want broad (%v)", tt.pattern, reason, tt.broad)
+		}
+	}
+}
+
+func TestAdmit(t *testing.T) {
+	tests := []struct {
+		name      string
+		admission admission
+		set       patternSet
+	}{
+		{name: "narrow patterns", set: patternSet{include: []string{"example.com", "%.example.com"}}},
+		{name: "forced", admission: admission{force: true}, set: patternSet{include: []string{"%.com"}}},
+	}
+
+	// neither counts on crt.sh, so neither needs it
+	for _, tt := range tests {
+		if err := tt.admission.admit(context.Background(), tt.set); err != nil {
+			t.Errorf("%v: (%v), want admitted", tt.name, err)
+		}
+	}
+}
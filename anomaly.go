@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// burstWindow and burstThreshold flag a certificate as part of a burst when at least
+	// burstThreshold certificates of a monitor were issued within burstWindow of each other
+	burstWindow    = 24 * time.Hour
+	burstThreshold = 10
+	// minValiditySamples is how many certificates are needed before a validity period can be abnormal
+	minValiditySamples = 3
+	// validityTolerance is how far from the usual validity period one may be before it is abnormal
+	validityTolerance = 7 * 24 * time.Hour
+)
+
+// issuanceProfile is what is usual for the certificates of a monitor, new ones are compared against it
+type issuanceProfile struct {
+	issuers    map[string]struct{}
+	validities []time.Duration
+	issued     []time.Time
+	// names on the certificates observed, lower case
+	names map[string]struct{}
+}
+
+func newIssuanceProfile() *issuanceProfile {
+	return &issuanceProfile{issuers: make(map[string]struct{}), names: make(map[string]struct{})}
+}
+
+// issuerKey of r, crt.sh's CA ID when known as CAs may share a name
+func issuerKey(r result) string {
+	if r.issuerCAID != 0 {
+		return fmt.Sprint(r.issuerCAID)
+	}
+
+	return r.cert().Issuer.String()
+}
+
+// observe r as usual
+func (p *issuanceProfile) observe(r result) {
+	p.issuers[issuerKey(r)] = struct{}{}
+	p.validities = append(p.validities, r.cert().NotAfter.Sub(r.cert().NotBefore))
+	p.issued = append(p.issued, r.cert().NotBefore)
+	for _, name := range r.cert().DNSNames {
+		p.names[strings.ToLower(name)] = struct{}{}
+	}
+}
+
+// renews is whether r is for names all on certificates observed before, a renewal of them
+func (p *issuanceProfile) renews(r result) bool {
+	if len(r.cert().DNSNames) == 0 {
+		return false
+	}
+	for _, name := range r.cert().DNSNames {
+		if _, ok := p.names[strings.ToLower(name)]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// anomalies of r compared to the certificates observed so far, and whether r is from a new CA
+func (p *issuanceProfile) anomalies(r result) (anomalies []string, newCA bool) {
+	if _, ok := p.issuers[issuerKey(r)]; !ok && len(p.issuers) > 0 {
+		anomalies = append(anomalies, fmt.Sprintf("first certificate from CA %v", friendlyIssuer(r.cert())))
+		newCA = true
+	}
+
+	if len(p.validities) >= minValiditySamples {
+		usual := medianDuration(p.validities)
+		validity := r.cert().NotAfter.Sub(r.cert().NotBefore)
+
+		diff := validity - usual
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > usual/2 && diff > validityTolerance {
+			anomalies = append(anomalies, fmt.Sprintf("validity of %v days where %v is usual", int(validity.Hours()/24), int(usual.Hours()/24)))
+		}
+	}
+
+	burst := 1
+	for _, issued := range p.issued {
+		d := r.cert().NotBefore.Sub(issued)
+		if d >= 0 && d < burstWindow {
+			burst++
+		}
+	}
+	if burst >= burstThreshold {
+		anomalies = append(anomalies, fmt.Sprintf("burst of %v certificates issued within %v", burst, burstWindow))
+	}
+
+	return anomalies, newCA
+}
+
+// medianDuration of ds, which must not be empty
+func medianDuration(ds []time.Duration) time.Duration {
+	sorted := append([]time.Duration(nil), ds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return sorted[len(sorted)/2]
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errTokenName       = errors.New("expected a token name")
+	errDuplicateToken  = errors.New("duplicate API token")
+	errClientCAWithTLS = errors.New("-client-ca requires -tls-cert and -tls-key or -acme-domains")
+	errNoClientCAs     = errors.New("no PEM encoded certificates found in client CA file")
+)
+
+// apiToken as stored in a tokens file, only the SHA-256 of the token itself is kept (ex: from
+// printf %s "$TOKEN" | sha256sum)
+type apiToken struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	// RatePerMinute of requests allowed, unlimited when not positive
+	RatePerMinute int `json:"rate_per_minute,omitempty"`
+	// Admin tokens may also rotate tokens
+	Admin bool `json:"admin,omitempty"`
+}
+
+// tokenFile is the JSON file of the API tokens serve accepts
+type tokenFile struct {
+	Tokens []apiToken `json:"tokens"`
+}
+
+// tokenBucket allows bursts of up to a minute's worth of requests, refilling continuously
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// allow a request at now at perMinute
+func (b *tokenBucket) allow(now time.Time, perMinute int) bool {
+	if perMinute <= 0 {
+		return true
+	}
+
+	if b.last.IsZero() {
+		b.tokens = float64(perMinute)
+	} else {
+		b.tokens += now.Sub(b.last).Minutes() * float64(perMinute)
+		if b.tokens > float64(perMinute) {
+			b.tokens = float64(perMinute)
+		}
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
+
+// tokenAuth authenticates requests by Authorization: Bearer <token> against a tokens file,
+// rate limiting each token on its own
+type tokenAuth struct {
+	path string
+
+	mu      sync.Mutex
+	tokens  []apiToken
+	buckets map[string]*tokenBucket
+}
+
+// newTokenAuth from the tokens file at path
+func newTokenAuth(path string) (*tokenAuth, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read tokens file (%w)", err)
+	}
+
+	var f tokenFile
+	if err = json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("could not decode tokens file (%w)", err)
+	}
+
+	seen := make(map[string]struct{}, len(f.Tokens))
+	for i, t := range f.Tokens {
+		f.Tokens[i].SHA256 = strings.ToLower(t.SHA256)
+		if _, ok := seen[t.Name]; ok {
+			return nil, fmt.Errorf("%w (%v)", errDuplicateToken, t.Name)
+		}
+		seen[t.Name] = struct{}{}
+	}
+
+	return &tokenAuth{path: path, tokens: f.Tokens, buckets: make(map[string]*tokenBucket)}, nil
+}
+
+// authenticate the bearer token of r, returning what it is
+func (a *tokenAuth) authenticate(r *http.Request) (apiToken, bool) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return apiToken{}, false
+	}
+	sum := sha256.Sum256([]byte(strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))))
+	hash := hex.EncodeToString(sum[:])
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, t := range a.tokens {
+		if t.SHA256 == hash {
+			return t, true
+		}
+	}
+
+	return apiToken{}, false
+}
+
+// allow a request by t at now within its rate limit
+func (a *tokenAuth) allow(t apiToken, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	b, ok := a.buckets[t.Name]
+	if !ok {
+		b = &tokenBucket{}
+		a.buckets[t.Name] = b
+	}
+
+	return b.allow(now, t.RatePerMinute)
+}
+
+// require a valid token for next, an admin token with admin
+func (a *tokenAuth) require(admin bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t, ok := a.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="findcert"`)
+			writeJSONError(w, http.StatusUnauthorized, "missing or invalid API token")
+			return
+		}
+		if admin && !t.Admin {
+			writeJSONError(w, http.StatusForbidden, "API token is not an admin token")
+			return
+		}
+		if !a.allow(t, time.Now()) {
+			w.Header().Set("Retry-After", strconv.Itoa(60/t.RatePerMinute+1))
+			writeJSONError(w, http.StatusTooManyRequests, "rate limit of API token exceeded")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rotate the token named name to a new random token, adding it if there is none by that name,
+// and persist the tokens file
+func (a *tokenAuth) rotate(name string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("could not generate token (%w)", err)
+	}
+	token := hex.EncodeToString(raw)
+	sum := sha256.Sum256([]byte(token))
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	tokens := append([]apiToken(nil), a.tokens...)
+	found := false
+	for i := range tokens {
+		if tokens[i].Name == name {
+			tokens[i].SHA256 = hex.EncodeToString(sum[:])
+			found = true
+		}
+	}
+	if !found {
+		tokens = append(tokens, apiToken{Name: name, SHA256: hex.EncodeToString(sum[:])})
+	}
+
+	if err := writeTokenFile(a.path, tokenFile{Tokens: tokens}); err != nil {
+		return "", err
+	}
+	a.tokens = tokens
+
+	return token, nil
+}
+
+// ServeHTTP POST /admin/tokens/rotate?name=<token name>, responding with the new token once
+func (a *tokenAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeJSONError(w, http.StatusBadRequest, errTokenName.Error())
+		return
+	}
+
+	token, err := a.rotate(name)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "could not rotate token")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Name  string `json:"name"`
+		Token string `json:"token"`
+	}{name, token})
+}
+
+// writeTokenFile to path, replacing any existing file only once fully written
+func writeTokenFile(path string, f tokenFile) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode tokens file (%w)", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not create tokens file (%w)", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write tokens file (%w)", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("could not write tokens file (%w)", err)
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("could not replace tokens file (%w)", err)
+	}
+
+	return nil
+}
+
+// clientCATLSConfig requiring client certificates issued by a CA in the PEM file at path
+func clientCATLSConfig(path string) (*tls.Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read client CA file (%w)", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errNoClientCAs
+	}
+
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
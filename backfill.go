@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	errExpectedBackfillTarget = errors.New("expected -db history file or -state to backfill into")
+	errBackfillCheckpoint     = errors.New("backfilling into a database needs a -checkpoint file")
+)
+
+// backfillProgress of a query, so an interrupted backfill resumes where it stopped
+type backfillProgress struct {
+	// Before is the crt.sh ID the next page starts below
+	Before int64 `json:"before"`
+	// Certificates backfilled so far
+	Certificates int  `json:"certificates"`
+	Done         bool `json:"done"`
+}
+
+// readBackfillProgress from path by query, empty if there is no file yet
+func readBackfillProgress(path string) (map[string]backfillProgress, error) {
+	progress := make(map[string]backfillProgress)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return progress, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read backfill progress (%w)", err)
+	}
+	if err = json.Unmarshal(data, &progress); err != nil {
+		return nil, fmt.Errorf("could not decode backfill progress (%v) (%w)", path, err)
+	}
+
+	return progress, nil
+}
+
+// writeBackfillProgress to path
+func writeBackfillProgress(path string, progress map[string]backfillProgress) error {
+	data, err := json.MarshalIndent(progress, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode backfill progress (%w)", err)
+	}
+	if err = os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("could not write backfill progress (%w)", err)
+	}
+
+	return nil
+}
+
+// baselinePage of results into the watcher state of key in the state file at path for query, so
+// watch and the daemon treat them as already seen and only alert on later issuance
+func baselinePage(path, key, query string, results []result) error {
+	return updateWatchState(path, func(state *watchState) {
+		w := newWatcher(query, len(results), nil, nil)
+		if s, ok := state.Watchers[key]; ok {
+			w.restore(s)
+		}
+		for _, r := range results {
+			sum := r.fingerprint()
+			if _, ok := w.seen[sum]; ok {
+				continue
+			}
+			w.seen[sum] = struct{}{}
+			w.profile.observe(r)
+		}
+		state.Watchers[key] = w.state()
+	})
+}
+
+// runBackfill ingests the whole CT history of newly monitored domains into the history file and
+// the watch state as a baseline, a page at a time so it can be interrupted and resumed
+func runBackfill(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	db := fs.String("db", "", "history file to record every certificate in as baseline, see findcert history")
+	statePath := fs.String("state", "", "state file of findcert watch -state or the daemon's state_file to mark every certificate seen in")
+	monitor := fs.String("monitor", "", "with -state, the daemon monitor to mark them seen for (ex: team-a/ops, or /ops outside a project), by default the watch of the same arguments")
+	checkpoint := fs.String("checkpoint", "", "file to keep progress in, to resume an interrupted backfill (default -db or -state with .backfill appended)")
+	restart := fs.Bool("restart", false, "start over instead of resuming from the checkpoint")
+	pageSize := fs.Int("page-size", 1000, "rows to fetch from crt.sh at a time, -crtsh-qps limits how often")
+	patternOpts := addPatternFlags(fs)
+	parseFlags(fs, args)
+
+	if *db == "" && *statePath == "" {
+		return errExpectedBackfillTarget
+	}
+
+	patterns, err := patternOpts.patterns(fs)
+	if err != nil {
+		return err
+	}
+	if err = crtshAdmission.admit(ctx, patterns); err != nil {
+		return err
+	}
+	query := patterns.String()
+	key := query
+	if *monitor != "" {
+		key = *monitor
+	}
+
+	if *checkpoint == "" {
+		target := *db
+		if target == "" {
+			target = *statePath
+		}
+		if strings.Contains(target, "://") {
+			return errBackfillCheckpoint
+		}
+		*checkpoint = target + ".backfill"
+	}
+	progress, err := readBackfillProgress(*checkpoint)
+	if err != nil {
+		return err
+	}
+	p := progress[key]
+	switch {
+	case *restart || p.Before == 0:
+		p = backfillProgress{Before: math.MaxInt64}
+	case p.Done:
+		log.Printf("(%v) already backfilled (%v) certificates, -restart to do it again\n", key, p.Certificates)
+		return nil
+	default:
+		log.Printf("resuming (%v) after (%v) certificates below crt.sh ID (%v)\n", key, p.Certificates, p.Before)
+	}
+
+	var history *historyStore
+	if *db != "" {
+		if history, err = openHistory(*db); err != nil {
+			return err
+		}
+		defer history.Close()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// each page is recorded before its progress, a resumed backfill at worst repeats a page
+	save := func(page []result) error {
+		for _, r := range page {
+			if history == nil {
+				break
+			}
+			err := history.record(historyEvent{
+				ObservedAt:  time.Now().UTC(),
+				Kind:        "baseline",
+				Source:      "backfill",
+				Query:       query,
+				Certificate: r.info(),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if *statePath != "" {
+			if err := baselinePage(*statePath, key, query, page); err != nil {
+				return err
+			}
+		}
+
+		p.Certificates += len(page)
+		progress[key] = p
+		return writeBackfillProgress(*checkpoint, progress)
+	}
+
+	var page []result
+	for r := range streamCertificatesByPatternsBefore(ctx, patterns, *pageSize, p.Before) {
+		if r.err != nil {
+			return fmt.Errorf("could not backfill (%v), run again to resume (%w)", key, r.err)
+		}
+		page = append(page, r.result)
+		if len(page) < *pageSize {
+			continue
+		}
+
+		// the stream is newest first, so the page ends at its lowest ID
+		p.Before = page[len(page)-1].id
+		if err = save(page); err != nil {
+			return err
+		}
+		log.Printf("backfilled (%v) certificates of (%v)\n", p.Certificates, key)
+		page = page[:0]
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	p.Done = true
+	if err = save(page); err != nil {
+		return err
+	}
+	log.Printf("backfilled (%v) certificates of (%v), later ones will alert\n", p.Certificates, key)
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// benchmarkDERs issued by one CA, as crt.sh would return for a large pull
+func benchmarkDERs(b testing.TB, n int) [][]byte {
+	b.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"Benchmark CA"}, CommonName: "Benchmark CA R1"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	ders := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("host%d.example.com", i)
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i) + 2),
+			Subject:      pkix.Name{CommonName: name},
+			DNSNames:     []string{name, "www." + name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, ca, &key.PublicKey, caKey)
+		if err != nil {
+			b.Fatal(err)
+		}
+		ders = append(ders, der)
+	}
+
+	return ders
+}
+
+// benchmarkResults of ders, none parsed yet
+func benchmarkResults(ders [][]byte) []result {
+	results := make([]result, 0, len(ders))
+	for i, der := range ders {
+		results = append(results, newResult(int64(i), 1, der))
+	}
+
+	return results
+}
+
+func BenchmarkScanDER(b *testing.B) {
+	ders := benchmarkDERs(b, 1000)
+	b.ResetTimer()
+
+	b.Run("slab", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var slab derSlab
+			for _, der := range ders {
+				_ = slab.copy(der)
+			}
+		}
+	})
+	b.Run("append", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, der := range ders {
+				_ = append([]byte(nil), der...)
+			}
+		}
+	})
+}
+
+func BenchmarkParse(b *testing.B) {
+	ders := benchmarkDERs(b, 1000)
+	b.ResetTimer()
+
+	b.Run("fingerprint", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, r := range benchmarkResults(ders) {
+				_ = r.fingerprint()
+			}
+		}
+	})
+	b.Run("info", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, r := range benchmarkResults(ders) {
+				_ = r.info()
+			}
+		}
+	})
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for range analyzeResults(context.Background(), benchmarkResults(ders), workers, true) {
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkOutput(b *testing.B) {
+	ders := benchmarkDERs(b, 1000)
+
+	for _, format := range []string{"text", "json", "quiet"} {
+		fs := flag.NewFlagSet(format, flag.ContinueOnError)
+		o := addOutputFlags(fs)
+		if format == "quiet" {
+			*o.quiet = true
+		} else {
+			*o.format = format
+		}
+
+		b.Run(format, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				// parsed beforehand so only formatting is measured
+				b.StopTimer()
+				results := benchmarkResults(ders)
+				for _, r := range results {
+					_ = r.info()
+				}
+				b.StartTimer()
+
+				f, err := o.formatter(io.Discard, time.Now())
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err = f.writeHeader("%.example.com"); err != nil {
+					b.Fatal(err)
+				}
+				for _, r := range results {
+					if err = f.writeResult(r); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if err = f.flush(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// redisCachePrefix of the keys responses are shared under in Redis
+const redisCachePrefix = "findcert:search:"
+
+// responseCache of search responses, least recently used evicted once full and expiring after ttl,
+// backed by Redis when remote is set so replicas behind a load balancer share responses
+type responseCache struct {
+	ttl      time.Duration
+	capacity int
+	remote   *redisClient
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	bypasses  atomic.Int64
+	evictions atomic.Int64
+	// remoteErrors of Redis, each served as a miss or not shared
+	remoteErrors atomic.Int64
+}
+
+type cacheEntry struct {
+	key     string
+	expires time.Time
+	resp    searchResponse
+}
+
+// remoteEntry is a response as stored in Redis, with its expiry so replicas expire it together
+type remoteEntry struct {
+	Expires  time.Time      `json:"expires"`
+	Response searchResponse `json:"response"`
+}
+
+// newResponseCache of up to capacity responses for ttl, nil (no caching) if either is not positive
+func newResponseCache(capacity int, ttl time.Duration) *responseCache {
+	if capacity <= 0 || ttl <= 0 {
+		return nil
+	}
+
+	return &responseCache{
+		ttl:      ttl,
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// cacheKey of a query normalized so equivalent queries share an entry
+func cacheKey(domain string, limit int) string {
+	return fmt.Sprintf("%v/%v", strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), "."), limit)
+}
+
+// get the response cached for key at now, from Redis when it isn't cached locally
+func (c *responseCache) get(key string, now time.Time) (searchResponse, bool) {
+	if resp, ok := c.getLocal(key, now); ok {
+		c.hits.Add(1)
+		return resp, true
+	}
+
+	if c.remote != nil {
+		if entry, ok := c.getRemote(key); ok && now.Before(entry.Expires) {
+			c.putLocal(key, entry.Response, entry.Expires)
+			c.hits.Add(1)
+			return entry.Response, true
+		}
+	}
+
+	c.misses.Add(1)
+	return searchResponse{}, false
+}
+
+// getLocal is the response cached in memory for key at now
+func (c *responseCache) getLocal(key string, now time.Time) (searchResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return searchResponse{}, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if now.After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return searchResponse{}, false
+	}
+
+	c.order.MoveToFront(elem)
+
+	return entry.resp, true
+}
+
+// getRemote is the entry in Redis for key, a Redis error is logged and counted as a miss so crt.sh
+// is queried instead
+func (c *responseCache) getRemote(key string) (remoteEntry, bool) {
+	data, ok, err := c.remote.get(redisCachePrefix + key)
+	if err == nil && ok {
+		var entry remoteEntry
+		if err = json.Unmarshal(data, &entry); err == nil {
+			return entry, true
+		}
+		err = fmt.Errorf("could not decode cached response (%w)", err)
+	}
+	if err != nil {
+		c.remoteErrors.Add(1)
+		log.Printf("could not get (%v) from Redis cache error (%v)\n", key, err)
+	}
+
+	return remoteEntry{}, false
+}
+
+// put resp for key at now, in Redis as well when configured
+func (c *responseCache) put(key string, resp searchResponse, now time.Time) {
+	expires := now.Add(c.ttl)
+	c.putLocal(key, resp, expires)
+
+	if c.remote == nil {
+		return
+	}
+	data, err := json.Marshal(remoteEntry{Expires: expires, Response: resp})
+	if err == nil {
+		err = c.remote.set(redisCachePrefix+key, data, c.ttl)
+	}
+	if err != nil {
+		c.remoteErrors.Add(1)
+		log.Printf("could not put (%v) in Redis cache error (%v)\n", key, err)
+	}
+}
+
+// putLocal resp for key until expires, evicting the least recently used entry when full
+func (c *responseCache) putLocal(key string, resp searchResponse, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = &cacheEntry{key: key, expires: expires, resp: resp}
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, expires: expires, resp: resp})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+		c.evictions.Add(1)
+	}
+}
+
+// bypassCache when the request asks for a fresh response with Cache-Control: no-cache
+func bypassCache(r *http.Request) bool {
+	for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeMetrics of the cache to w in the Prometheus text format
+func (c *responseCache) writeMetrics(w io.Writer) {
+	c.mu.Lock()
+	size := c.order.Len()
+	c.mu.Unlock()
+
+	fmt.Fprintf(w, "# TYPE findcert_cache_hits_total counter\nfindcert_cache_hits_total %v\n", c.hits.Load())
+	fmt.Fprintf(w, "# TYPE findcert_cache_misses_total counter\nfindcert_cache_misses_total %v\n", c.misses.Load())
+	fmt.Fprintf(w, "# TYPE findcert_cache_bypasses_total counter\nfindcert_cache_bypasses_total %v\n", c.bypasses.Load())
+	fmt.Fprintf(w, "# TYPE findcert_cache_evictions_total counter\nfindcert_cache_evictions_total %v\n", c.evictions.Load())
+	fmt.Fprintf(w, "# TYPE findcert_cache_entries gauge\nfindcert_cache_entries %v\n", size)
+	if c.remote != nil {
+		fmt.Fprintf(w, "# TYPE findcert_cache_redis_errors_total counter\nfindcert_cache_redis_errors_total %v\n", c.remoteErrors.Load())
+	}
+}
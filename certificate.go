@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// jsonSchemaVersion of the JSON written by search -format json and served by /search, the response
+// and the certificateInfo of each certificate in it. Within a version fields are only ever added,
+// never renamed, removed or changed in type or meaning, so integrators should ignore fields they
+// don't know. Any other change increments it
+const jsonSchemaVersion = 1
+
+// certificateInfo is the structured summary of a certificate handed to sinks and exporters
+type certificateInfo struct {
+	// ID of the certificate on crt.sh, 0 when not known (ex: read from a file)
+	ID int64 `json:"crtsh_id,omitempty"`
+	// SHA256 fingerprint of the DER, lowercase hex
+	SHA256     string   `json:"sha256"`
+	CommonName string   `json:"common_name"`
+	DNSNames   []string `json:"dns_names,omitempty"`
+	// Subject and Issuer as RFC 2253 strings with each attribute also listed in order
+	Subject           string        `json:"subject"`
+	SubjectAttributes []dnAttribute `json:"subject_attributes,omitempty"`
+	Issuer            string        `json:"issuer"`
+	IssuerAttributes  []dnAttribute `json:"issuer_attributes,omitempty"`
+	// IssuerName is the issuer's organization and common name (ex: Let's Encrypt R3)
+	IssuerName string `json:"issuer_name"`
+	// IssuerCAID of the issuer on crt.sh, 0 when not known
+	IssuerCAID int64 `json:"issuer_ca_id,omitempty"`
+	// Serial number, lowercase hex
+	Serial    string    `json:"serial"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	// FirstSeen is when the certificate was first logged to CT, when known
+	FirstSeen *time.Time `json:"first_seen,omitempty"`
+	// NotYetValid when NotBefore is after the time the output was written
+	NotYetValid bool                  `json:"not_yet_valid,omitempty"`
+	Extensions  certificateExtensions `json:"extensions"`
+}
+
+// newCertificateInfo from a parsed certificate
+func newCertificateInfo(cert *x509.Certificate) certificateInfo {
+	sum := sha256.Sum256(cert.Raw)
+
+	return certificateInfo{
+		SHA256:            hex.EncodeToString(sum[:]),
+		CommonName:        cert.Subject.CommonName,
+		DNSNames:          cert.DNSNames,
+		Subject:           rfc2253(cert.RawSubject, cert.Subject),
+		SubjectAttributes: dnAttributes(cert.RawSubject),
+		Issuer:            rfc2253(cert.RawIssuer, cert.Issuer),
+		IssuerAttributes:  dnAttributes(cert.RawIssuer),
+		IssuerName:        friendlyIssuer(cert),
+		Serial:            cert.SerialNumber.Text(16),
+		NotBefore:         cert.NotBefore,
+		NotAfter:          cert.NotAfter,
+		Extensions:        decodeExtensions(cert),
+	}
+}
+
+// friendlyIssuer name of cert's issuer, its organization and common name (ex: Let's Encrypt R3)
+func friendlyIssuer(cert *x509.Certificate) string {
+	cn := cert.Issuer.CommonName
+	if len(cert.Issuer.Organization) == 0 {
+		if cn == "" {
+			return cert.Issuer.String()
+		}
+		return cn
+	}
+
+	org := cert.Issuer.Organization[0]
+	switch {
+	case cn == "":
+		return org
+	case strings.Contains(cn, org):
+		return cn
+	}
+
+	return org + " " + cn
+}
+
+// certificateEvent pairs a certificate with the query that found it, monitors add how severe finding it is
+type certificateEvent struct {
+	Query       string          `json:"query"`
+	Severity    severity        `json:"severity,omitempty"`
+	Warnings    []string        `json:"warnings,omitempty"`
+	Anomalies   []string        `json:"anomalies,omitempty"`
+	Certificate certificateInfo `json:"certificate"`
+}
+
+// notYetValid marks c when its NotBefore is after now, from clock skew or a pre-staged certificate
+func (c certificateInfo) notYetValid(now time.Time) certificateInfo {
+	c.NotYetValid = c.NotBefore.After(now)
+	return c
+}
+
+// displayName of the certificate, its CommonName or first DNS name when the CommonName is empty
+func (c certificateInfo) displayName() string {
+	if c.CommonName == "" && len(c.DNSNames) > 0 {
+		return c.DNSNames[0]
+	}
+
+	return c.CommonName
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/simplylib/multierror"
+)
+
+// maxChainDepth is the most intermediates followed above a certificate
+const maxChainDepth = 5
+
+// caCertificatesQuery selects the certificates of a CA on crt.sh, there may be several when it is
+// cross-signed or has been reissued, with the CA that issued each
+const caCertificatesQuery = "SELECT c.issuer_ca_id, c.certificate FROM ca_certificate cac JOIN certificate c ON c.id = cac.certificate_id WHERE cac.ca_id = $1;"
+
+var errChainWithoutPEM = errors.New("-chain writes PEM bundles and needs -pem with -format text")
+
+// caCertificate is a certificate of a CA and the crt.sh ID of the CA that issued it
+type caCertificate struct {
+	issuerCAID int64
+	cert       *x509.Certificate
+}
+
+// chainFetcher builds certificate chains from the CA certificates on crt.sh, fetching those of
+// each CA once as most certificates share their issuers
+type chainFetcher struct {
+	cas map[int64][]caCertificate
+}
+
+func newChainFetcher() *chainFetcher {
+	return &chainFetcher{cas: make(map[int64][]caCertificate)}
+}
+
+// caCertificates of the CA with crt.sh ID caID
+func (c *chainFetcher) caCertificates(ctx context.Context, caID int64) ([]caCertificate, error) {
+	if certs, ok := c.cas[caID]; ok {
+		return certs, nil
+	}
+
+	var certs []caCertificate
+	err := crtshMirrors.withDB(ctx, func(db *sql.DB) (err error) {
+		certs = nil
+
+		rows, err := db.QueryContext(ctx, caCertificatesQuery, caID)
+		if err != nil {
+			return fmt.Errorf("could not execute SQL on postgres for finding CA certificates (%w)", err)
+		}
+		defer func() {
+			err = multierror.Append(err, rows.Close())
+		}()
+
+		for rows.Next() {
+			var (
+				issuerCAID sql.NullInt64
+				der        []byte
+			)
+			if err = rows.Scan(&issuerCAID, &der); err != nil {
+				return fmt.Errorf("could not scan row (%w)", err)
+			}
+			if err = crtshUsage.row(len(der)); err != nil {
+				return err
+			}
+
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				// a CA certificate that can't be parsed can't be in a chain either
+				continue
+			}
+			certs = append(certs, caCertificate{issuerCAID: issuerCAID.Int64, cert: cert})
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.cas[caID] = certs
+	return certs, nil
+}
+
+// chain of intermediates above r at now, issuer first, as a fullchain bundle has them after the
+// leaf. The root is left out as clients have it, an issuer not on crt.sh ends the chain early
+func (c *chainFetcher) chain(ctx context.Context, r result, now time.Time) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+
+	cert, caID := r.cert(), r.issuerCAID
+	for len(chain) < maxChainDepth && caID != 0 {
+		candidates, err := c.caCertificates(ctx, caID)
+		if err != nil {
+			return nil, err
+		}
+
+		issuer, ok := pickIssuer(cert, candidates, now)
+		if !ok || isSelfSigned(issuer.cert) {
+			break
+		}
+
+		chain = append(chain, issuer.cert)
+		cert, caID = issuer.cert, issuer.issuerCAID
+	}
+
+	return chain, nil
+}
+
+// pickIssuer of cert among candidates, one that signed it, preferring one valid at now that
+// expires last so the bundle outlives the leaf where possible
+func pickIssuer(cert *x509.Certificate, candidates []caCertificate, now time.Time) (caCertificate, bool) {
+	var (
+		best      caCertificate
+		bestValid bool
+		found     bool
+	)
+	for _, candidate := range candidates {
+		if cert.CheckSignatureFrom(candidate.cert) != nil {
+			continue
+		}
+
+		valid := !now.Before(candidate.cert.NotBefore) && !now.After(candidate.cert.NotAfter)
+		if found && (bestValid && !valid || bestValid == valid && !candidate.cert.NotAfter.After(best.cert.NotAfter)) {
+			continue
+		}
+		best, bestValid, found = candidate, valid, true
+	}
+
+	return best, found
+}
+
+// isSelfSigned is whether cert is a root, issued and signed by itself
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(cert) == nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	telegramAPIURL = "https://api.telegram.org"
+	// telegramMaxText is the longest message Telegram accepts
+	telegramMaxText = 4096
+)
+
+var (
+	errTelegramToken = errors.New("telegram notifier needs token (a bot token) or $TELEGRAM_BOT_TOKEN")
+	errTelegramChat  = errors.New("telegram notifier needs chat, the chat ID to message")
+	errMatrixRoom    = errors.New("matrix notifier needs chat, the ID of the room (ex: !abc:matrix.org) to message")
+	errMatrixToken   = errors.New("matrix notifier needs token, an access token of a user in the room")
+)
+
+// newTelegramSink messages the chat of cfg as the bot of its token, url is only needed for a
+// self-hosted Bot API server
+func newTelegramSink(cfg notifierConfig) (eventSink, error) {
+	token := cfg.Token
+	if token == "" {
+		token = os.Getenv("TELEGRAM_BOT_TOKEN")
+	}
+	if token == "" {
+		return nil, errTelegramToken
+	}
+	if cfg.Chat == "" {
+		return nil, errTelegramChat
+	}
+
+	api := cfg.URL
+	if api == "" {
+		api = telegramAPIURL
+	}
+	chat := cfg.Chat
+
+	message, err := cfg.message()
+	if err != nil {
+		return nil, err
+	}
+
+	return newWebhookSink(strings.TrimSuffix(api, "/")+"/bot"+token+"/sendMessage", withMessage(message, func(msg, source string, event any) ([]byte, error) {
+		text := []rune(msg)
+		if len(text) > telegramMaxText {
+			text = append(text[:telegramMaxText-3], []rune("...")...)
+		}
+		return json.Marshal(struct {
+			ChatID                string `json:"chat_id"`
+			Text                  string `json:"text"`
+			DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+		}{chat, string(text), true})
+	})), nil
+}
+
+// matrixSink sends each event as a message to a Matrix room
+type matrixSink struct {
+	*webhookSink
+	room string
+	// txnPrefix and txn make the transaction ID of each message, which the homeserver uses to
+	// drop retries of a message already sent
+	txnPrefix string
+	txn       atomic.Int64
+}
+
+// newMatrixSink messages the room of cfg on the homeserver at cfg.URL (ex: https://matrix.org)
+func newMatrixSink(cfg notifierConfig) (eventSink, error) {
+	if cfg.URL == "" {
+		return nil, errNotifierURL
+	}
+	if cfg.Chat == "" {
+		return nil, errMatrixRoom
+	}
+	if cfg.Token == "" {
+		return nil, errMatrixToken
+	}
+
+	text, err := cfg.message()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &matrixSink{
+		webhookSink: newWebhookSink(strings.TrimSuffix(cfg.URL, "/"), withMessage(text, formatMatrix)),
+		room:        cfg.Chat,
+		txnPrefix:   fmt.Sprintf("findcert-%d", time.Now().UnixNano()),
+	}
+	s.header = http.Header{"Authorization": {"Bearer " + cfg.Token}}
+
+	return s, nil
+}
+
+// Send the event immediately
+func (s *matrixSink) Send(ctx context.Context, source string, event any) error {
+	body, err := s.format(source, event)
+	if err != nil {
+		return fmt.Errorf("could not encode Matrix message (%w)", err)
+	}
+
+	u := fmt.Sprintf("%v/_matrix/client/v3/rooms/%v/send/m.room.message/%v-%d",
+		s.url, url.PathEscape(s.room), s.txnPrefix, s.txn.Add(1))
+
+	return s.do(ctx, http.MethodPut, u, body)
+}
+
+// formatMatrix as a text message, critical ones as m.text and the rest as m.notice which bots
+// are expected to send and clients may notify less loudly of
+func formatMatrix(msg, source string, event any) ([]byte, error) {
+	msgtype := "m.notice"
+	if eventSeverity(event) >= severityCritical {
+		msgtype = "m.text"
+	}
+
+	return json.Marshal(struct {
+		MsgType string `json:"msgtype"`
+		Body    string `json:"body"`
+	}{msgtype, msg})
+}
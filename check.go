@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	errExpectedPolicy   = errors.New("expected a policy file via -policy")
+	errPolicyPattern    = errors.New("invalid forbidden name pattern")
+	errPolicyViolations = errors.New("certificates violate the policy")
+	errPolicyRule       = errors.New("unknown policy rule")
+)
+
+// certificatePolicy is what every certificate of an organization must meet, read from a YAML or
+// JSON file, each rule left out or 0 is not checked
+type certificatePolicy struct {
+	// AllowedCAs are crt.sh CA IDs or case insensitive parts of the issuer's name (ex: Let's Encrypt)
+	AllowedCAs []string `json:"allowed_cas" yaml:"allowed_cas"`
+	// MaxValidityDays between NotBefore and NotAfter
+	MaxValidityDays int `json:"max_validity_days" yaml:"max_validity_days"`
+	// MinRSABits and MinECDSABits are the smallest keys allowed of each type
+	MinRSABits   int `json:"min_rsa_bits" yaml:"min_rsa_bits"`
+	MinECDSABits int `json:"min_ecdsa_bits" yaml:"min_ecdsa_bits"`
+	// AllowedKeyTypes are the key algorithms allowed (ex: RSA, ECDSA, Ed25519)
+	AllowedKeyTypes []string `json:"allowed_key_types" yaml:"allowed_key_types"`
+	// ForbiddenNames are case insensitive glob patterns no DNS name may match (ex: *.internal.example.com)
+	ForbiddenNames []string `json:"forbidden_names" yaml:"forbidden_names"`
+	// MinSCTs embedded in a certificate for it to be CT compliant, precertificates are not checked
+	MinSCTs int `json:"min_scts" yaml:"min_scts"`
+	// ForbidWeakSignatures signed with MD5 or SHA-1
+	ForbidWeakSignatures bool `json:"forbid_weak_signatures" yaml:"forbid_weak_signatures"`
+	// Severities of violating each rule by its name, default critical
+	Severities map[string]severity `json:"severities" yaml:"severities"`
+}
+
+// policyRules of a certificatePolicy by the name each is configured and reported with
+var policyRules = []struct {
+	id          string
+	description string
+}{
+	{"allowed_cas", "Certificate issued by a CA the policy does not allow"},
+	{"max_validity_days", "Certificate valid for longer than the policy allows"},
+	{"min_rsa_bits", "RSA key shorter than the policy requires"},
+	{"min_ecdsa_bits", "ECDSA key shorter than the policy requires"},
+	{"allowed_key_types", "Key of a type the policy does not allow"},
+	{"forbidden_names", "DNS name matching a name the policy forbids"},
+	{"min_scts", "Fewer embedded SCTs than the policy requires for CT compliance"},
+	{"forbid_weak_signatures", "Certificate signed with MD5 or SHA-1"},
+}
+
+// policyViolation of a rule by a certificate
+type policyViolation struct {
+	Rule     string   `json:"rule"`
+	Severity severity `json:"severity"`
+	Detail   string   `json:"detail"`
+}
+
+// policyError is returned when certificates violate a policy, its exit status telling CI pipelines
+// how severe the worst violation was
+type policyError struct {
+	failed int
+	worst  severity
+}
+
+func (e policyError) Error() string {
+	return fmt.Sprintf("%v (%v) worst severity (%v)", errPolicyViolations, e.failed, e.worst)
+}
+
+func (e policyError) Unwrap() error {
+	return errPolicyViolations
+}
+
+// ExitCode of 2, 3 or 4 for a worst severity of info, warning or critical
+func (e policyError) ExitCode() int {
+	return 1 + int(e.worst)
+}
+
+// policyVerdict on a certificate, pass when it has no violations and fail otherwise
+type policyVerdict struct {
+	Verdict    string            `json:"verdict"`
+	Violations []policyViolation `json:"violations,omitempty"`
+	certificateInfo
+}
+
+// readCertificatePolicy from the file at name, YAML if it ends in .yaml or .yml and JSON otherwise
+func readCertificatePolicy(name string) (*certificatePolicy, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not read policy (%w)", err)
+	}
+
+	var p certificatePolicy
+	switch strings.ToLower(path.Ext(name)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&p)
+		// an empty file is a policy checking nothing, as {} is
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&p)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not decode policy (%v) (%w)", name, err)
+	}
+
+	for rule := range p.Severities {
+		known := false
+		for _, r := range policyRules {
+			known = known || r.id == rule
+		}
+		if !known {
+			return nil, fmt.Errorf("%w (%v)", errPolicyRule, rule)
+		}
+	}
+
+	for _, pattern := range p.ForbiddenNames {
+		if _, err = path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%w (%v)", errPolicyPattern, pattern)
+		}
+	}
+
+	return &p, nil
+}
+
+// evaluate r against p
+func (p *certificatePolicy) evaluate(r result) policyVerdict {
+	cert := r.cert()
+
+	var violations []policyViolation
+	violate := func(rule, format string, a ...any) {
+		sev, ok := p.Severities[rule]
+		if !ok {
+			sev = severityCritical
+		}
+		violations = append(violations, policyViolation{Rule: rule, Severity: sev, Detail: fmt.Sprintf(format, a...)})
+	}
+
+	if len(p.AllowedCAs) > 0 && !(&alertPolicy{AllowedCAs: p.AllowedCAs}).allowed(r) {
+		violate("allowed_cas", "issued by %v", friendlyIssuer(cert))
+	}
+
+	validity := int(cert.NotAfter.Sub(cert.NotBefore).Hours() / 24)
+	if p.MaxValidityDays > 0 && validity > p.MaxValidityDays {
+		violate("max_validity_days", "validity of %v days exceeds %v", validity, p.MaxValidityDays)
+	}
+
+	switch bits := publicKeyBits(cert); cert.PublicKeyAlgorithm {
+	case x509.RSA:
+		if bits < p.MinRSABits {
+			violate("min_rsa_bits", "RSA key of %v bits is under %v", bits, p.MinRSABits)
+		}
+	case x509.ECDSA:
+		if bits < p.MinECDSABits {
+			violate("min_ecdsa_bits", "ECDSA key of %v bits is under %v", bits, p.MinECDSABits)
+		}
+	}
+
+	if len(p.AllowedKeyTypes) > 0 {
+		allowed := false
+		for _, t := range p.AllowedKeyTypes {
+			if strings.EqualFold(t, cert.PublicKeyAlgorithm.String()) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			violate("allowed_key_types", "%v key", cert.PublicKeyAlgorithm)
+		}
+	}
+
+	for _, name := range certificateNames(cert) {
+		for _, pattern := range p.ForbiddenNames {
+			// patterns were checked when the policy was read
+			if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name)); ok {
+				violate("forbidden_names", "%v matches %v", name, pattern)
+			}
+		}
+	}
+
+	if p.MinSCTs > 0 && !isPrecertificate(cert) {
+		if n := embeddedSCTs(cert); n < p.MinSCTs {
+			violate("min_scts", "%v embedded SCTs, %v required", n, p.MinSCTs)
+		}
+	}
+
+	if p.ForbidWeakSignatures && weakSignature(cert) {
+		violate("forbid_weak_signatures", "signed with %v", cert.SignatureAlgorithm)
+	}
+
+	verdict := policyVerdict{Verdict: "pass", Violations: violations, certificateInfo: r.info()}
+	if len(violations) > 0 {
+		verdict.Verdict = "fail"
+	}
+
+	return verdict
+}
+
+// embeddedSCTs is the number of SCTs embedded in cert, an SCT list that can't be decoded has none
+func embeddedSCTs(cert *x509.Certificate) int {
+	for _, e := range cert.Extensions {
+		if !e.Id.Equal(oidSCTList) {
+			continue
+		}
+		scts, err := parseSCTList(e.Value)
+		if err != nil {
+			return 0
+		}
+		return len(scts)
+	}
+
+	return 0
+}
+
+func runCheck(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	source := addSourceFlags(fs, 1000)
+	policyFile := fs.String("policy", "", "YAML (.yaml or .yml) or JSON policy file of the rules every certificate must meet")
+	format := fs.String("format", "text", "output format: text, json, sarif for code scanning dashboards, github for Actions annotations or gitlab for a code quality report")
+	var failOn severity
+	fs.TextVar(&failOn, "fail-on", severityInfo, "exit with 2, 3 or 4 for the worst severity violated, info, warning or critical, when it is at least this")
+	all := fs.Bool("all", false, "also list the certificates that pass")
+	output := addOutputFileFlag(fs)
+	parseFlags(fs, args)
+
+	switch *format {
+	case "text", "json", "sarif", "github", "gitlab":
+	default:
+		return fmt.Errorf("%w (%v)", errUnknownFormat, *format)
+	}
+
+	if *policyFile == "" {
+		return errExpectedPolicy
+	}
+	policy, err := readCertificatePolicy(*policyFile)
+	if err != nil {
+		return err
+	}
+
+	_, results, err := source.certificates(ctx, fs)
+	if err != nil {
+		return err
+	}
+
+	verdicts := []policyVerdict{}
+	failed := 0
+	var worst severity
+	for _, r := range results {
+		v := policy.evaluate(r)
+		for _, violation := range v.Violations {
+			if violation.Severity > worst {
+				worst = violation.Severity
+			}
+		}
+		if v.Verdict == "fail" {
+			failed++
+		} else if !*all {
+			continue
+		}
+		verdicts = append(verdicts, v)
+	}
+
+	err = writeOutput(*output, func(out io.Writer) error {
+		switch *format {
+		case "sarif":
+			if err := writeSARIF(out, verdicts, *policyFile); err != nil {
+				return err
+			}
+		case "github":
+			writeGitHubAnnotations(out, verdicts, *policyFile)
+		case "gitlab":
+			if err := writeGitLabCodeQuality(out, verdicts, *policyFile); err != nil {
+				return err
+			}
+		case "json":
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(verdicts); err != nil {
+				return fmt.Errorf("could not write JSON (%w)", err)
+			}
+		default:
+			for _, v := range verdicts {
+				fmt.Fprintf(out, "Verdict: (%v) CommonName: (%v) Issuer: (%v) NotAfter: (%v) SHA-256: (%v)\n",
+					v.Verdict,
+					displayIDN(v.displayName()),
+					v.IssuerName,
+					v.NotAfter.UTC().Format(time.RFC3339),
+					v.SHA256,
+				)
+				for _, violation := range v.Violations {
+					fmt.Fprintf(out, "  %v (%v): %v\n", violation.Rule, violation.Severity, violation.Detail)
+				}
+			}
+			fmt.Fprintf(out, "Certificates checked: (%v) Passed: (%v) Failed: (%v)\n", len(results), len(results)-failed, failed)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if failed > 0 && worst >= failOn {
+		return policyError{failed: failed, worst: worst}
+	}
+
+	return nil
+}
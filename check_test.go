@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadCertificatePolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  bool
+	}{
+		{name: "policy.yaml", data: "allowed_cas: [Let's Encrypt]\nmax_validity_days: 90\nforbidden_names: ['*.internal.example.com']\nseverities:\n  max_validity_days: warning\n"},
+		{name: "policy.yml", data: "max_validity_days: 90\nseverities: {max_validity_days: warning}\nallowed_cas: [Let's Encrypt]\nforbidden_names: ['*.internal.example.com']\n"},
+		{name: "policy.json", data: `{"allowed_cas": ["Let's Encrypt"], "max_validity_days": 90, "forbidden_names": ["*.internal.example.com"], "severities": {"max_validity_days": "warning"}}`},
+		{name: "unknown.yaml", data: "max_validity: 90\n", err: true},
+		{name: "unknown.json", data: `{"max_validity": 90}`, err: true},
+		{name: "rule.yaml", data: "severities:\n  max_validity: warning\n", err: true},
+		{name: "severity.yaml", data: "severities:\n  max_validity_days: loud\n", err: true},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		name := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(name, []byte(tt.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		p, err := readCertificatePolicy(name)
+		if (err != nil) != tt.err {
+			t.Errorf("%v: error (%v), want error (%v)", tt.name, err, tt.err)
+			continue
+		}
+		if tt.err {
+			continue
+		}
+		if p.MaxValidityDays != 90 || len(p.AllowedCAs) != 1 || len(p.ForbiddenNames) != 1 || p.Severities["max_validity_days"] != severityWarning {
+			t.Errorf("%v: (%+v), want the rules of the file", tt.name, p)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// gitHubEscaper of workflow command messages, and of their properties also : and ,
+var (
+	gitHubEscaper         = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	gitHubPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+// writeGitHubAnnotations of the violations in verdicts to w as GitHub Actions workflow commands, each
+// an annotation on the policy file at policyPath
+func writeGitHubAnnotations(w io.Writer, verdicts []policyVerdict, policyPath string) {
+	file := gitHubPropertyEscaper.Replace(filepath.ToSlash(policyPath))
+	for _, v := range verdicts {
+		for _, violation := range v.Violations {
+			command := "error"
+			switch violation.Severity {
+			case severityWarning:
+				command = "warning"
+			case severityInfo:
+				command = "notice"
+			}
+
+			fmt.Fprintf(w, "::%v file=%v,title=%v::%v\n",
+				command,
+				file,
+				gitHubPropertyEscaper.Replace(violation.Rule+" "+v.displayName()),
+				gitHubEscaper.Replace(fmt.Sprintf("%v: %v (https://crt.sh/?sha256=%v)", v.displayName(), violation.Detail, v.SHA256)),
+			)
+		}
+	}
+}
+
+// gitLabIssue is a finding in GitLab's code quality report format
+type gitLabIssue struct {
+	Description string         `json:"description"`
+	CheckName   string         `json:"check_name"`
+	Fingerprint string         `json:"fingerprint"`
+	Severity    string         `json:"severity"`
+	Location    gitLabLocation `json:"location"`
+}
+
+type gitLabLocation struct {
+	Path  string      `json:"path"`
+	Lines gitLabLines `json:"lines"`
+}
+
+type gitLabLines struct {
+	Begin int `json:"begin"`
+}
+
+// writeGitLabCodeQuality of the violations in verdicts to w as a code quality report, each located
+// in the policy file at policyPath and fingerprinted by the certificate and rule
+func writeGitLabCodeQuality(w io.Writer, verdicts []policyVerdict, policyPath string) error {
+	issues := []gitLabIssue{}
+	for _, v := range verdicts {
+		for _, violation := range v.Violations {
+			sev := "info"
+			switch violation.Severity {
+			case severityCritical:
+				sev = "critical"
+			case severityWarning:
+				sev = "major"
+			}
+
+			fingerprint := sha256.Sum256([]byte(v.SHA256 + ":" + violation.Rule))
+			issues = append(issues, gitLabIssue{
+				Description: fmt.Sprintf("%v: %v (https://crt.sh/?sha256=%v)", v.displayName(), violation.Detail, v.SHA256),
+				CheckName:   violation.Rule,
+				Fingerprint: hex.EncodeToString(fingerprint[:]),
+				Severity:    sev,
+				Location: gitLabLocation{
+					Path:  filepath.ToSlash(policyPath),
+					Lines: gitLabLines{Begin: 1},
+				},
+			})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(issues); err != nil {
+		return fmt.Errorf("could not write code quality report (%w)", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// crtshFlights coalesces identical queries to crt.sh running at once, so a burst of the same search
+// (ex: dashboards refreshing together, or monitors sharing a query) is sent once
+var crtshFlights = &queryFlights{}
+
+// queryFlights of the queries running, by their SQL and parameters
+type queryFlights struct {
+	mu      sync.Mutex
+	flights map[string]*queryFlight
+}
+
+// queryFlight is a running query shared by waiters callers, done is closed once results and err are set
+type queryFlight struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	results []result
+	err     error
+}
+
+// flightKey of query with args, identical only for the same SQL and parameters
+func flightKey(query string, args []any) string {
+	return fmt.Sprintf("%v %#v", query, args)
+}
+
+// do run for key, or wait for the identical run already in flight and share its results. The run is
+// only stopped once every caller waiting on it is done, the last of them getting what was scanned
+func (f *queryFlights) do(ctx context.Context, key string, run func(ctx context.Context) ([]result, error)) ([]result, error) {
+	f.mu.Lock()
+	if f.flights == nil {
+		f.flights = make(map[string]*queryFlight)
+	}
+	flight, ok := f.flights[key]
+	if ok {
+		flight.waiters++
+		crtshUsage.coalesced.Add(1)
+	} else {
+		// not ctx, as whoever started the run may leave before others waiting on it
+		runCtx, cancel := context.WithCancel(context.Background())
+		flight = &queryFlight{done: make(chan struct{}), cancel: cancel, waiters: 1}
+		f.flights[key] = flight
+
+		go func() {
+			flight.results, flight.err = run(runCtx)
+			f.mu.Lock()
+			if f.flights[key] == flight {
+				delete(f.flights, key)
+			}
+			f.mu.Unlock()
+			cancel()
+			close(flight.done)
+		}()
+	}
+	f.mu.Unlock()
+
+	select {
+	case <-flight.done:
+	case <-ctx.Done():
+		f.mu.Lock()
+		flight.waiters--
+		last := flight.waiters == 0
+		if last {
+			flight.cancel()
+			// callers from now on start a run of their own
+			if f.flights[key] == flight {
+				delete(f.flights, key)
+			}
+		}
+		f.mu.Unlock()
+		if !last {
+			return nil, ctx.Err()
+		}
+		<-flight.done
+	}
+
+	// callers may sort or append to their results, the certificates themselves are shared
+	return append([]result(nil), flight.results...), flight.err
+}
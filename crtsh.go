@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/simplylib/multierror"
+)
+
+const (
+	// resultColumns are selected by every query returning certificates, in the order scanned by queryCertificates
+	// first_seen is the earliest CT log entry of the certificate, NotBefore may be backdated
+	resultColumns = "SELECT certificate_id, issuer_ca_id, certificate, (SELECT MIN(cle.entry_timestamp) FROM ct_log_entry cle WHERE cle.certificate_id = certificate_and_identities.certificate_id) AS first_seen FROM certificate_and_identities"
+
+	patternsQuery = resultColumns + " WHERE name_value LIKE ANY($1) AND NOT name_value LIKE ANY($2) ORDER BY certificate_id DESC LIMIT $3;"
+	namesQuery    = resultColumns + " WHERE name_value = ANY($1) ORDER BY certificate_id DESC LIMIT $2;"
+	digestQuery   = "SELECT id FROM certificate WHERE digest(certificate, 'sha256') = $1;"
+
+	// patternsPageQuery continues patternsQuery below the certificate_id of the previous page
+	patternsPageQuery = resultColumns + " WHERE name_value LIKE ANY($1) AND NOT name_value LIKE ANY($2) AND certificate_id < $3 ORDER BY certificate_id DESC LIMIT $4;"
+	// patternsCountQuery counts the certificates patternsQuery would return without a limit
+	patternsCountQuery = "SELECT COUNT(DISTINCT certificate_id) FROM certificate_and_identities WHERE name_value LIKE ANY($1) AND NOT name_value LIKE ANY($2);"
+	// patternsEstimateQuery has postgres estimate the rows of patternsQuery without a limit, without running it
+	patternsEstimateQuery = "EXPLAIN SELECT certificate_id FROM certificate_and_identities WHERE name_value LIKE ANY($1) AND NOT name_value LIKE ANY($2);"
+)
+
+// planRows is the row estimate of a line of EXPLAIN output (ex: Seq Scan on ... (cost=0.00..1.00 rows=42 width=8))
+var planRows = regexp.MustCompile(`rows=([0-9]+)`)
+
+var errNoEstimate = errors.New("could not find a row estimate in the query plan")
+
+// result is a certificate found on crt.sh
+type result struct {
+	// id of the certificate on crt.sh, 0 when unknown
+	id int64
+	// issuerCAID of the issuing CA in crt.sh's ca table, 0 when unknown
+	issuerCAID int64
+	// firstSeen is when the certificate was first logged to CT, zero when unknown
+	firstSeen time.Time
+	// der of the certificate, parsed on first use by parse and shared by copies of the result
+	der    []byte
+	parsed *lazyCertificate
+}
+
+// lazyCertificate is a certificate parsed once, when first needed, and its summary
+type lazyCertificate struct {
+	once sync.Once
+	cert *x509.Certificate
+	err  error
+
+	infoOnce sync.Once
+	info     certificateInfo
+}
+
+// newResult of the certificate der, parsed when first needed
+func newResult(id, issuerCAID int64, der []byte) result {
+	return result{id: id, issuerCAID: issuerCAID, der: der, parsed: &lazyCertificate{}}
+}
+
+// parse the certificate of r the first time it is needed, a failure is returned on every call
+func (r result) parse() (*x509.Certificate, error) {
+	r.parsed.once.Do(func() {
+		r.parsed.cert, r.parsed.err = x509.ParseCertificate(r.der)
+	})
+	if r.parsed.err != nil {
+		return nil, &parseError{id: r.id, der: r.der, err: r.parsed.err}
+	}
+
+	return r.parsed.cert, nil
+}
+
+// cert of r, nil if it can't be parsed, results returned by the get functions always parse
+func (r result) cert() *x509.Certificate {
+	cert, _ := r.parse()
+	return cert
+}
+
+// fingerprint of r, the SHA-256 of its DER, without parsing it
+func (r result) fingerprint() [sha256.Size]byte {
+	return sha256.Sum256(r.der)
+}
+
+// parsed results of a query, parsing each so a certificate that can't be parsed fails the query as
+// callers expect every certificate, err is returned unless parsing failed
+func parsed(results []result, err error) ([]result, error) {
+	for _, r := range results {
+		if _, perr := r.parse(); perr != nil {
+			return nil, perr
+		}
+	}
+
+	return results, err
+}
+
+// info summarizing the result
+func (r result) info() certificateInfo {
+	// summarizing decodes every extension, do it once however often results are printed
+	r.parsed.infoOnce.Do(func() {
+		r.parsed.info = newCertificateInfo(r.cert())
+	})
+
+	info := r.parsed.info
+	info.ID = r.id
+	info.IssuerCAID = r.issuerCAID
+	if !r.firstSeen.IsZero() {
+		firstSeen := r.firstSeen
+		info.FirstSeen = &firstSeen
+	}
+
+	return info
+}
+
+// certificatesOf results in order
+func certificatesOf(results []result) []*x509.Certificate {
+	certs := make([]*x509.Certificate, 0, len(results))
+	for _, r := range results {
+		certs = append(certs, r.cert())
+	}
+
+	return certs
+}
+
+var (
+	errNotLogged = errors.New("certificate not found in crt.sh")
+	errNoResults = errors.New("crt.sh returned no certificates")
+)
+
+// queryError is a query to crt.sh that failed, retryable when it failed on the connection or the state
+// of the server rather than because of the query
+type queryError struct {
+	retryable bool
+	err       error
+}
+
+func (e *queryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *queryError) Unwrap() error {
+	return e.err
+}
+
+// parseError is a certificate returned by crt.sh that could not be parsed
+type parseError struct {
+	id  int64
+	der []byte
+	err error
+}
+
+func (e *parseError) Error() string {
+	return fmt.Sprintf("could not parse x509 certificate of crt.sh ID (%v) (%v)", e.id, e.err)
+}
+
+func (e *parseError) Unwrap() error {
+	return e.err
+}
+
+// getCertificates with an identity LIKE domainName, newest first
+func getCertificates(ctx context.Context, domainName string, limit int) ([]result, error) {
+	return parsed(searchCertificates(ctx, certificateSearch{Domain: domainName, Limit: limit}))
+}
+
+// getCertificatesByNames that have any of names as an identity, newest first
+func getCertificatesByNames(ctx context.Context, names []string, limit int) ([]result, error) {
+	return parsed(queryCertificates(ctx, namesQuery, pq.Array(names), limit))
+}
+
+// derSlabSize is the size of the blocks derSlab copies certificates into, a few dozen each
+const derSlabSize = 64 << 10
+
+// derSlab copies certificates out of the driver's buffer into shared blocks, one allocation for many
+// certificates instead of one each
+type derSlab struct {
+	block []byte
+}
+
+// copy of der, which may be reused by the driver once the next row is scanned
+func (s *derSlab) copy(der []byte) []byte {
+	if len(der) > derSlabSize/4 {
+		return append([]byte(nil), der...)
+	}
+	if len(der) > cap(s.block)-len(s.block) {
+		s.block = make([]byte, 0, derSlabSize)
+	}
+
+	start := len(s.block)
+	s.block = append(s.block, der...)
+
+	// capped so appending to one certificate can't overwrite the next
+	return s.block[start:len(s.block):len(s.block)]
+}
+
+// queryCertificates runs query on crt.sh returning a result for each row, parsed when first needed,
+// sharing the results of an identical query already running
+func queryCertificates(ctx context.Context, query string, args ...any) ([]result, error) {
+	return crtshFlights.do(ctx, flightKey(query, args), func(ctx context.Context) ([]result, error) {
+		return sendCertificateQuery(ctx, query, args...)
+	})
+}
+
+// sendCertificateQuery to crt.sh, the uncoalesced queryCertificates
+func sendCertificateQuery(ctx context.Context, query string, args ...any) (results []result, err error) {
+	err = crtshMirrors.withDB(ctx, func(db *sql.DB) (err error) {
+		// a failed attempt may have scanned rows before failing over
+		results = nil
+
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("could not execute SQL on postgres for finding certificates (%w)", err)
+		}
+		defer func() {
+			err = multierror.Append(err, rows.Close())
+		}()
+
+		var (
+			id, caID  int64
+			der       sql.RawBytes
+			firstSeen sql.NullTime
+			slab      derSlab
+		)
+		for rows.Next() {
+			// the driver only notices cancellation between network reads, stop before scanning another row
+			if err = ctx.Err(); err != nil {
+				return fmt.Errorf("stopped scanning after (%v) certificates (%w)", len(results), err)
+			}
+
+			err = rows.Scan(&id, &caID, &der, &firstSeen)
+			if err != nil {
+				return fmt.Errorf("could not scan row (%w)", err)
+			}
+			if err = crtshUsage.row(len(der)); err != nil {
+				return err
+			}
+
+			// parsing is left to the first use, callers only needing fingerprints skip it
+			r := newResult(id, caID, slab.copy(der))
+			if firstSeen.Valid {
+				r.firstSeen = firstSeen.Time.UTC()
+			}
+			results = append(results, r)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		// the certificates scanned before cancellation are still returned
+		if ctx.Err() != nil {
+			return results, err
+		}
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// countRows returned by a query selecting a single count
+func countRows(ctx context.Context, query string, args ...any) (count int64, err error) {
+	err = crtshMirrors.withDB(ctx, func(db *sql.DB) error {
+		if err := db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+			return fmt.Errorf("could not execute SQL on postgres for counting certificates (%w)", err)
+		}
+		return crtshUsage.row(8)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// explainQuery returning the lines of postgres' plan for it
+func explainQuery(ctx context.Context, query string, args ...any) (plan []string, err error) {
+	err = crtshMirrors.withDB(ctx, func(db *sql.DB) (err error) {
+		plan = nil
+
+		rows, err := db.QueryContext(ctx, "EXPLAIN "+query, args...)
+		if err != nil {
+			return fmt.Errorf("could not execute SQL on postgres for explaining query (%w)", err)
+		}
+		defer func() {
+			err = multierror.Append(err, rows.Close())
+		}()
+
+		for rows.Next() {
+			if err = ctx.Err(); err != nil {
+				return fmt.Errorf("stopped scanning after (%v) lines (%w)", len(plan), err)
+			}
+
+			var line string
+			if err = rows.Scan(&line); err != nil {
+				return fmt.Errorf("could not scan row (%w)", err)
+			}
+			if err = crtshUsage.row(len(line)); err != nil {
+				return err
+			}
+			plan = append(plan, line)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// estimateRows query would return using the estimate of the top node of its EXPLAIN plan
+func estimateRows(ctx context.Context, query string, args ...any) (rows int64, err error) {
+	// the first line of the plan is its top node
+	var plan string
+	err = crtshMirrors.withDB(ctx, func(db *sql.DB) error {
+		if err := db.QueryRowContext(ctx, query, args...).Scan(&plan); err != nil {
+			return fmt.Errorf("could not execute SQL on postgres for estimating rows (%w)", err)
+		}
+		return crtshUsage.row(len(plan))
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	m := planRows.FindStringSubmatch(plan)
+	if m == nil {
+		return 0, fmt.Errorf("%w (%v)", errNoEstimate, plan)
+	}
+
+	return strconv.ParseInt(m[1], 10, 64)
+}
+
+// getCertificateID on crt.sh of the certificate with the sha256 digest of its der
+func getCertificateID(ctx context.Context, sha256 []byte) (id int64, err error) {
+	err = crtshMirrors.withDB(ctx, func(db *sql.DB) error {
+		err := db.QueryRowContext(ctx, digestQuery, sha256).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			// not being logged is an answer, not a failed query
+			id = 0
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not execute SQL on postgres for finding certificate (%w)", err)
+		}
+		return crtshUsage.row(8)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if id == 0 {
+		return 0, errNotLogged
+	}
+
+	return id, nil
+}
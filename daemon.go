@@ -0,0 +1,814 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const defaultMonitorLimit = 100
+
+var (
+	errExpectedConfig   = errors.New("expected -config file")
+	errNoMonitors       = errors.New("config has no monitors")
+	errMonitorName      = errors.New("monitor needs a unique name")
+	errProjectName      = errors.New("project needs a unique name")
+	errMonitorSchedule  = errors.New("monitor needs a schedule")
+	errDaemonSplunkAuth = errors.New("splunk_url requires splunk_token or $SPLUNK_HEC_TOKEN")
+)
+
+// daemonConfig is the JSON configuration file of findcert daemon
+type daemonConfig struct {
+	PIDFile string `json:"pid_file"`
+	// HealthAddr is where /healthz and the dashboard are served
+	HealthAddr string `json:"health_addr"`
+	// History is the file every observed certificate is appended to, see findcert history, or a
+	// sqlite://, bolt:// or postgres:// URL of a stateBackend
+	History string `json:"history"`
+	// EventLedger records the events sent, so a restart doesn't send them twice
+	EventLedger string `json:"event_ledger"`
+	// StateFile keeps what monitors have seen across restarts and the suppressions of findcert ack,
+	// a file or a sqlite://, bolt:// or postgres:// URL of a stateBackend
+	StateFile string `json:"state_file"`
+	// AckTokens may acknowledge and snooze certificates at /acks of health_addr, which needs state_file
+	AckTokens []apiToken `json:"ack_tokens"`
+	// AdminTokens may view the monitors of every project on the dashboard at /, the read API at
+	// /api/v1/ and /grafana/ and the metrics at /metrics of health_addr, without them those are open
+	// and the first three only show the monitors outside projects
+	AdminTokens []apiToken `json:"admin_tokens"`
+	// SplunkURL and SplunkToken are where monitors without notify send every new certificate
+	SplunkURL   string `json:"splunk_url"`
+	SplunkToken string `json:"splunk_token"`
+	// PluginDir holds executables registered as notifier types, see registerNotifierPlugins
+	PluginDir string                    `json:"plugin_dir"`
+	Notifiers map[string]notifierConfig `json:"notifiers"`
+	Monitors  []monitorConfig           `json:"monitors"`
+	// Projects separate the monitors of teams sharing a daemon
+	Projects []projectConfig `json:"projects"`
+}
+
+// projectConfig is a team's monitors and notifiers, viewed on their own under /projects/<name>/
+// of health_addr by the holders of its API tokens
+type projectConfig struct {
+	Name string `json:"name"`
+	// Tokens that may view the project, anyone may when there are none
+	Tokens []apiToken `json:"tokens"`
+	// Notifiers of the project, its monitors may also notify the daemon's notifiers
+	Notifiers map[string]notifierConfig `json:"notifiers"`
+	Monitors  []monitorConfig           `json:"monitors"`
+}
+
+// monitorConfig is a set of domains polled on a schedule, fields match the flags of findcert watch
+type monitorConfig struct {
+	Name     string   `json:"name"`
+	Patterns []string `json:"patterns"`
+	Keywords []string `json:"keywords"`
+	Exclude  []string `json:"exclude"`
+	Schedule string   `json:"schedule"`
+	Limit    int      `json:"limit"`
+	EKU      string   `json:"eku"`
+	KeyUsage string   `json:"key_usage"`
+	// Notify routes the new certificates of this monitor to notifiers by severity
+	Notify []monitorNotify `json:"notify"`
+	// RenewCommand is run for each name whose newest certificate expires within RenewBefore, see newRenewHook
+	RenewCommand string `json:"renew_command"`
+	RenewBefore  string `json:"renew_before"`
+	// Initial is baseline to silently record the certificates already logged when the monitor first
+	// polls, the default, or alert to alert on all of them
+	Initial string `json:"initial"`
+	// Policy grades new certificates by their CA and whether they renew names already seen
+	Policy *alertPolicy `json:"policy"`
+}
+
+// monitorNotify sends a monitor's new certificates of at least MinSeverity to a notifier
+type monitorNotify struct {
+	Notifier    string   `json:"notifier"`
+	MinSeverity severity `json:"min_severity"`
+}
+
+// readDaemonConfig from path and build its monitors
+func readDaemonConfig(path string) (daemonConfig, []*monitor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return daemonConfig{}, nil, fmt.Errorf("could not read config (%w)", err)
+	}
+
+	var cfg daemonConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&cfg); err != nil {
+		return daemonConfig{}, nil, fmt.Errorf("could not decode config (%v) (%w)", path, err)
+	}
+
+	total := len(cfg.Monitors)
+	for _, pc := range cfg.Projects {
+		total += len(pc.Monitors)
+	}
+	if total == 0 {
+		return daemonConfig{}, nil, errNoMonitors
+	}
+
+	if cfg.SplunkURL != "" && cfg.splunkToken() == "" {
+		return daemonConfig{}, nil, errDaemonSplunkAuth
+	}
+
+	if cfg.PluginDir != "" {
+		if err = registerNotifierPlugins(cfg.PluginDir); err != nil {
+			return daemonConfig{}, nil, err
+		}
+	}
+
+	monitors, err := cfg.monitors()
+	if err != nil {
+		return daemonConfig{}, nil, err
+	}
+
+	return cfg, monitors, nil
+}
+
+// splunkToken of the config, or else $SPLUNK_HEC_TOKEN
+func (cfg daemonConfig) splunkToken() string {
+	if cfg.SplunkToken != "" {
+		return cfg.SplunkToken
+	}
+
+	return os.Getenv("SPLUNK_HEC_TOKEN")
+}
+
+// monitors of the config, new ones with their own sinks each time
+func (cfg daemonConfig) monitors() ([]*monitor, error) {
+	token := cfg.splunkToken()
+	digests := make(map[string]*digestSink)
+	monitors, err := buildMonitors(cfg, "", cfg.Monitors, nil, token, digests)
+	if err != nil {
+		return nil, err
+	}
+
+	projects := make(map[string]struct{}, len(cfg.Projects))
+	for _, pc := range cfg.Projects {
+		if _, ok := projects[pc.Name]; ok || pc.Name == "" || strings.ContainsAny(pc.Name, "/"+allProjects) {
+			return nil, fmt.Errorf("%w (%v)", errProjectName, pc.Name)
+		}
+		projects[pc.Name] = struct{}{}
+
+		projectMonitors, err := buildMonitors(cfg, pc.Name, pc.Monitors, pc.Notifiers, token, digests)
+		if err != nil {
+			return nil, fmt.Errorf("could not configure project (%v) (%w)", pc.Name, err)
+		}
+		monitors = append(monitors, projectMonitors...)
+	}
+
+	return monitors, nil
+}
+
+// buildMonitors of project from configs, notifying the project's notifiers or else the daemon's, the
+// digests of notifiers shared through digests by project and name
+func buildMonitors(cfg daemonConfig, project string, configs []monitorConfig, notifiers map[string]notifierConfig, splunkToken string, digests map[string]*digestSink) ([]*monitor, error) {
+	var (
+		monitors []*monitor
+		names    = make(map[string]struct{}, len(configs))
+	)
+	for _, mc := range configs {
+		if _, ok := names[mc.Name]; ok || mc.Name == "" {
+			return nil, fmt.Errorf("%w (%v)", errMonitorName, mc.Name)
+		}
+		names[mc.Name] = struct{}{}
+
+		m, err := newMonitor(mc)
+		if err != nil {
+			return nil, fmt.Errorf("could not configure monitor (%v) (%w)", mc.Name, err)
+		}
+		m.project = project
+
+		// sinks may batch events so each monitor needs its own, but a digest summarizes every
+		// monitor notifying it so they share one
+		for _, n := range mc.Notify {
+			key := "/" + n.Notifier
+			nc, ok := notifiers[n.Notifier]
+			if ok {
+				key = project + key
+			} else {
+				nc, ok = cfg.Notifiers[n.Notifier]
+			}
+			if !ok {
+				return nil, fmt.Errorf("%w (%v) in monitor (%v)", errUndefinedNotifier, n.Notifier, mc.Name)
+			}
+
+			var sink eventSink
+			if digest, ok := digests[key]; ok {
+				sink = digest
+			} else {
+				if sink, err = newEventSink(nc); err != nil {
+					return nil, fmt.Errorf("could not configure notifier (%v) (%w)", n.Notifier, err)
+				}
+				if digest, ok := sink.(*digestSink); ok {
+					digests[key] = digest
+				}
+			}
+			m.watcher.routes = append(m.watcher.routes, notifyRoute{name: n.Notifier, sink: sink, minSeverity: n.MinSeverity})
+		}
+		if len(mc.Notify) == 0 && cfg.SplunkURL != "" {
+			m.watcher.routes = splunkRoutes(newSplunkSink(cfg.SplunkURL, splunkToken))
+		}
+
+		monitors = append(monitors, m)
+	}
+
+	return monitors, nil
+}
+
+// monitor polls crt.sh for the certificates of a monitorConfig on its schedule
+type monitor struct {
+	// project the monitor belongs to, "" for the daemon's own monitors
+	project  string
+	config   monitorConfig
+	schedule schedule
+	watcher  *watcher
+	// renew, if set, runs for names nearing expiry after each poll
+	renew *renewHook
+
+	mu       sync.Mutex
+	lastPoll time.Time
+	lastErr  error
+	nextPoll time.Time
+	seen     int
+	// latest certificates found by the last successful poll
+	latest []result
+	// state of the watcher after the last successful poll, nil before it
+	state *watcherState
+}
+
+// newMonitor from its config
+func newMonitor(mc monitorConfig) (*monitor, error) {
+	if mc.Schedule == "" {
+		return nil, errMonitorSchedule
+	}
+	sched, err := parseSchedule(mc.Schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	patterns, err := newPatternSet(mc.Patterns, mc.Keywords, mc.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	purpose, err := newPurposeFilter(mc.EKU, mc.KeyUsage)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := mc.Limit
+	if limit <= 0 {
+		limit = defaultMonitorLimit
+	}
+
+	m := &monitor{config: mc, schedule: sched}
+	if mc.RenewCommand != "" {
+		if m.renew, err = newRenewHook(mc.RenewCommand, mc.RenewBefore); err != nil {
+			return nil, err
+		}
+	}
+	m.watcher = newWatcher(patterns.String(), limit, nil, func(ctx context.Context) ([]result, error) {
+		results, err := getCertificatesByPatterns(ctx, patterns, limit)
+		if err != nil {
+			return nil, err
+		}
+		results = purpose.apply(results)
+
+		m.mu.Lock()
+		m.latest = results
+		m.mu.Unlock()
+
+		if m.renew != nil {
+			m.renew.check(ctx, results, time.Now())
+		}
+
+		return results, nil
+	})
+	m.watcher.source = "daemon"
+	m.watcher.policy = mc.Policy
+	if m.watcher.baseline, err = alertsExisting(mc.Initial); err != nil {
+		return nil, err
+	}
+	m.watcher.save = func(s watcherState) {
+		m.mu.Lock()
+		m.state = &s
+		m.mu.Unlock()
+	}
+
+	return m, nil
+}
+
+// run polls once to record a baseline, or alert on what is already logged, then on schedule until
+// ctx is done
+func (m *monitor) run(ctx context.Context) {
+	m.poll(ctx)
+
+	for {
+		next := m.schedule.next(time.Now())
+		m.mu.Lock()
+		m.nextPoll = next
+		m.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		m.poll(ctx)
+	}
+}
+
+func (m *monitor) poll(ctx context.Context) {
+	err := m.watcher.poll(ctx)
+	if err != nil && ctx.Err() == nil {
+		// crt.sh is regularly overloaded, keep to the schedule and try again next time
+		log.Printf("monitor (%v) could not poll crt.sh (%v)\n", m.label(), err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastPoll = time.Now()
+	m.lastErr = err
+	m.seen = len(m.watcher.seen)
+}
+
+// monitorStatus of a monitor reported by the health endpoint
+type monitorStatus struct {
+	Project          string    `json:"project,omitempty"`
+	Name             string    `json:"name"`
+	Query            string    `json:"query"`
+	Schedule         string    `json:"schedule"`
+	LastPoll         time.Time `json:"last_poll,omitempty"`
+	LastError        string    `json:"last_error,omitempty"`
+	NextPoll         time.Time `json:"next_poll,omitempty"`
+	CertificatesSeen int       `json:"certificates_seen"`
+}
+
+func (m *monitor) status() monitorStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := monitorStatus{
+		Project:          m.project,
+		Name:             m.config.Name,
+		Query:            m.watcher.query,
+		Schedule:         m.config.Schedule,
+		LastPoll:         m.lastPoll,
+		NextPoll:         m.nextPoll,
+		CertificatesSeen: m.seen,
+	}
+	if m.lastErr != nil {
+		s.LastError = m.lastErr.Error()
+	}
+
+	return s
+}
+
+// daemon runs the monitors of a config file, replacing them when it is reloaded
+type daemon struct {
+	started time.Time
+	history *historyStore
+	ledger  *eventLedger
+	alerts  *alertLog
+	// statePath, if set, is where state and suppressions are kept, state as last read for the
+	// monitors started
+	statePath string
+	state     watchState
+
+	mu       sync.Mutex
+	loaded   time.Time
+	monitors []*monitor
+	// projects by name, with who may view them
+	projects map[string]*tokenAuth
+}
+
+// saveState of every monitor that has polled to statePath
+func (d *daemon) saveState() {
+	if d.statePath == "" {
+		return
+	}
+
+	d.mu.Lock()
+	states := make(map[string]watcherState, len(d.monitors))
+	for _, m := range d.monitors {
+		m.mu.Lock()
+		if m.state != nil {
+			states[m.key()] = *m.state
+		}
+		m.mu.Unlock()
+	}
+	d.mu.Unlock()
+
+	// watchers of monitors no longer configured are kept in case they come back
+	err := updateWatchState(d.statePath, func(state *watchState) {
+		for key, s := range states {
+			state.Watchers[key] = s
+		}
+	})
+	if err != nil {
+		log.Printf("could not save state (%v)\n", err)
+	}
+}
+
+// flushDigests of the stopped monitors' notifiers without waiting for their period, so what they
+// hold isn't lost, settling the certificates in them
+func (d *daemon) flushDigests() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	flushed := make(map[*digestSink]struct{})
+	for _, m := range d.monitors {
+		for _, route := range m.watcher.routes {
+			digest, ok := route.sink.(*digestSink)
+			if !ok {
+				continue
+			}
+			if _, ok = flushed[digest]; ok {
+				continue
+			}
+			flushed[digest] = struct{}{}
+
+			if err := digest.flushNow(ctx); err != nil {
+				log.Printf("could not send digest to (%v) (%v)\n", route.name, err)
+			}
+		}
+	}
+
+	for _, m := range d.monitors {
+		m.watcher.settle()
+	}
+}
+
+// key of the monitor, unique across projects
+func (m *monitor) key() string {
+	return m.project + "/" + m.config.Name
+}
+
+// label of the monitor in logs, its name prefixed by its project
+func (m *monitor) label() string {
+	return monitorLabel(m.project, m.config.Name)
+}
+
+// healthResponse is the JSON body returned by /healthz
+type healthResponse struct {
+	Status   string          `json:"status"`
+	Started  time.Time       `json:"started"`
+	Loaded   time.Time       `json:"config_loaded"`
+	Monitors []monitorStatus `json:"monitors"`
+	Mirrors  []mirrorStatus  `json:"crtsh_hosts"`
+}
+
+// allProjects views the monitors of every project, "" views those outside projects
+const allProjects = "*"
+
+// health of the daemon, degraded while any monitor's last poll failed
+func (d *daemon) health() healthResponse {
+	return d.projectHealth(allProjects)
+}
+
+// projectMonitors of project, every monitor for allProjects
+func (d *daemon) projectMonitors(project string) []*monitor {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var monitors []*monitor
+	for _, m := range d.monitors {
+		if project == allProjects || m.project == project {
+			monitors = append(monitors, m)
+		}
+	}
+
+	return monitors
+}
+
+// projectHealth of the monitors of project, of the whole daemon for allProjects
+func (d *daemon) projectHealth(project string) healthResponse {
+	monitors := d.projectMonitors(project)
+
+	d.mu.Lock()
+	resp := healthResponse{
+		Status:   "ok",
+		Started:  d.started,
+		Loaded:   d.loaded,
+		Monitors: make([]monitorStatus, 0, len(monitors)),
+		Mirrors:  crtshMirrors.status(),
+	}
+	d.mu.Unlock()
+
+	for _, m := range monitors {
+		resp.Monitors = append(resp.Monitors, m.status())
+	}
+
+	for _, s := range resp.Monitors {
+		if s.LastError != "" {
+			resp.Status = "degraded"
+		}
+	}
+
+	return resp
+}
+
+// summary of the daemon's health on one line for service managers
+func (d *daemon) summary() string {
+	h := d.health()
+
+	var failing int
+	for _, s := range h.Monitors {
+		if s.LastError != "" {
+			failing++
+		}
+	}
+
+	return fmt.Sprintf("%v: %v monitors, %v failing their last poll", h.Status, len(h.Monitors), failing)
+}
+
+// ServeHTTP /healthz with the status of the whole daemon, listing only the monitors outside projects
+// as anyone may reach it
+func (d *daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp := d.projectHealth("")
+	resp.Status = d.health().Status
+
+	// crt.sh being unavailable is not a reason to restart the daemon, so degraded is still a 200
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// start monitors with ctx, taking over the watchers of running monitors with the same name and query
+// so a reload does not report already seen certificates as new
+func (d *daemon) start(ctx context.Context, wg *sync.WaitGroup, monitors []*monitor, projects []projectConfig) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	previous := make(map[string]*monitor, len(d.monitors))
+	for _, m := range d.monitors {
+		previous[m.key()] = m
+	}
+
+	// a monitor this daemon didn't run, as of a shard taken over, restores what its daemon last saved
+	if !d.loaded.IsZero() && d.statePath != "" {
+		for _, m := range monitors {
+			if old, ok := previous[m.key()]; ok && old.watcher.query == m.watcher.query {
+				continue
+			}
+			state, err := readWatchState(d.statePath)
+			if err != nil {
+				log.Printf("could not reread state, restoring monitors as of the last read (%v)\n", err)
+				break
+			}
+			d.state = state
+			break
+		}
+	}
+
+	for _, m := range monitors {
+		m.watcher.history = d.history
+		m.watcher.ledger = d.ledger
+		if d.statePath != "" {
+			m.watcher.suppressions = stateSuppressions(d.statePath)
+		}
+		m.watcher.routes = append(m.watcher.routes, notifyRoute{name: "dashboard", sink: projectAlerts{project: m.project, log: d.alerts}})
+		if old, ok := previous[m.key()]; ok && old.watcher.query == m.watcher.query {
+			w := old.watcher
+			w.fetch = m.watcher.fetch
+			w.setRoutes(m.watcher.routes)
+			w.save = m.watcher.save
+			w.suppressions = m.watcher.suppressions
+			w.policy = m.watcher.policy
+			m.watcher = w
+
+			// the old monitor has stopped, so names it renewed aren't renewed twice
+			if m.renew != nil && old.renew != nil {
+				m.renew.renewed = old.renew.renewed
+			}
+		} else if s, ok := d.state.Watchers[m.key()]; ok && s.Query == m.watcher.query {
+			m.watcher.restore(s)
+		}
+
+		wg.Add(1)
+		go func(m *monitor) {
+			defer wg.Done()
+			m.run(ctx)
+		}(m)
+	}
+
+	d.monitors = monitors
+	d.projects = make(map[string]*tokenAuth, len(projects))
+	for _, pc := range projects {
+		d.projects[pc.Name] = &tokenAuth{tokens: pc.Tokens, buckets: make(map[string]*tokenBucket)}
+	}
+	d.loaded = time.Now()
+}
+
+func runDaemon(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	configPath := fs.String("config", "", "JSON config file of the monitors to run, reloaded on SIGHUP")
+	fs.BoolVar(&replayEvents, "replay", false, "send events again even if the event_ledger has them")
+	fs.Var(&daemonShard, "shard", "run only this shard of the monitors as index/count (ex: 2/3), for daemons sharing a config and a postgres:// state_file to split them, each leasing its shard and taking over those of stopped daemons ($FINDCERT_SHARD sets the default)")
+	parseFlags(fs, args)
+
+	if *configPath == "" {
+		return errExpectedConfig
+	}
+
+	return runDaemonConfig(ctx, *configPath)
+}
+
+// runDaemonConfig in the foreground reloading on SIGHUP, notifying systemd when started by it
+func runDaemonConfig(ctx context.Context, configPath string) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	return serveDaemon(ctx, configPath, hup, newSystemdNotifier())
+}
+
+// serveDaemon runs the monitors of the config at configPath until ctx is done, reloading it on
+// each signal from reload and telling notifier of its state
+func serveDaemon(ctx context.Context, configPath string, reload <-chan os.Signal, notifier serviceNotifier) error {
+	cfg, all, err := readDaemonConfig(configPath)
+	if err != nil {
+		return err
+	}
+	// rebuild the monitors of the running config, when the shards leased change
+	rebuild := cfg.monitors
+
+	leases, err := leaseShards(cfg.StateFile, daemonShard)
+	if err != nil {
+		return err
+	}
+	var leaseTick <-chan time.Time
+	if leases != nil {
+		defer leases.Close()
+		if _, err = leases.renew(ctx); err != nil {
+			log.Printf("could not lease shards, retrying in (%v) (%v)\n", shardLeaseInterval, err)
+		}
+
+		leaseTicker := time.NewTicker(shardLeaseInterval)
+		defer leaseTicker.Stop()
+		leaseTick = leaseTicker.C
+	}
+	monitors := leases.monitors(all)
+	switch {
+	case leases != nil:
+		log.Printf("running shards (%v) of the monitors, (%v) of (%v)\n", leases.String(), len(monitors), len(all))
+	case daemonShard.count > 0:
+		log.Printf("running shard (%v) of the monitors, (%v) of (%v)\n", daemonShard.String(), len(monitors), len(all))
+	}
+
+	if cfg.PIDFile != "" {
+		if err = os.WriteFile(cfg.PIDFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+			return fmt.Errorf("could not write PID file (%w)", err)
+		}
+		defer func() {
+			if err := os.Remove(cfg.PIDFile); err != nil {
+				log.Printf("could not remove PID file (%v)\n", err)
+			}
+		}()
+	}
+
+	d := &daemon{started: time.Now(), alerts: newAlertLog(defaultAlertLogSize), statePath: cfg.StateFile}
+	if d.state, err = readWatchState(cfg.StateFile); err != nil && cfg.StateFile != "" {
+		return err
+	}
+
+	if cfg.History != "" {
+		if d.history, err = openHistory(cfg.History); err != nil {
+			return err
+		}
+		defer d.history.Close()
+	}
+
+	if cfg.EventLedger != "" {
+		if d.ledger, err = openEventLedger(cfg.EventLedger, replayEvents); err != nil {
+			return err
+		}
+		defer d.ledger.Close()
+	}
+
+	if cfg.HealthAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/healthz", d)
+		// without admin tokens anyone may view the monitors outside projects, as they may a project without tokens
+		if len(cfg.AdminTokens) > 0 {
+			admin := &tokenAuth{tokens: cfg.AdminTokens, buckets: make(map[string]*tokenBucket)}
+			// metrics describe the whole daemon, so only admins may see them
+			mux.Handle("/metrics", admin.require(false, metricsHandler{}))
+			mux.Handle("/", admin.require(false, dashboardHandler{d: d, project: allProjects}))
+			mux.Handle("/api/v1/", admin.require(false, readAPIHandler{d: d, project: allProjects}))
+			mux.Handle("/grafana/", admin.require(false, readAPIHandler{d: d, project: allProjects}))
+		} else {
+			mux.Handle("/metrics", metricsHandler{})
+			mux.Handle("/", dashboardHandler{d: d})
+			mux.Handle("/api/v1/", readAPIHandler{d: d})
+			mux.Handle("/grafana/", readAPIHandler{d: d})
+		}
+		mux.Handle("/projects/", projectsHandler{d: d})
+		if len(cfg.AckTokens) > 0 && cfg.StateFile != "" {
+			auth := &tokenAuth{tokens: cfg.AckTokens, buckets: make(map[string]*tokenBucket)}
+			mux.Handle("/acks", auth.require(false, ackHandler{statePath: cfg.StateFile}))
+		}
+
+		srv := &http.Server{
+			Addr:              cfg.HealthAddr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("could not serve health endpoint (%v)\n", err)
+			}
+		}()
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			if err := srv.Shutdown(shutdownCtx); err != nil {
+				log.Printf("could not shutdown health endpoint (%v)\n", err)
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	monitorCtx, cancel := context.WithCancel(ctx)
+	d.start(monitorCtx, &wg, monitors, cfg.Projects)
+	log.Printf("daemon running (%v) monitors from (%v)\n", len(monitors), configPath)
+	notifier.notify(serviceReady, d.summary())
+
+	statusTicker := time.NewTicker(time.Minute)
+	defer statusTicker.Stop()
+
+	projects := cfg.Projects
+	for {
+		select {
+		case <-ctx.Done():
+			notifier.notify(serviceStopping, "")
+			cancel()
+			wg.Wait()
+			d.flushDigests()
+			d.saveState()
+			return nil
+		case <-statusTicker.C:
+			notifier.notify(serviceStatus, d.summary())
+			d.saveState()
+			continue
+		case <-leaseTick:
+			changed, err := leases.renew(ctx)
+			if err != nil {
+				log.Printf("could not renew shard leases, stopping their monitors until they are leased again (%v)\n", err)
+			}
+			if !changed {
+				continue
+			}
+			// the running monitors are stopped below, so those of the shards kept run afresh as on a reload
+			next, err := rebuild()
+			if err != nil {
+				log.Printf("could not rebuild monitors of the shards leased (%v)\n", err)
+				continue
+			}
+			all = next
+			log.Printf("running shards (%v) of the monitors, (%v) of (%v)\n", leases.String(), len(leases.monitors(all)), len(all))
+		case <-reload:
+			reloaded, next, err := readDaemonConfig(configPath)
+			if err != nil {
+				// keep running the previous config rather than stopping monitoring over a typo
+				log.Printf("could not reload config, keeping the running one (%v)\n", err)
+				continue
+			}
+			if reloaded.PIDFile != cfg.PIDFile || reloaded.HealthAddr != cfg.HealthAddr || reloaded.History != cfg.History || reloaded.StateFile != cfg.StateFile || reloaded.EventLedger != cfg.EventLedger {
+				log.Println("pid_file, health_addr, history, state_file and event_ledger only change on restart")
+			}
+			all, rebuild, projects = next, reloaded.monitors, reloaded.Projects
+		}
+		monitors = leases.monitors(all)
+
+		notifier.notify(serviceReloading, "")
+		cancel()
+		wg.Wait()
+		// the new monitors have new sinks, so digests are sent early rather than lost
+		d.flushDigests()
+		d.saveState()
+
+		monitorCtx, cancel = context.WithCancel(ctx)
+		d.start(monitorCtx, &wg, monitors, projects)
+		log.Printf("reloaded (%v) monitors from (%v)\n", len(monitors), configPath)
+		notifier.notify(serviceReady, d.summary())
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDaemonStartTakeover(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	results := benchmarkResults(benchmarkDERs(t, 2))
+	seen, unseen := results[0].fingerprint(), results[1].fingerprint()
+
+	d := &daemon{alerts: newAlertLog(defaultAlertLogSize), statePath: statePath}
+	var err error
+	if d.state, err = readWatchState(statePath); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	d.start(context.Background(), &wg, nil, nil)
+
+	// the daemon of another shard saves its monitor after this one started
+	err = updateWatchState(statePath, func(state *watchState) {
+		state.Watchers["p/m"] = watcherState{Query: "example.com", Seen: []string{hex.EncodeToString(seen[:])}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// this one then takes the monitor over, polling it once
+	ctx, cancel := context.WithCancel(context.Background())
+	sink := &recordingSink{}
+	w := newWatcher("example.com", 10, []notifyRoute{{name: "test", sink: sink}}, func(context.Context) ([]result, error) {
+		cancel()
+		return results, nil
+	})
+	m := &monitor{project: "p", config: monitorConfig{Name: "m"}, schedule: every(time.Hour), watcher: w}
+	d.start(ctx, &wg, []*monitor{m}, nil)
+	wg.Wait()
+
+	// neither re-alerting what the other daemon saw nor baselining what it hadn't
+	if len(sink.flushed) != 1 {
+		t.Fatalf("sent (%v) events, want 1", len(sink.flushed))
+	}
+	e, ok := sink.flushed[0].(certificateEvent)
+	if !ok || e.Certificate.SHA256 != hex.EncodeToString(unseen[:]) {
+		t.Errorf("sent (%+v), want the certificate unseen by the other daemon", sink.flushed[0])
+	}
+}
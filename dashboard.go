@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultAlertLogSize is how many recent alerts the dashboard shows
+const defaultAlertLogSize = 100
+
+//go:embed templates/dashboard.html.tmpl
+var dashboardTemplates embed.FS
+
+var dashboardTemplate = template.Must(template.New("dashboard.html.tmpl").Funcs(template.FuncMap{
+	"date": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 MST") },
+	"join": strings.Join,
+}).ParseFS(dashboardTemplates, "templates/dashboard.html.tmpl"))
+
+// alert is a new certificate reported by a monitor
+type alert struct {
+	At      time.Time
+	Project string
+	Source  string
+	// Name is the certificate's display name, its CommonName may be empty
+	Name string
+	certificateEvent
+}
+
+// alertLog keeps the most recent alerts for the dashboard, it is an eventSink safe for concurrent use
+type alertLog struct {
+	mu     sync.Mutex
+	max    int
+	alerts []alert
+}
+
+func newAlertLog(max int) *alertLog {
+	return &alertLog{max: max}
+}
+
+// Send records event as an alert, dropping the oldest once full
+func (l *alertLog) Send(ctx context.Context, source string, event any) error {
+	return l.add("", source, event)
+}
+
+// add event of project as an alert
+func (l *alertLog) add(project, source string, event any) error {
+	e, ok := event.(certificateEvent)
+	if !ok {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.alerts = append(l.alerts, alert{At: time.Now(), Project: project, Source: source, Name: e.Certificate.displayName(), certificateEvent: e})
+	if len(l.alerts) > l.max {
+		l.alerts = l.alerts[len(l.alerts)-l.max:]
+	}
+
+	return nil
+}
+
+// Flush does nothing as alerts are kept in memory
+func (l *alertLog) Flush(ctx context.Context) error {
+	return nil
+}
+
+// recent alerts of project, newest first, of every project for allProjects
+func (l *alertLog) recent(project string) []alert {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	recent := make([]alert, 0, len(l.alerts))
+	for i := len(l.alerts) - 1; i >= 0; i-- {
+		if project == allProjects || l.alerts[i].Project == project {
+			recent = append(recent, l.alerts[i])
+		}
+	}
+
+	return recent
+}
+
+// projectAlerts records the events of a project's monitors in log, it is an eventSink
+type projectAlerts struct {
+	project string
+	log     *alertLog
+}
+
+func (p projectAlerts) Send(ctx context.Context, source string, event any) error {
+	return p.log.add(p.project, source, event)
+}
+
+func (p projectAlerts) Flush(ctx context.Context) error {
+	return nil
+}
+
+// dashboardMonitor is a monitor with its latest certificates, soonest to expire first
+type dashboardMonitor struct {
+	monitorStatus
+	Certificates []reportCertificate
+}
+
+// dashboardData is passed to the dashboard template
+type dashboardData struct {
+	// Project viewed, "" for the monitors outside projects or every monitor
+	Project     string
+	GeneratedAt time.Time
+	Health      healthResponse
+	Monitors    []dashboardMonitor
+	Alerts      []alert
+}
+
+// dashboardHandler serves GET / with the state of the daemon's monitors of project, those outside
+// projects for "" or every monitor for allProjects to the holders of admin tokens
+type dashboardHandler struct {
+	d       *daemon
+	project string
+}
+
+func (h dashboardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.d.renderDashboard(w, h.project)
+}
+
+// projectsHandler serves GET /projects/<name>/, /projects/<name>/healthz and the read API under
+// /projects/<name>/api/v1/ and /projects/<name>/grafana/, the dashboard, health and read API of only
+// that project's monitors to the holders of its tokens
+type projectsHandler struct {
+	d *daemon
+}
+
+func (h projectsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/projects/"), "/")
+
+	h.d.mu.Lock()
+	auth, ok := h.d.projects[name]
+	h.d.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	var next http.Handler
+	switch rest {
+	case "":
+		next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.d.renderDashboard(w, name)
+		})
+	case "healthz":
+		next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, h.d.projectHealth(name))
+		})
+	default:
+		if !strings.HasPrefix(rest, "api/v1/") && !strings.HasPrefix(rest, "grafana/") {
+			http.NotFound(w, r)
+			return
+		}
+		next = http.StripPrefix("/projects/"+name, readAPIHandler{d: h.d, project: name})
+	}
+
+	if len(auth.tokens) > 0 {
+		next = auth.require(false, next)
+	}
+	next.ServeHTTP(w, r)
+}
+
+// renderDashboard of project to w, of every monitor for allProjects
+func (d *daemon) renderDashboard(w http.ResponseWriter, project string) {
+	now := time.Now()
+	data := dashboardData{
+		Project:     strings.TrimPrefix(project, allProjects),
+		GeneratedAt: now,
+		Health:      d.projectHealth(project),
+		Alerts:      d.alerts.recent(project),
+	}
+
+	for _, m := range d.projectMonitors(project) {
+		m.mu.Lock()
+		latest := m.latest
+		m.mu.Unlock()
+
+		dm := dashboardMonitor{monitorStatus: m.status()}
+		for _, res := range latest {
+			dm.Certificates = append(dm.Certificates, newReportCertificate(res.cert(), now))
+		}
+		sort.SliceStable(dm.Certificates, func(i, j int) bool {
+			return dm.Certificates[i].NotAfter.Before(dm.Certificates[j].NotAfter)
+		})
+
+		data.Monitors = append(data.Monitors, dm)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		log.Printf("could not render dashboard (%v)\n", err)
+	}
+}
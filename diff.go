@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+var errExpectedDiffArguments = errors.New("expected 2 arguments: snapshot file and domain name")
+
+// renewal of a certificate by another covering the same names
+type renewal struct {
+	Old certificateInfo `json:"old"`
+	New certificateInfo `json:"new"`
+}
+
+// snapshotDiff between two sets of certificates
+type snapshotDiff struct {
+	Added   []certificateInfo `json:"added"`
+	Removed []certificateInfo `json:"removed"`
+	Renewed []renewal         `json:"renewed"`
+}
+
+// nameSetKey identifies the set of names a certificate covers regardless of order or case
+func nameSetKey(info certificateInfo) string {
+	names := info.DNSNames
+	if len(names) == 0 {
+		names = []string{info.CommonName}
+	}
+
+	lower := make([]string, len(names))
+	for i, name := range names {
+		lower[i] = strings.ToLower(name)
+	}
+	sort.Strings(lower)
+
+	return strings.Join(lower, ",")
+}
+
+// diffCertificates from old to cur, an added certificate covering the same names as a removed one is a renewal
+func diffCertificates(old []certificateInfo, cur []certificateInfo) snapshotDiff {
+	oldSet := make(map[string]certificateInfo, len(old))
+	for _, info := range old {
+		oldSet[info.SHA256] = info
+	}
+	curSet := make(map[string]certificateInfo, len(cur))
+	for _, info := range cur {
+		curSet[info.SHA256] = info
+	}
+
+	gone := make(map[string][]certificateInfo)
+	for _, info := range old {
+		if _, ok := curSet[info.SHA256]; !ok {
+			key := nameSetKey(info)
+			gone[key] = append(gone[key], info)
+		}
+	}
+
+	var (
+		d       snapshotDiff
+		renewed = make(map[string]struct{})
+	)
+	for _, info := range cur {
+		if _, ok := oldSet[info.SHA256]; ok {
+			continue
+		}
+
+		key := nameSetKey(info)
+		if candidates := gone[key]; len(candidates) > 0 {
+			d.Renewed = append(d.Renewed, renewal{Old: candidates[0], New: info})
+			renewed[candidates[0].SHA256] = struct{}{}
+			gone[key] = candidates[1:]
+			continue
+		}
+
+		d.Added = append(d.Added, info)
+	}
+
+	for _, info := range old {
+		if _, ok := curSet[info.SHA256]; ok {
+			continue
+		}
+		if _, ok := renewed[info.SHA256]; !ok {
+			d.Removed = append(d.Removed, info)
+		}
+	}
+
+	return d
+}
+
+// inWindow is the certificates of old that the current results cur would include, crt.sh returns
+// the newest first so once truncated at the limit, certificates of old older than the oldest of cur
+// have only dropped out of the results rather than been removed, and can't be compared
+func inWindow(old []certificateInfo, cur []certificateInfo, truncated bool) (in []certificateInfo, outside int) {
+	if !truncated || len(cur) == 0 {
+		return old, 0
+	}
+
+	oldest := cur[0].ID
+	for _, info := range cur {
+		if info.ID < oldest {
+			oldest = info.ID
+		}
+	}
+
+	in = make([]certificateInfo, 0, len(old))
+	for _, info := range old {
+		// a certificate without a crt.sh ID can't be placed in the window
+		if info.ID == 0 || info.ID < oldest {
+			outside++
+			continue
+		}
+		in = append(in, info)
+	}
+
+	return in, outside
+}
+
+func runDiff(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	limit := fs.Int("n", 100, "number of latest entries to compare")
+	update := fs.Bool("update", false, "save the current results to the snapshot file after comparing, creating it if missing")
+	output := addOutputFileFlag(fs)
+	parseFlags(fs, args)
+
+	if fs.NArg() != 2 {
+		return errExpectedDiffArguments
+	}
+	path, domain := fs.Arg(0), fs.Arg(1)
+
+	old, err := readSnapshot(path)
+	if err != nil && !(*update && errors.Is(err, os.ErrNotExist)) {
+		return err
+	}
+
+	results, err := getCertificates(ctx, domain, *limit)
+	if err != nil {
+		return fmt.Errorf("could not getCertificates of (%v) error (%w)", domain, err)
+	}
+	// every certificate disappearing is far more likely an outage than real, don't report or save it
+	if len(results) == 0 && len(old.Certificates) > 0 {
+		return fmt.Errorf("%w for (%v), snapshot has (%v)", errNoResults, domain, len(old.Certificates))
+	}
+
+	cur := newSnapshot(domain, results)
+
+	if old.Query != "" && old.Query != domain {
+		log.Printf("warning: snapshot was taken for (%v) not (%v)\n", old.Query, domain)
+	}
+
+	compared, outside := inWindow(old.infos(), cur.infos(), len(results) >= *limit)
+	if outside > 0 {
+		log.Printf("(%v) certificates of the snapshot are older than the latest (%v) results and aren't compared, raise -n to include them\n", outside, *limit)
+	}
+
+	d := diffCertificates(compared, cur.infos())
+	err = writeOutput(*output, func(out io.Writer) error {
+		for _, info := range d.Added {
+			fmt.Fprintf(out, "+ added   CommonName: (%v) Issued On: (%v) SHA-256: (%v)\n", info.CommonName, info.NotBefore, info.SHA256)
+		}
+		for _, r := range d.Renewed {
+			fmt.Fprintf(out, "~ renewed CommonName: (%v) Issued On: (%v) SHA-256: (%v) replaces (%v)\n", r.New.CommonName, r.New.NotBefore, r.New.SHA256, r.Old.SHA256)
+		}
+		for _, info := range d.Removed {
+			fmt.Fprintf(out, "- removed CommonName: (%v) Issued On: (%v) SHA-256: (%v)\n", info.CommonName, info.NotBefore, info.SHA256)
+		}
+		if old.TakenAt.IsZero() {
+			fmt.Fprintf(out, "No previous snapshot: (%v) added\n", len(d.Added))
+		} else {
+			fmt.Fprintf(out, "Since (%v): (%v) added, (%v) renewed, (%v) removed\n", old.TakenAt, len(d.Added), len(d.Renewed), len(d.Removed))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if *update {
+		if err = writeSnapshot(path, cur); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestDiffCertificates(t *testing.T) {
+	a := certificateInfo{ID: 1, SHA256: "a", DNSNames: []string{"example.com"}}
+	renewedA := certificateInfo{ID: 3, SHA256: "a2", DNSNames: []string{"EXAMPLE.com"}}
+	b := certificateInfo{ID: 2, SHA256: "b", DNSNames: []string{"b.example.com"}}
+	c := certificateInfo{ID: 4, SHA256: "c", DNSNames: []string{"c.example.com"}}
+
+	tests := []struct {
+		name                    string
+		old, cur                []certificateInfo
+		added, removed, renewed int
+	}{
+		{name: "unchanged", old: []certificateInfo{a, b}, cur: []certificateInfo{a, b}},
+		{name: "added", old: []certificateInfo{a}, cur: []certificateInfo{c, a}, added: 1},
+		{name: "removed", old: []certificateInfo{a, b}, cur: []certificateInfo{a}, removed: 1},
+		{name: "renewed", old: []certificateInfo{a, b}, cur: []certificateInfo{renewedA, b}, renewed: 1},
+		{name: "renewed and added", old: []certificateInfo{a}, cur: []certificateInfo{c, renewedA}, added: 1, renewed: 1},
+		{name: "no snapshot", cur: []certificateInfo{a, b}, added: 2},
+	}
+
+	for _, tt := range tests {
+		d := diffCertificates(tt.old, tt.cur)
+		if len(d.Added) != tt.added || len(d.Removed) != tt.removed || len(d.Renewed) != tt.renewed {
+			t.Errorf("%v: added (%v) removed (%v) renewed (%v), want (%v) (%v) (%v)",
+				tt.name, len(d.Added), len(d.Removed), len(d.Renewed), tt.added, tt.removed, tt.renewed)
+		}
+	}
+}
+
+func TestInWindow(t *testing.T) {
+	old := []certificateInfo{{ID: 10, SHA256: "new"}, {ID: 5, SHA256: "mid"}, {ID: 1, SHA256: "old"}, {SHA256: "unknown"}}
+	cur := []certificateInfo{{ID: 12}, {ID: 10}, {ID: 5}}
+
+	tests := []struct {
+		name      string
+		truncated bool
+		in        int
+		outside   int
+	}{
+		{name: "complete", in: 4},
+		{name: "truncated", truncated: true, in: 2, outside: 2},
+	}
+
+	for _, tt := range tests {
+		in, outside := inWindow(old, cur, tt.truncated)
+		if len(in) != tt.in || outside != tt.outside {
+			t.Errorf("%v: in (%v) outside (%v), want (%v) (%v)", tt.name, len(in), outside, tt.in, tt.outside)
+		}
+	}
+
+	// a snapshot cert that dropped out of a truncated window isn't reported removed
+	in, _ := inWindow(old, cur, true)
+	if d := diffCertificates(in, []certificateInfo{{ID: 12, SHA256: "newest"}, {ID: 10, SHA256: "new"}, {ID: 5, SHA256: "mid"}}); len(d.Removed) != 0 {
+		t.Errorf("removed (%v), want none", d.Removed)
+	}
+}
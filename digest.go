@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// digestMaxCertificates are kept in a digest, later ones are only counted
+	digestMaxCertificates = 1000
+	// digestTextCertificates are listed in the text of a digest
+	digestTextCertificates = 20
+)
+
+var errDigestPeriod = errors.New("expected digest to be a positive duration (ex: 1h or 24h)")
+
+// certificateDigest summarizes the certificates found over a period, sent in place of an event for each
+type certificateDigest struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+	Count int       `json:"count"`
+	// Severity is the highest of the certificates
+	Severity   severity           `json:"severity"`
+	BySeverity map[string]int     `json:"by_severity"`
+	Queries    []string           `json:"queries"`
+	Events     []certificateEvent `json:"certificates"`
+}
+
+// eventSeverity of a certificate event or digest, 0 for other events
+func eventSeverity(event any) severity {
+	switch e := event.(type) {
+	case certificateEvent:
+		return e.Severity
+	case certificateDigest:
+		return e.Severity
+	}
+
+	return 0
+}
+
+// add e to d
+func (d *certificateDigest) add(e certificateEvent) {
+	d.Count++
+	d.BySeverity[e.Severity.String()]++
+	if e.Severity > d.Severity {
+		d.Severity = e.Severity
+	}
+
+	i := sort.SearchStrings(d.Queries, e.Query)
+	if i == len(d.Queries) || d.Queries[i] != e.Query {
+		d.Queries = append(d.Queries, "")
+		copy(d.Queries[i+1:], d.Queries[i:])
+		d.Queries[i] = e.Query
+	}
+
+	if len(d.Events) < digestMaxCertificates {
+		d.Events = append(d.Events, e)
+	}
+}
+
+// digestText describes d for people, most severe certificates first
+func digestText(d certificateDigest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%v] %v new certificates for %v between %v and %v",
+		d.Severity,
+		d.Count,
+		strings.Join(d.Queries, ", "),
+		d.Since.UTC().Format(time.RFC3339),
+		d.Until.UTC().Format(time.RFC3339),
+	)
+
+	for _, sev := range []severity{severityCritical, severityWarning, severityInfo} {
+		if n := d.BySeverity[sev.String()]; n > 0 {
+			fmt.Fprintf(&b, "\n%v: %v", sev, n)
+		}
+	}
+
+	events := append([]certificateEvent(nil), d.Events...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Severity > events[j].Severity })
+	for i, e := range events {
+		if i == digestTextCertificates {
+			break
+		}
+		fmt.Fprintf(&b, "\n- [%v] %v issued by %v", e.Severity, e.Certificate.displayName(), e.Certificate.IssuerName)
+	}
+	if d.Count > digestTextCertificates {
+		fmt.Fprintf(&b, "\n...and %v more", d.Count-digestTextCertificates)
+	}
+
+	return b.String()
+}
+
+// digestSink batches the certificate events sent to it into a certificateDigest, sent to sink by
+// the first Flush once period has passed since the first of them, other events pass straight through.
+// It is safe for concurrent use, as the monitors notifying the same notifier share one
+type digestSink struct {
+	sink   eventSink
+	period time.Duration
+
+	mu      sync.Mutex
+	source  string
+	pending *certificateDigest
+	// seq numbers the digests from 1, it is that of the pending digest while there is one
+	seq uint64
+	// sent is the seq of the digest last sent to sink until sink is flushed, 0 for none
+	sent uint64
+	// delivered is the seq of the digest sink last flushed, those before it were flushed too
+	delivered uint64
+}
+
+func newDigestSink(sink eventSink, period time.Duration) *digestSink {
+	return &digestSink{sink: sink, period: period}
+}
+
+// Send adds a certificate event to the digest
+func (s *digestSink) Send(ctx context.Context, source string, event any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := event.(certificateEvent)
+	if !ok {
+		return s.sink.Send(ctx, source, event)
+	}
+
+	if s.pending == nil {
+		s.pending = &certificateDigest{Since: time.Now(), BySeverity: make(map[string]int)}
+		s.seq++
+	}
+	s.source = source
+	s.pending.add(e)
+
+	return nil
+}
+
+// Flush the digest once its period has passed, kept for the next Flush if it can't be sent
+func (s *digestSink) Flush(ctx context.Context) error {
+	return s.flush(ctx, false)
+}
+
+// flushNow sends the digest without waiting for its period to pass, as when stopping
+func (s *digestSink) flushNow(ctx context.Context) error {
+	return s.flush(ctx, true)
+}
+
+func (s *digestSink) flush(ctx context.Context, now bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending != nil && (now || time.Since(s.pending.Since) >= s.period) {
+		s.pending.Until = time.Now()
+		if err := s.sink.Send(ctx, s.source, *s.pending); err != nil {
+			return err
+		}
+		s.pending = nil
+		s.sent = s.seq
+	}
+
+	// a digest sent before a failed Flush is only delivered by a later one, not the digest pending
+	// by then
+	if err := s.sink.Flush(ctx); err != nil {
+		return err
+	}
+	if s.sent != 0 {
+		s.delivered, s.sent = s.sent, 0
+	}
+
+	return nil
+}
+
+// held is the seq of the digest a certificate just sent is kept in
+func (s *digestSink) held() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.seq
+}
+
+// deliveries is the seq of the last digest delivered, a certificate held in it or before it was sent
+func (s *digestSink) deliveries() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.delivered
+}
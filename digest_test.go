@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// recordingSink keeps the events flushed to it, failing the next failSends sends and failFlushes flushes
+type recordingSink struct {
+	failSends   int
+	failFlushes int
+	buffered    []any
+	flushed     []any
+}
+
+var errRecordingSink = errors.New("recording sink failure")
+
+func (s *recordingSink) Send(ctx context.Context, source string, event any) error {
+	if s.failSends > 0 {
+		s.failSends--
+		return errRecordingSink
+	}
+	s.buffered = append(s.buffered, event)
+	return nil
+}
+
+func (s *recordingSink) Flush(ctx context.Context) error {
+	if s.failFlushes > 0 {
+		s.failFlushes--
+		return errRecordingSink
+	}
+	s.flushed = append(s.flushed, s.buffered...)
+	s.buffered = nil
+	return nil
+}
+
+func TestCertificateDigestAdd(t *testing.T) {
+	d := certificateDigest{BySeverity: make(map[string]int)}
+	for _, e := range []certificateEvent{
+		{Query: "example.org", Severity: severityInfo},
+		{Query: "example.com", Severity: severityCritical},
+		{Query: "example.org", Severity: severityWarning},
+		{Query: "example.net", Severity: severityInfo},
+	} {
+		d.add(e)
+	}
+
+	if d.Count != 4 || len(d.Events) != 4 {
+		t.Errorf("count (%v) events (%v), want 4", d.Count, len(d.Events))
+	}
+	if d.Severity != severityCritical {
+		t.Errorf("severity (%v), want (%v)", d.Severity, severityCritical)
+	}
+	if d.BySeverity["info"] != 2 || d.BySeverity["warning"] != 1 || d.BySeverity["critical"] != 1 {
+		t.Errorf("by severity (%v)", d.BySeverity)
+	}
+	if want := []string{"example.com", "example.net", "example.org"}; len(d.Queries) != len(want) || d.Queries[0] != want[0] || d.Queries[1] != want[1] || d.Queries[2] != want[2] {
+		t.Errorf("queries (%v), want (%v)", d.Queries, want)
+	}
+}
+
+func TestDigestSink(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		period     time.Duration
+		now        bool
+		failFlush  int
+		digests    int
+		deliveries uint64
+	}{
+		{name: "period not passed", period: time.Hour},
+		{name: "period passed", period: time.Nanosecond, digests: 1, deliveries: 1},
+		{name: "sent now", period: time.Hour, now: true, digests: 1, deliveries: 1},
+		{name: "flush failed", period: time.Nanosecond, failFlush: 1},
+	}
+
+	for _, tt := range tests {
+		inner := &recordingSink{failFlushes: tt.failFlush}
+		s := newDigestSink(inner, tt.period)
+		for _, query := range []string{"a.example.com", "b.example.com"} {
+			if err := s.Send(ctx, "daemon", certificateEvent{Query: query, Severity: severityInfo}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		time.Sleep(time.Millisecond)
+
+		flush := s.Flush
+		if tt.now {
+			flush = s.flushNow
+		}
+		if err := flush(ctx); err != nil && tt.failFlush == 0 {
+			t.Errorf("%v: flush error (%v)", tt.name, err)
+		}
+
+		if len(inner.flushed) != tt.digests || s.deliveries() != tt.deliveries {
+			t.Errorf("%v: digests (%v) deliveries (%v), want (%v) (%v)", tt.name, len(inner.flushed), s.deliveries(), tt.digests, tt.deliveries)
+		}
+		if tt.digests > 0 && inner.flushed[0].(certificateDigest).Count != 2 {
+			t.Errorf("%v: digest of (%v) certificates, want 2", tt.name, inner.flushed[0].(certificateDigest).Count)
+		}
+	}
+
+	// flush failed, then a new certificate: delivering the first digest doesn't deliver the second
+	inner := &recordingSink{failFlushes: 1}
+	s := newDigestSink(inner, time.Hour)
+	if err := s.Send(ctx, "daemon", certificateEvent{Query: "a.example.com", Severity: severityInfo}); err != nil {
+		t.Fatal(err)
+	}
+	first := s.held()
+	if err := s.flushNow(ctx); err == nil {
+		t.Fatal("flush succeeded, want the inner flush to fail")
+	}
+	if err := s.Send(ctx, "daemon", certificateEvent{Query: "b.example.com", Severity: severityInfo}); err != nil {
+		t.Fatal(err)
+	}
+	second := s.held()
+	if err := s.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(inner.flushed) != 1 || s.deliveries() < first || s.deliveries() >= second {
+		t.Errorf("digests (%v) deliveries (%v), want only the first digest (%v) delivered before (%v)", len(inner.flushed), s.deliveries(), first, second)
+	}
+	if err := s.flushNow(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(inner.flushed) != 2 || s.deliveries() < second {
+		t.Errorf("digests (%v) deliveries (%v), want the second digest (%v) delivered", len(inner.flushed), s.deliveries(), second)
+	}
+
+	// other events aren't digested
+	inner = &recordingSink{}
+	s = newDigestSink(inner, time.Hour)
+	if err := s.Send(ctx, "daemon", watchEvent{Type: eventBackendError}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Flush(ctx); err != nil || len(inner.flushed) != 1 {
+		t.Errorf("passed through (%v) events error (%v), want 1", len(inner.flushed), err)
+	}
+}
+
+// TestSharedDigest checks that monitors sharing a digest get one summary, and their certificates are
+// only seen and recorded in the ledger once it is delivered
+func TestSharedDigest(t *testing.T) {
+	ctx := context.Background()
+
+	ledger, err := openEventLedger(filepath.Join(t.TempDir(), "ledger"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ledger.Close()
+
+	inner := &recordingSink{}
+	digest := newDigestSink(inner, time.Hour)
+	ders := benchmarkDERs(t, 2)
+
+	var watchers []*watcher
+	for i, query := range []string{"a.example.com", "b.example.com"} {
+		results := benchmarkResults(ders[i : i+1])
+		w := newWatcher(query, 10, []notifyRoute{{name: "digest", sink: digest}}, func(ctx context.Context) ([]result, error) {
+			return results, nil
+		})
+		w.baseline = true
+		w.ledger = ledger
+		watchers = append(watchers, w)
+	}
+
+	for _, w := range watchers {
+		if err = w.poll(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if len(w.pending) != 1 || len(w.seen) != 0 {
+			t.Fatalf("(%v) pending (%v) seen before the digest is sent, want 1 and 0", len(w.pending), len(w.seen))
+		}
+	}
+	if len(inner.flushed) != 0 {
+		t.Fatalf("(%v) digests sent before the period passed", len(inner.flushed))
+	}
+
+	// another poll doesn't add the certificates to the digest twice
+	if err = watchers[0].poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = digest.flushNow(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range watchers {
+		w.settle()
+		if len(w.pending) != 0 || len(w.seen) != 1 {
+			t.Errorf("(%v) pending (%v) seen once the digest is sent, want 0 and 1", len(w.pending), len(w.seen))
+		}
+		for sum := range w.seen {
+			if !ledger.sent(newLedgerKey(w.query, eventNewCertificate, "digest", sum)) {
+				t.Errorf("certificate of (%v) not in the ledger once the digest is sent", w.query)
+			}
+		}
+	}
+
+	if len(inner.flushed) != 1 || inner.flushed[0].(certificateDigest).Count != 2 {
+		t.Errorf("digests (%v), want 1 of 2 certificates", inner.flushed)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// exportTarget stores exported certificates and their manifest
+type exportTarget interface {
+	// Put body under name, contentType is only kept by object stores
+	Put(ctx context.Context, name string, contentType string, body []byte) error
+	// location of name once put, for listing what was exported
+	location(name string) string
+}
+
+// newExportTarget for s3://bucket/prefix, gs://bucket/prefix or a local directory (optionally file://dir)
+func newExportTarget(target string, endpoint string) (exportTarget, error) {
+	if !strings.Contains(target, "://") || strings.HasPrefix(target, "file://") {
+		return newDirStore(strings.TrimPrefix(target, "file://"))
+	}
+
+	return newObjectStore(target, endpoint)
+}
+
+// dirStore writes exported files into a local directory
+type dirStore struct {
+	dir string
+}
+
+// newDirStore in dir, creating it if missing
+func newDirStore(dir string) (*dirStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create export directory (%w)", err)
+	}
+
+	return &dirStore{dir: dir}, nil
+}
+
+// Put body in the file name, replacing it atomically so readers never see a partial certificate
+func (d *dirStore) Put(ctx context.Context, name string, contentType string, body []byte) error {
+	tmp, err := os.CreateTemp(d.dir, "."+name+".*")
+	if err != nil {
+		return fmt.Errorf("could not create (%v) (%w)", name, err)
+	}
+
+	if _, err = tmp.Write(body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("could not write (%v) (%w)", name, err)
+	}
+	// CreateTemp makes the file private, certificates are public
+	if err = tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("could not write (%v) (%w)", name, err)
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("could not write (%v) (%w)", name, err)
+	}
+
+	if err = os.Rename(tmp.Name(), d.location(name)); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("could not write (%v) (%w)", name, err)
+	}
+
+	return nil
+}
+
+func (d *dirStore) location(name string) string {
+	return filepath.Join(d.dir, name)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+)
+
+// attributeNames are the short names of distinguished name attribute types, as used by RFC 2253 and
+// OpenSSL where RFC 2253 has none
+var attributeNames = map[string]string{
+	"2.5.4.3":                    "CN",
+	"2.5.4.4":                    "SN",
+	"2.5.4.5":                    "SERIALNUMBER",
+	"2.5.4.6":                    "C",
+	"2.5.4.7":                    "L",
+	"2.5.4.8":                    "ST",
+	"2.5.4.9":                    "STREET",
+	"2.5.4.10":                   "O",
+	"2.5.4.11":                   "OU",
+	"2.5.4.12":                   "title",
+	"2.5.4.15":                   "businessCategory",
+	"2.5.4.17":                   "postalCode",
+	"2.5.4.42":                   "GN",
+	"2.5.4.97":                   "organizationIdentifier",
+	"0.9.2342.19200300.100.1.1":  "UID",
+	"0.9.2342.19200300.100.1.25": "DC",
+	"1.2.840.113549.1.9.1":       "emailAddress",
+	"1.3.6.1.4.1.311.60.2.1.1":   "jurisdictionL",
+	"1.3.6.1.4.1.311.60.2.1.2":   "jurisdictionST",
+	"1.3.6.1.4.1.311.60.2.1.3":   "jurisdictionC",
+}
+
+// dnAttribute is a single attribute of a distinguished name
+type dnAttribute struct {
+	OID   string `json:"oid"`
+	Name  string `json:"name,omitempty"`
+	Value string `json:"value"`
+}
+
+// parseDN from its DER encoding, keeping the order and every attribute of the encoded RDN sequence
+func parseDN(raw []byte) (pkix.RDNSequence, error) {
+	var rdns pkix.RDNSequence
+	rest, err := asn1.Unmarshal(raw, &rdns)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse distinguished name (%w)", err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("could not parse distinguished name (%w)", asn1.SyntaxError{Msg: "trailing data"})
+	}
+
+	return rdns, nil
+}
+
+// rfc2253 string of the DER encoded distinguished name, most specific attribute first,
+// fallback is used when raw cannot be parsed
+func rfc2253(raw []byte, fallback pkix.Name) string {
+	rdns, err := parseDN(raw)
+	if err != nil {
+		return fallback.String()
+	}
+
+	return rdns.String()
+}
+
+// dnAttributes of the DER encoded distinguished name in encoded order
+func dnAttributes(raw []byte) []dnAttribute {
+	rdns, err := parseDN(raw)
+	if err != nil {
+		return nil
+	}
+
+	var attrs []dnAttribute
+	for _, rdn := range rdns {
+		for _, atv := range rdn {
+			oid := atv.Type.String()
+			attrs = append(attrs, dnAttribute{
+				OID:   oid,
+				Name:  attributeNames[oid],
+				Value: fmt.Sprint(atv.Value),
+			})
+		}
+	}
+
+	return attrs
+}
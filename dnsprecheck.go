@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsNegativeTTL is how long a name without addresses is cached, answers are cached for their TTL
+const dnsNegativeTTL = 5 * time.Minute
+
+var errDoHURL = errors.New("expected an https:// DNS over HTTPS URL")
+
+// DNS pre-check statuses of a name
+const (
+	// dnsResolved names have addresses and are probed
+	dnsResolved = "resolved"
+	// dnsNXDomain names don't exist and dnsNoData names have no A or AAAA records, neither is probed
+	dnsNXDomain = "nxdomain"
+	dnsNoData   = "nodata"
+	// dnsFailed names couldn't be resolved for another reason (ex: SERVFAIL or a timeout), they are
+	// probed anyway as the probe's own lookup may work
+	dnsFailed = "error"
+)
+
+// dnsAnswer for a name by the pre-check
+type dnsAnswer struct {
+	status  string
+	ips     []string
+	expires time.Time
+}
+
+// dnsPrecheck resolves names before they are probed so those that can't be live are skipped rather
+// than each waiting out a probe's timeout, with the system resolver or over HTTPS (RFC 8484)
+type dnsPrecheck struct {
+	// doh is the DNS over HTTPS endpoint (ex: https://cloudflare-dns.com/dns-query), "" for the system resolver
+	doh     string
+	client  *http.Client
+	timeout time.Duration
+
+	mu    sync.Mutex
+	cache map[string]dnsAnswer
+}
+
+// newDNSPrecheck resolving with the DNS over HTTPS endpoint doh, or the system resolver for "",
+// each lookup within timeout
+func newDNSPrecheck(doh string, timeout time.Duration) (*dnsPrecheck, error) {
+	if doh != "" {
+		if u, err := url.Parse(doh); err != nil || u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("%w (%v)", errDoHURL, doh)
+		}
+	}
+
+	return &dnsPrecheck{
+		doh:     doh,
+		client:  &http.Client{Timeout: timeout},
+		timeout: timeout,
+		cache:   make(map[string]dnsAnswer),
+	}, nil
+}
+
+// run the pre-check of assets, concurrency names at once, setting the DNS status and IPs of each
+func (p *dnsPrecheck) run(ctx context.Context, assets []*inventoryAsset, concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		wg    sync.WaitGroup
+		slots = make(chan struct{}, concurrency)
+	)
+	for _, a := range assets {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(a *inventoryAsset) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			answer := p.resolve(ctx, a.Name)
+			a.DNS, a.IPs = answer.status, answer.ips
+		}(a)
+	}
+	wg.Wait()
+
+	counts := make(map[string]int)
+	for _, a := range assets {
+		counts[a.DNS]++
+	}
+	log.Printf("DNS pre-check: Resolved: (%v) NXDOMAIN: (%v) No addresses: (%v) Failed: (%v)\n",
+		counts[dnsResolved], counts[dnsNXDomain], counts[dnsNoData], counts[dnsFailed])
+}
+
+// resolve name, from the cache while its answer hasn't expired
+func (p *dnsPrecheck) resolve(ctx context.Context, name string) dnsAnswer {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	p.mu.Lock()
+	answer, ok := p.cache[name]
+	p.mu.Unlock()
+	if ok && time.Now().Before(answer.expires) {
+		return answer
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	if p.doh != "" {
+		answer = p.lookupDoH(ctx, name)
+	} else {
+		answer = p.lookupSystem(ctx, name)
+	}
+
+	// failures are retried by the next lookup rather than cached
+	if answer.status != dnsFailed {
+		p.mu.Lock()
+		p.cache[name] = answer
+		p.mu.Unlock()
+	}
+
+	return answer
+}
+
+// lookupSystem of name with the system resolver, which can't tell NXDOMAIN from no addresses nor
+// give TTLs
+func (p *dnsPrecheck) lookupSystem(ctx context.Context, name string) dnsAnswer {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, name)
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		return dnsAnswer{status: dnsNXDomain, expires: time.Now().Add(dnsNegativeTTL)}
+	case err != nil:
+		return dnsAnswer{status: dnsFailed}
+	case len(addrs) == 0:
+		return dnsAnswer{status: dnsNoData, expires: time.Now().Add(dnsNegativeTTL)}
+	}
+
+	answer := dnsAnswer{status: dnsResolved, expires: time.Now().Add(dnsNegativeTTL)}
+	for _, addr := range addrs {
+		answer.ips = append(answer.ips, addr.String())
+	}
+
+	return answer
+}
+
+// lookupDoH of the A and AAAA records of name, the answer cached for the shortest TTL among them
+func (p *dnsPrecheck) lookupDoH(ctx context.Context, name string) dnsAnswer {
+	answer := dnsAnswer{status: dnsNoData}
+	ttl := uint32(dnsNegativeTTL / time.Second)
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		rcode, ips, minTTL, err := p.exchange(ctx, name, qtype)
+		switch {
+		case err != nil || (rcode != dnsmessage.RCodeSuccess && rcode != dnsmessage.RCodeNameError):
+			return dnsAnswer{status: dnsFailed}
+		case rcode == dnsmessage.RCodeNameError:
+			// the name doesn't exist whatever the type, no need to ask for AAAA
+			return dnsAnswer{status: dnsNXDomain, expires: time.Now().Add(dnsNegativeTTL)}
+		}
+
+		if len(ips) > 0 {
+			answer.status = dnsResolved
+			answer.ips = append(answer.ips, ips...)
+			if minTTL < ttl {
+				ttl = minTTL
+			}
+		}
+	}
+	answer.expires = time.Now().Add(time.Duration(ttl) * time.Second)
+
+	return answer
+}
+
+// exchange a query of qtype for name with the DNS over HTTPS endpoint, returning the response code
+// and the addresses answered with their shortest TTL
+func (p *dnsPrecheck) exchange(ctx context.Context, name string, qtype dnsmessage.Type) (rcode dnsmessage.RCode, ips []string, ttl uint32, err error) {
+	qname, err := dnsmessage.NewName(name + ".")
+	if err != nil {
+		return 0, nil, 0, fmt.Errorf("could not encode DNS name (%v) (%w)", name, err)
+	}
+
+	// RFC 8484 asks for an ID of 0 so responses can be cached by HTTP
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return 0, nil, 0, fmt.Errorf("could not pack DNS query (%w)", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.doh, bytes.NewReader(packed))
+	if err != nil {
+		return 0, nil, 0, fmt.Errorf("could not create request (%w)", err)
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, nil, 0, fmt.Errorf("could not query (%v) (%w)", p.doh, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, nil, 0, fmt.Errorf("%w (%v)", errHTTPStatus, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return 0, nil, 0, fmt.Errorf("could not read DNS response (%w)", err)
+	}
+
+	var msg dnsmessage.Message
+	if err = msg.Unpack(body); err != nil {
+		return 0, nil, 0, fmt.Errorf("could not unpack DNS response (%w)", err)
+	}
+
+	// a CNAME chain comes first, the addresses it ends at follow
+	for _, rr := range msg.Answers {
+		var ip net.IP
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			ip = body.A[:]
+		case *dnsmessage.AAAAResource:
+			ip = body.AAAA[:]
+		default:
+			continue
+		}
+		ips = append(ips, ip.String())
+		if ttl == 0 || rr.Header.TTL < ttl {
+			ttl = rr.Header.TTL
+		}
+	}
+
+	return msg.RCode, ips, ttl, nil
+}
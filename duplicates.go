@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// leDuplicateLimit certificates for the same set of names may be issued by Let's Encrypt
+	// within leDuplicateWindow, see https://letsencrypt.org/docs/duplicate-certificate-limit/
+	leDuplicateLimit  = 5
+	leDuplicateWindow = 7 * 24 * time.Hour
+)
+
+// nameSetIssuance is how often one exact set of names was issued within the window, oldest first
+type nameSetIssuance struct {
+	names  []string
+	issued []time.Time
+}
+
+// nextSlot is when the oldest issuance leaves the window, freeing a certificate under the limit
+func (n nameSetIssuance) nextSlot() time.Time {
+	return n.issued[0].Add(leDuplicateWindow)
+}
+
+// isLetsEncrypt is whether cert was issued by Let's Encrypt
+func isLetsEncrypt(cert *x509.Certificate) bool {
+	for _, org := range cert.Issuer.Organization {
+		if org == "Let's Encrypt" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// nameSet of cert, its lowercased unique names sorted as Let's Encrypt compares them
+func nameSet(cert *x509.Certificate) []string {
+	seen := make(map[string]struct{}, len(cert.DNSNames))
+	names := make([]string, 0, len(cert.DNSNames))
+	for _, name := range cert.DNSNames {
+		name = strings.ToLower(name)
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// duplicateIssuances of Let's Encrypt certificates within the window before now by name set,
+// most issued first. certs must not have precertificates of certificates also present
+func duplicateIssuances(certs []*x509.Certificate, now time.Time) []nameSetIssuance {
+	var (
+		sets  []nameSetIssuance
+		index = make(map[string]int)
+	)
+	for _, cert := range certs {
+		if !isLetsEncrypt(cert) || now.Sub(cert.NotBefore) > leDuplicateWindow {
+			continue
+		}
+
+		names := nameSet(cert)
+		key := strings.Join(names, ",")
+		i, ok := index[key]
+		if !ok {
+			i = len(sets)
+			index[key] = i
+			sets = append(sets, nameSetIssuance{names: names})
+		}
+		sets[i].issued = append(sets[i].issued, cert.NotBefore)
+	}
+
+	for _, s := range sets {
+		sort.Slice(s.issued, func(i, j int) bool { return s.issued[i].Before(s.issued[j]) })
+	}
+	sort.SliceStable(sets, func(i, j int) bool {
+		return len(sets[i].issued) > len(sets[j].issued)
+	})
+
+	return sets
+}
+
+func runDuplicates(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	source := addSourceFlags(fs, 1000)
+	warnAt := fs.Int("warn-at", leDuplicateLimit-1, "warn once a name set has been issued this many times within the window")
+	output := addOutputFileFlag(fs)
+	parseFlags(fs, args)
+
+	_, results, err := source.certificates(ctx, fs)
+	if err != nil {
+		return err
+	}
+	// Let's Encrypt counts an issuance once, crt.sh logs its precertificate and certificate
+	certs := dedupeCertificates(certificatesOf(results))
+
+	now := time.Now()
+	sets := duplicateIssuances(certs, now)
+
+	return writeOutput(*output, func(out io.Writer) error {
+		fmt.Fprintf(out, "Let's Encrypt name sets issued in the last (%v) days: (%v)\n", int(leDuplicateWindow.Hours()/24), len(sets))
+
+		for _, s := range sets {
+			fmt.Fprintf(out, "  %v/%v Names: (%v)\n", len(s.issued), leDuplicateLimit, strings.Join(s.names, ", "))
+
+			switch n := len(s.issued); {
+			case n >= leDuplicateLimit:
+				fmt.Fprintf(out, "    Warning: (duplicate certificate limit reached, next issuance possible at %v)\n", s.nextSlot().Format(time.RFC3339))
+			case n >= *warnAt:
+				fmt.Fprintf(out, "    Warning: (approaching the duplicate certificate limit, %v left until %v)\n", leDuplicateLimit-n, s.nextSlot().Format(time.RFC3339))
+			}
+		}
+
+		return nil
+	})
+}
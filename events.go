@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// eventSchemaVersion of the lines written by watch -events. Within a version fields are only ever
+// added, never renamed, removed or changed in type or meaning, any other change increments it
+const eventSchemaVersion = 1
+
+// watch event types
+const (
+	eventNewCertificate  = "new_certificate"
+	eventExpiring        = "expiring"
+	eventPolicyViolation = "policy_violation"
+	eventBackendError    = "backend_error"
+)
+
+// watchEvent is a line of the NDJSON event stream of watch, for log shippers (ex: Vector or Fluent
+// Bit) to consume without a dedicated sink
+type watchEvent struct {
+	SchemaVersion int    `json:"schema_version"`
+	Type          string `json:"type"`
+	// Time the event happened
+	Time  time.Time `json:"time"`
+	Query string    `json:"query"`
+	// Severity, Warnings and Anomalies of a new certificate
+	Severity  severity `json:"severity,omitempty"`
+	Warnings  []string `json:"warnings,omitempty"`
+	Anomalies []string `json:"anomalies,omitempty"`
+	// Violations of the -policy by a new certificate
+	Violations []policyViolation `json:"violations,omitempty"`
+	// ExpiresInDays of an expiring certificate
+	ExpiresInDays *int `json:"expires_in_days,omitempty"`
+	// Error querying the backend
+	Error       string           `json:"error,omitempty"`
+	Certificate *certificateInfo `json:"certificate,omitempty"`
+}
+
+// eventStream writes watchEvents a line each
+type eventStream struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	// emitted are the events about a certificate already written, each is only written once
+	emitted map[ledgerKey]struct{}
+	// ledger, if set, also keeps them across restarts
+	ledger *eventLedger
+	// expiring, if set, are also sent each expiring event, as the -exec hook is
+	expiring []eventSink
+}
+
+// newEventStream writing to w
+func newEventStream(w io.Writer) *eventStream {
+	return &eventStream{enc: json.NewEncoder(w), emitted: make(map[ledgerKey]struct{})}
+}
+
+// emit e, a failure to write is only logged so watching carries on
+func (s *eventStream) emit(e watchEvent) {
+	if s == nil {
+		return
+	}
+
+	e.SchemaVersion = eventSchemaVersion
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.enc.Encode(e); err != nil {
+		log.Printf("could not write (%v) event (%v)\n", e.Type, err)
+	}
+}
+
+// emitOnce e about the certificate with fingerprint unless it was emitted before, returning whether
+// it was
+func (s *eventStream) emitOnce(e watchEvent, fingerprint [sha256.Size]byte) bool {
+	if s == nil {
+		return false
+	}
+
+	key := newLedgerKey(e.Query, e.Type, "events", fingerprint)
+	s.mu.Lock()
+	_, ok := s.emitted[key]
+	s.emitted[key] = struct{}{}
+	s.mu.Unlock()
+	if ok || s.ledger.sent(key) {
+		return false
+	}
+
+	s.emit(e)
+	if err := s.ledger.record(key); err != nil {
+		log.Printf("could not record (%v) event (%v)\n", e.Type, err)
+	}
+
+	return true
+}
+
+// emitExpiring of the certificates in results at now that expire within expiringSoon and haven't
+// been replaced by one valid for longer, each once
+func (s *eventStream) emitExpiring(query string, results []result, now time.Time) {
+	if s == nil {
+		return
+	}
+
+	certs := dedupeCertificates(certificatesOf(results))
+	for _, r := range results {
+		cert := r.cert()
+		left := cert.NotAfter.Sub(now)
+		if left <= 0 || left > expiringSoon || replaced(cert, certs) {
+			continue
+		}
+		// a precertificate and its certificate expire together, report whichever comes first
+		sum := sha256.Sum256(append(append([]byte(nil), cert.RawIssuer...), cert.SerialNumber.Bytes()...))
+
+		days := int(left.Hours() / 24)
+		info := r.info()
+		e := watchEvent{Type: eventExpiring, Query: query, ExpiresInDays: &days, Certificate: &info}
+		if !s.emitOnce(e, sum) {
+			continue
+		}
+		for _, sink := range s.expiring {
+			if err := sink.Send(context.Background(), "watch", e); err != nil {
+				log.Printf("could not send expiring event of (%v) (%v)\n", info.displayName(), err)
+			}
+		}
+	}
+}
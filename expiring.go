@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errExpectedDomains = errors.New("expected domain names as arguments, -domains-file or -zone-file")
+
+// dayDuration is a duration flag that also accepts a whole number of days (ex: 30d)
+type dayDuration time.Duration
+
+func (d *dayDuration) String() string {
+	if d == nil {
+		return ""
+	}
+	if td := time.Duration(*d); td%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%vd", int64(td/(24*time.Hour)))
+	}
+
+	return time.Duration(*d).String()
+}
+
+func (d *dayDuration) Set(s string) error {
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return fmt.Errorf("could not parse days (%w)", err)
+		}
+		*d = dayDuration(time.Duration(n) * 24 * time.Hour)
+		return nil
+	}
+
+	td, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = dayDuration(td)
+
+	return nil
+}
+
+// expiringCertificate of a domain in the portfolio
+type expiringCertificate struct {
+	Domain        string `json:"domain"`
+	ExpiresInDays int    `json:"expires_in_days"`
+	certificateInfo
+}
+
+// expiringDomain groups the expiring certificates of a domain, soonest first
+type expiringDomain struct {
+	Domain       string                `json:"domain"`
+	Certificates []expiringCertificate `json:"certificates"`
+}
+
+// readDomainsFile of one domain name or pattern per line, ignoring blank lines and # comments
+func readDomainsFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open domains file (%w)", err)
+	}
+	defer f.Close()
+
+	var domains []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			domains = append(domains, line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read domains file (%w)", err)
+	}
+
+	return domains, nil
+}
+
+// replaced is whether every name of cert is also on another certificate in certs valid for longer,
+// so its expiry needs no action
+func replaced(cert *x509.Certificate, certs []*x509.Certificate) bool {
+	if len(cert.DNSNames) == 0 {
+		return false
+	}
+
+	for _, name := range cert.DNSNames {
+		covered := false
+		for _, other := range certs {
+			if other == cert || !other.NotAfter.After(cert.NotAfter) {
+				continue
+			}
+			for _, otherName := range other.DNSNames {
+				if strings.EqualFold(name, otherName) {
+					covered = true
+					break
+				}
+			}
+			if covered {
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+
+	return true
+}
+
+// expiringWithin of results at now, those not yet expired but expiring within, leaving out the
+// replaced unless includeReplaced, soonest first
+func expiringWithin(domain string, results []result, within time.Duration, includeReplaced bool, now time.Time) []expiringCertificate {
+	ids := make(map[*x509.Certificate]int64, len(results))
+	for _, r := range results {
+		ids[r.cert()] = r.id
+	}
+	// a precertificate and its certificate are one certificate to renew
+	certs := dedupeCertificates(certificatesOf(results))
+
+	var expiring []expiringCertificate
+	for _, cert := range certs {
+		left := cert.NotAfter.Sub(now)
+		if left <= 0 || left > within || (!includeReplaced && replaced(cert, certs)) {
+			continue
+		}
+
+		info := newCertificateInfo(cert)
+		info.ID = ids[cert]
+		expiring = append(expiring, expiringCertificate{
+			Domain:          domain,
+			ExpiresInDays:   int(left.Hours() / 24),
+			certificateInfo: info,
+		})
+	}
+	sort.SliceStable(expiring, func(i, j int) bool {
+		return expiring[i].NotAfter.Before(expiring[j].NotAfter)
+	})
+
+	return expiring
+}
+
+func runExpiring(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	within := dayDuration(30 * 24 * time.Hour)
+	fs.Var(&within, "within", "list certificates expiring within this long (ex: 30d or 72h)")
+	domainsFile := fs.String("domains-file", "", "read domain names or patterns from this file, one per line, as well as the arguments")
+	zoneFile := fs.String("zone-file", "", "also check the A, AAAA and CNAME hostnames of this BIND zone file")
+	limit := fs.Int("n", 1000, "number of latest entries to check per domain")
+	includeReplaced := fs.Bool("include-replaced", false, "also list certificates whose names are all on a certificate valid for longer")
+	format := fs.String("format", "text", "output format: text, csv or json")
+	output := addOutputFileFlag(fs)
+	parseFlags(fs, args)
+
+	switch *format {
+	case "text", "csv", "json":
+	default:
+		return fmt.Errorf("%w (%v)", errUnknownFormat, *format)
+	}
+
+	domains := fs.Args()
+	if *domainsFile != "" {
+		fromFile, err := readDomainsFile(*domainsFile)
+		if err != nil {
+			return err
+		}
+		domains = append(domains, fromFile...)
+	}
+	if *zoneFile != "" {
+		fromZone, err := readZoneFile(*zoneFile)
+		if err != nil {
+			return err
+		}
+		domains = append(domains, fromZone...)
+	}
+	if len(domains) == 0 {
+		return errExpectedDomains
+	}
+
+	now := time.Now()
+	groups := make([]expiringDomain, 0, len(domains))
+	for _, domain := range domains {
+		set, err := newPatternSet([]string{domain}, nil, nil)
+		if err != nil {
+			return err
+		}
+		results, err := getCertificatesByPatterns(ctx, set, *limit)
+		if err != nil {
+			return fmt.Errorf("could not getCertificates of (%v) error (%w)", domain, err)
+		}
+
+		groups = append(groups, expiringDomain{
+			Domain:       domain,
+			Certificates: expiringWithin(domain, results, time.Duration(within), *includeReplaced, now),
+		})
+	}
+
+	return writeOutput(*output, func(out io.Writer) error {
+		switch *format {
+		case "csv":
+			return writeExpiringCSV(out, groups)
+		case "json":
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(groups); err != nil {
+				return fmt.Errorf("could not write JSON (%w)", err)
+			}
+			return nil
+		}
+
+		total := 0
+		for _, g := range groups {
+			total += len(g.Certificates)
+			fmt.Fprintf(out, "Domain: (%v) Expiring: (%v)\n", g.Domain, len(g.Certificates))
+			for _, c := range g.Certificates {
+				fmt.Fprintf(out, "  %v (%v days) CommonName: (%v) Issuer: (%v) SHA-256: (%v)\n",
+					c.NotAfter.UTC().Format(time.RFC3339),
+					c.ExpiresInDays,
+					displayIDN(c.displayName()),
+					c.IssuerName,
+					c.SHA256,
+				)
+			}
+		}
+		fmt.Fprintf(out, "Domains: (%v) Expiring within (%v): (%v)\n", len(groups), within.String(), total)
+
+		return nil
+	})
+}
+
+// writeExpiringCSV to out, a row per certificate with a header
+func writeExpiringCSV(out io.Writer, groups []expiringDomain) error {
+	w := csv.NewWriter(out)
+	_ = w.Write([]string{"domain", "common_name", "dns_names", "issuer", "not_after", "expires_in_days", "sha256", "crtsh_id"})
+	for _, g := range groups {
+		for _, c := range g.Certificates {
+			_ = w.Write([]string{
+				c.Domain,
+				c.CommonName,
+				strings.Join(c.DNSNames, " "),
+				c.IssuerName,
+				c.NotAfter.UTC().Format(time.RFC3339),
+				strconv.Itoa(c.ExpiresInDays),
+				c.SHA256,
+				strconv.FormatInt(c.ID, 10),
+			})
+		}
+	}
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("could not write CSV (%w)", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+var errExpectedExportArguments = errors.New("expected 2 arguments: target directory or bucket URL and domain name")
+
+func runExport(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	limit := fs.Int("n", 1, "number of entries to export")
+	endpoint := fs.String("endpoint", "", "override the object storage endpoint (ex: https://minio.local:9000)")
+	print0 := fs.Bool("print0", false, "print the path or URL of each exported file to stdout terminated by NUL, for xargs -0")
+	parseFlags(fs, args)
+
+	if fs.NArg() != 2 {
+		return errExpectedExportArguments
+	}
+	target, domain := fs.Arg(0), fs.Arg(1)
+
+	store, err := newExportTarget(target, *endpoint)
+	if err != nil {
+		return fmt.Errorf("could not configure export (%w)", err)
+	}
+
+	results, err := getCertificates(ctx, domain, *limit)
+	if err != nil {
+		return fmt.Errorf("could not getCertificates of (%v) error (%w)", domain, err)
+	}
+
+	manifest := exportManifest{
+		Query:       domain,
+		GeneratedAt: time.Now().UTC(),
+	}
+	for _, r := range results {
+		info := r.info()
+		name := info.SHA256 + ".pem"
+
+		err = store.Put(ctx, name, "application/x-pem-file", pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: r.cert().Raw,
+		}))
+		if err != nil {
+			return fmt.Errorf("could not export certificate (%w)", err)
+		}
+		if err = exported(store, name, *print0); err != nil {
+			return err
+		}
+
+		manifest.Certificates = append(manifest.Certificates, exportManifestEntry{File: name, certificateInfo: info})
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode export manifest (%w)", err)
+	}
+	if err = store.Put(ctx, "manifest.json", "application/json", data); err != nil {
+		return fmt.Errorf("could not export manifest (%w)", err)
+	}
+
+	return exported(store, "manifest.json", *print0)
+}
+
+// exported name to store, listing it NUL terminated on stdout with print0
+func exported(store exportTarget, name string, print0 bool) error {
+	if !print0 {
+		log.Printf("exported (%v)\n", store.location(name))
+		return nil
+	}
+
+	if _, err := fmt.Fprint(os.Stdout, store.location(name), "\x00"); err != nil {
+		return fmt.Errorf("could not write (%v) (%w)", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var (
+	oidSCTList              = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+	oidPrecertificatePoison = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+
+	// knownExtensions are decoded into their own fields rather than listed as unknown
+	knownExtensions = map[string]struct{}{
+		"2.5.29.14":                      {}, // subject key identifier
+		"2.5.29.15":                      {}, // key usage
+		"2.5.29.17":                      {}, // subject alternative name
+		"2.5.29.19":                      {}, // basic constraints
+		"2.5.29.31":                      {}, // CRL distribution points
+		"2.5.29.32":                      {}, // certificate policies
+		"2.5.29.35":                      {}, // authority key identifier
+		"2.5.29.37":                      {}, // extended key usage
+		"1.3.6.1.5.5.7.1.1":              {}, // authority information access
+		oidSCTList.String():              {},
+		oidPrecertificatePoison.String(): {},
+	}
+
+	errSCTListTruncated = errors.New("truncated SCT list")
+)
+
+// keyUsageNames in bit order as named by RFC 5280
+var keyUsageNames = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "digitalSignature"},
+	{x509.KeyUsageContentCommitment, "contentCommitment"},
+	{x509.KeyUsageKeyEncipherment, "keyEncipherment"},
+	{x509.KeyUsageDataEncipherment, "dataEncipherment"},
+	{x509.KeyUsageKeyAgreement, "keyAgreement"},
+	{x509.KeyUsageCertSign, "keyCertSign"},
+	{x509.KeyUsageCRLSign, "cRLSign"},
+	{x509.KeyUsageEncipherOnly, "encipherOnly"},
+	{x509.KeyUsageDecipherOnly, "decipherOnly"},
+}
+
+// extKeyUsageNames as named by RFC 5280 and common vendor usages
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:                            "any",
+	x509.ExtKeyUsageServerAuth:                     "serverAuth",
+	x509.ExtKeyUsageClientAuth:                     "clientAuth",
+	x509.ExtKeyUsageCodeSigning:                    "codeSigning",
+	x509.ExtKeyUsageEmailProtection:                "emailProtection",
+	x509.ExtKeyUsageIPSECEndSystem:                 "ipsecEndSystem",
+	x509.ExtKeyUsageIPSECTunnel:                    "ipsecTunnel",
+	x509.ExtKeyUsageIPSECUser:                      "ipsecUser",
+	x509.ExtKeyUsageTimeStamping:                   "timeStamping",
+	x509.ExtKeyUsageOCSPSigning:                    "OCSPSigning",
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto:     "msSGC",
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:      "nsSGC",
+	x509.ExtKeyUsageMicrosoftCommercialCodeSigning: "msCodeCom",
+	x509.ExtKeyUsageMicrosoftKernelCodeSigning:     "msKernelCodeSigning",
+}
+
+// basicConstraints of a certificate
+type basicConstraints struct {
+	CA         bool `json:"ca"`
+	MaxPathLen *int `json:"max_path_len,omitempty"`
+}
+
+// signedCertificateTimestamp embedded in a certificate as proof of CT logging
+type signedCertificateTimestamp struct {
+	Version   uint8     `json:"version"`
+	LogID     string    `json:"log_id"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// unknownExtension is an extension findcert does not decode, with its value as hex
+type unknownExtension struct {
+	OID      string `json:"oid"`
+	Critical bool   `json:"critical,omitempty"`
+	Value    string `json:"value"`
+}
+
+// certificateExtensions decoded from a certificate
+type certificateExtensions struct {
+	KeyUsage               []string                     `json:"key_usage,omitempty"`
+	ExtKeyUsage            []string                     `json:"ext_key_usage,omitempty"`
+	BasicConstraints       *basicConstraints            `json:"basic_constraints,omitempty"`
+	PolicyOIDs             []string                     `json:"policy_oids,omitempty"`
+	SubjectKeyID           string                       `json:"subject_key_id,omitempty"`
+	AuthorityKeyID         string                       `json:"authority_key_id,omitempty"`
+	CRLDistributionPoints  []string                     `json:"crl_distribution_points,omitempty"`
+	OCSPServers            []string                     `json:"ocsp_servers,omitempty"`
+	IssuingCertificateURLs []string                     `json:"issuing_certificate_urls,omitempty"`
+	SCTs                   []signedCertificateTimestamp `json:"scts,omitempty"`
+	Precertificate         bool                         `json:"precertificate,omitempty"`
+	Unknown                []unknownExtension           `json:"unknown,omitempty"`
+}
+
+// isPrecertificate is whether cert is a precertificate, poisoned so it can't be used in place of
+// the certificate it was logged for
+func isPrecertificate(cert *x509.Certificate) bool {
+	for _, e := range cert.Extensions {
+		if e.Id.Equal(oidPrecertificatePoison) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// keyUsages of cert by name
+func keyUsages(cert *x509.Certificate) []string {
+	var names []string
+	for _, ku := range keyUsageNames {
+		if cert.KeyUsage&ku.usage != 0 {
+			names = append(names, ku.name)
+		}
+	}
+
+	return names
+}
+
+// extKeyUsages of cert by name, unrecognized usages by OID
+func extKeyUsages(cert *x509.Certificate) []string {
+	var names []string
+	for _, eku := range cert.ExtKeyUsage {
+		if name, ok := extKeyUsageNames[eku]; ok {
+			names = append(names, name)
+		}
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		names = append(names, oid.String())
+	}
+
+	return names
+}
+
+// decodeExtensions of cert
+func decodeExtensions(cert *x509.Certificate) certificateExtensions {
+	ext := certificateExtensions{
+		KeyUsage:               keyUsages(cert),
+		ExtKeyUsage:            extKeyUsages(cert),
+		SubjectKeyID:           hex.EncodeToString(cert.SubjectKeyId),
+		AuthorityKeyID:         hex.EncodeToString(cert.AuthorityKeyId),
+		CRLDistributionPoints:  cert.CRLDistributionPoints,
+		OCSPServers:            cert.OCSPServer,
+		IssuingCertificateURLs: cert.IssuingCertificateURL,
+	}
+
+	if cert.BasicConstraintsValid {
+		ext.BasicConstraints = &basicConstraints{CA: cert.IsCA}
+		if cert.MaxPathLen > 0 || cert.MaxPathLenZero {
+			maxPathLen := cert.MaxPathLen
+			ext.BasicConstraints.MaxPathLen = &maxPathLen
+		}
+	}
+
+	for _, oid := range cert.PolicyIdentifiers {
+		ext.PolicyOIDs = append(ext.PolicyOIDs, oid.String())
+	}
+
+	for _, e := range cert.Extensions {
+		if _, ok := knownExtensions[e.Id.String()]; ok {
+			continue
+		}
+		if e.Id.Equal(oidPrecertificatePoison) {
+			ext.Precertificate = true
+			continue
+		}
+		if e.Id.Equal(oidSCTList) {
+			// an SCT list that can't be decoded is still shown, as an unknown extension
+			if scts, err := parseSCTList(e.Value); err == nil {
+				ext.SCTs = scts
+				continue
+			}
+		}
+
+		ext.Unknown = append(ext.Unknown, unknownExtension{
+			OID:      e.Id.String(),
+			Critical: e.Critical,
+			Value:    hex.EncodeToString(e.Value),
+		})
+	}
+
+	return ext
+}
+
+// parseSCTList from the value of the SCT list extension, an OCTET STRING holding the
+// TLS encoded SignedCertificateTimestampList of RFC 6962 section 3.3
+func parseSCTList(value []byte) ([]signedCertificateTimestamp, error) {
+	var list []byte
+	if _, err := asn1.Unmarshal(value, &list); err != nil {
+		return nil, err
+	}
+
+	if len(list) < 2 {
+		return nil, errSCTListTruncated
+	}
+	list = list[2:]
+
+	var scts []signedCertificateTimestamp
+	for len(list) > 0 {
+		if len(list) < 2 {
+			return nil, errSCTListTruncated
+		}
+		n := int(binary.BigEndian.Uint16(list))
+		list = list[2:]
+		if len(list) < n {
+			return nil, errSCTListTruncated
+		}
+		sct := list[:n]
+		list = list[n:]
+
+		// version (1) log id (32) timestamp (8)
+		if len(sct) < 41 {
+			return nil, errSCTListTruncated
+		}
+		ms := int64(binary.BigEndian.Uint64(sct[33:41]))
+
+		scts = append(scts, signedCertificateTimestamp{
+			Version:   sct[0],
+			LogID:     base64.StdEncoding.EncodeToString(sct[1:33]),
+			Timestamp: time.UnixMilli(ms).UTC(),
+		})
+	}
+
+	return scts, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// graphNode is a distinguished name or a public key
+type graphNode struct {
+	id    string
+	label string
+	key   bool
+}
+
+type graphEdge struct {
+	from  string
+	to    string
+	label string
+}
+
+// certificateGraph of which names issued which, and which keys each name used,
+// a name with several issuers is cross-signed and a key shared by names is reused
+type certificateGraph struct {
+	nodes []graphNode
+	edges []graphEdge
+
+	ids   map[string]string
+	edged map[graphEdge]struct{}
+}
+
+// buildCertificateGraph from the subjects, issuers and public keys of certs
+func buildCertificateGraph(certs []*x509.Certificate) *certificateGraph {
+	g := &certificateGraph{
+		ids:   make(map[string]string),
+		edged: make(map[graphEdge]struct{}),
+	}
+
+	for _, cert := range certs {
+		label := subjectLabel(cert)
+		subject := g.node("dn:"+label, label, false)
+		issuer := g.node("dn:"+cert.Issuer.String(), cert.Issuer.String(), false)
+
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		key := g.node(
+			"key:"+string(sum[:]),
+			fmt.Sprintf("%v key %v", cert.PublicKeyAlgorithm, hex.EncodeToString(sum[:8])),
+			true,
+		)
+
+		g.edge(graphEdge{from: issuer, to: subject, label: "issued"})
+		g.edge(graphEdge{from: subject, to: key, label: "key"})
+	}
+
+	return g
+}
+
+// subjectLabel of cert, falling back to its first DNS name when the subject is empty
+func subjectLabel(cert *x509.Certificate) string {
+	if s := cert.Subject.String(); s != "" {
+		return s
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+
+	return "(empty subject)"
+}
+
+func (g *certificateGraph) node(k string, label string, key bool) string {
+	if id, ok := g.ids[k]; ok {
+		return id
+	}
+
+	id := fmt.Sprintf("n%d", len(g.nodes))
+	g.ids[k] = id
+	g.nodes = append(g.nodes, graphNode{id: id, label: label, key: key})
+
+	return id
+}
+
+func (g *certificateGraph) edge(e graphEdge) {
+	if _, ok := g.edged[e]; ok {
+		return
+	}
+	g.edged[e] = struct{}{}
+	g.edges = append(g.edges, e)
+}
+
+// writeDOT for Graphviz
+func (g *certificateGraph) writeDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+	fmt.Fprintln(bw, "digraph findcert {")
+	fmt.Fprintln(bw, "  rankdir=LR;")
+	for _, n := range g.nodes {
+		shape := "box"
+		if n.key {
+			shape = "ellipse"
+		}
+		fmt.Fprintf(bw, "  %v [label=\"%v\", shape=%v];\n", n.id, quote.Replace(n.label), shape)
+	}
+	for _, e := range g.edges {
+		fmt.Fprintf(bw, "  %v -> %v [label=\"%v\"];\n", e.from, e.to, e.label)
+	}
+	fmt.Fprintln(bw, "}")
+
+	return bw.Flush()
+}
+
+// writeMermaid flowchart
+func (g *certificateGraph) writeMermaid(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	// mermaid labels cannot contain raw quotes, use its HTML entity instead
+	quote := strings.NewReplacer(`"`, "#quot;")
+
+	fmt.Fprintln(bw, "flowchart LR")
+	for _, n := range g.nodes {
+		if n.key {
+			fmt.Fprintf(bw, "  %v([\"%v\"])\n", n.id, quote.Replace(n.label))
+		} else {
+			fmt.Fprintf(bw, "  %v[\"%v\"]\n", n.id, quote.Replace(n.label))
+		}
+	}
+	for _, e := range g.edges {
+		fmt.Fprintf(bw, "  %v -->|%v| %v\n", e.from, e.label, e.to)
+	}
+
+	return bw.Flush()
+}
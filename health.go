@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	crtshURL = "https://crt.sh/"
+	// logListURL is Google's list of Certificate Transparency logs trusted by Chrome
+	logListURL = "https://www.gstatic.com/ct/log_list/v3/log_list.json"
+)
+
+var (
+	errUnhealthy     = errors.New("one or more backends are unhealthy")
+	errHTTPStatus    = errors.New("unexpected HTTP status")
+	errStaleLogList  = errors.New("log list is stale")
+	errNoLogListTime = errors.New("log list has no log_list_timestamp")
+)
+
+// healthCheck of a backend, returning a detail worth printing when it is healthy
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) (string, error)
+}
+
+// healthResult of running a healthCheck
+type healthResult struct {
+	name    string
+	latency time.Duration
+	detail  string
+	err     error
+}
+
+// checkPostgres connects and authenticates to a crt.sh database host
+func checkPostgres(host string) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		var version string
+		err := useDB(host, func(db *sql.DB) error {
+			return db.QueryRowContext(ctx, "SHOW server_version;").Scan(&version)
+		})
+		if err != nil {
+			return "", fmt.Errorf("could not query postgres (%w)", err)
+		}
+
+		return "server version " + version, nil
+	}
+}
+
+// checkHTTP that url responds with 200 OK
+func checkHTTP(url string) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+		if err != nil {
+			return "", fmt.Errorf("could not create request (%w)", err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("could not reach (%v) (%w)", url, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("%w (%v)", errHTTPStatus, resp.Status)
+		}
+
+		return resp.Status, nil
+	}
+}
+
+// checkLogList that the CT log list was published within maxAge
+func checkLogList(maxAge time.Duration) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, logListURL, nil)
+		if err != nil {
+			return "", fmt.Errorf("could not create request (%w)", err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("could not fetch log list (%w)", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("%w (%v)", errHTTPStatus, resp.Status)
+		}
+
+		var list struct {
+			Timestamp time.Time `json:"log_list_timestamp"`
+		}
+		if err = json.NewDecoder(io.LimitReader(resp.Body, 1<<24)).Decode(&list); err != nil {
+			return "", fmt.Errorf("could not decode log list (%w)", err)
+		}
+		if list.Timestamp.IsZero() {
+			return "", errNoLogListTime
+		}
+
+		age := time.Since(list.Timestamp).Round(time.Minute)
+		if age > maxAge {
+			return "", fmt.Errorf("%w, published (%v) ago", errStaleLogList, age)
+		}
+
+		return fmt.Sprintf("published %v ago", age), nil
+	}
+}
+
+// runHealthChecks concurrently, each within timeout, in the order given
+func runHealthChecks(ctx context.Context, checks []healthCheck, timeout time.Duration) []healthResult {
+	results := make([]healthResult, len(checks))
+
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c healthCheck) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			detail, err := c.check(checkCtx)
+			results[i] = healthResult{name: c.name, latency: time.Since(start), detail: detail, err: err}
+		}(i, c)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func runHealth(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	timeout := fs.Duration("timeout", 10*time.Second, "time each backend has to respond")
+	maxLogListAge := fs.Duration("max-log-list-age", 72*time.Hour, "oldest the CT log list may be before it is reported stale")
+	splunkURL := fs.String("splunk-health-url", "", "also check a Splunk HEC health endpoint (ex: https://splunk:8088/services/collector/health)")
+	output := addOutputFileFlag(fs)
+	parseFlags(fs, args)
+
+	// each host is checked on its own rather than failing over, a probe should see every replica
+	var checks []healthCheck
+	for _, host := range crtshMirrors.hosts() {
+		checks = append(checks, healthCheck{"postgres (" + host + ")", checkPostgres(host)})
+	}
+	checks = append(checks,
+		healthCheck{"http (crt.sh)", checkHTTP(crtshURL)},
+		healthCheck{"ct log list", checkLogList(*maxLogListAge)},
+	)
+	if *splunkURL != "" {
+		checks = append(checks, healthCheck{"splunk", checkHTTP(*splunkURL)})
+	}
+
+	var failed bool
+	err := writeOutput(*output, func(out io.Writer) error {
+		for _, r := range runHealthChecks(ctx, checks, *timeout) {
+			if r.err != nil {
+				failed = true
+				fmt.Fprintf(out, "Backend: (%v) Status: (FAIL) Latency: (%v) Error: (%v)\n", r.name, r.latency.Round(time.Millisecond), r.err)
+				continue
+			}
+			fmt.Fprintf(out, "Backend: (%v) Status: (OK) Latency: (%v) Detail: (%v)\n", r.name, r.latency.Round(time.Millisecond), r.detail)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if failed {
+		return errUnhealthy
+	}
+
+	return nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errExpectedHistory = errors.New("expected -db history file")
+
+// historyEvent is a certificate observed by a monitor, one JSON object per line of the history file
+type historyEvent struct {
+	ObservedAt time.Time `json:"observed_at"`
+	// Kind is baseline for certificates already logged when monitoring started, new otherwise
+	Kind        string          `json:"kind"`
+	Source      string          `json:"source"`
+	Query       string          `json:"query"`
+	Severity    severity        `json:"severity,omitempty"`
+	Certificate certificateInfo `json:"certificate"`
+}
+
+// historyStore appends each certificate the first time any monitor observes it, it is safe for concurrent use
+type historyStore struct {
+	mu sync.Mutex
+	// f or backend is where events are appended
+	f       *os.File
+	backend stateBackend
+	known   map[string]struct{}
+}
+
+// openHistory at path, a file or a stateBackend URL, for appending, creating it if missing
+func openHistory(path string) (*historyStore, error) {
+	events, err := readHistory(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	h := &historyStore{known: make(map[string]struct{}, len(events))}
+	for _, e := range events {
+		h.known[e.Certificate.SHA256] = struct{}{}
+	}
+
+	if h.backend, err = backendOf(path); err != nil {
+		return nil, err
+	}
+	if h.backend == nil {
+		if h.f, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+			return nil, fmt.Errorf("could not open history (%w)", err)
+		}
+	}
+
+	return h, nil
+}
+
+// record e unless its certificate is already in the history
+func (h *historyStore) record(e historyEvent) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.known[e.Certificate.SHA256]; ok {
+		return nil
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("could not encode history event (%w)", err)
+	}
+	if h.backend != nil {
+		err = h.backend.appendHistory(e.Certificate.SHA256, data)
+	} else if _, err = h.f.Write(append(data, '\n')); err != nil {
+		err = fmt.Errorf("could not write history (%w)", err)
+	}
+	if err != nil {
+		return err
+	}
+	h.known[e.Certificate.SHA256] = struct{}{}
+
+	return nil
+}
+
+// Close the history file, a stateBackend stays open for the rest of the process
+func (h *historyStore) Close() error {
+	if h.f == nil {
+		return nil
+	}
+
+	return h.f.Close()
+}
+
+// readHistory from path, a file or a stateBackend URL, a truncated last line from an interrupted
+// write is skipped
+func readHistory(path string) ([]historyEvent, error) {
+	backend, err := backendOf(path)
+	if err != nil {
+		return nil, err
+	}
+	if backend != nil {
+		encoded, err := backend.loadHistory()
+		if err != nil {
+			return nil, err
+		}
+		events := make([]historyEvent, 0, len(encoded))
+		for i, data := range encoded {
+			var e historyEvent
+			if err = json.Unmarshal(data, &e); err != nil {
+				log.Printf("skipping unreadable event (%v) of history (%v) (%v)\n", i+1, path, err)
+				continue
+			}
+			events = append(events, e)
+		}
+		return events, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open history (%w)", err)
+	}
+	defer f.Close()
+
+	var (
+		events  []historyEvent
+		scanner = bufio.NewScanner(f)
+		line    int
+	)
+	scanner.Buffer(nil, 1<<24)
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var e historyEvent
+		if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			log.Printf("skipping unreadable line (%v) of history (%v) (%v)\n", line, path, err)
+			continue
+		}
+		events = append(events, e)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read history (%w)", err)
+	}
+
+	return events, nil
+}
+
+// historyMatches reports whether any name of the certificate is domain or a subdomain of it
+func historyMatches(info certificateInfo, domains []string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+
+	names := append([]string{info.CommonName}, info.DNSNames...)
+	for _, name := range names {
+		name = strings.TrimPrefix(strings.ToLower(name), "*.")
+		for _, domain := range domains {
+			if name == domain || strings.HasSuffix(name, "."+domain) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// issuerMonth is the number of certificates first seen from an issuer in a month
+type issuerMonth struct {
+	Month  string
+	Issuer string
+	Count  int
+}
+
+// issuersByMonth of events, oldest month first then most certificates
+func issuersByMonth(events []historyEvent) []issuerMonth {
+	counts := make(map[[2]string]int)
+	for _, e := range events {
+		counts[[2]string{e.ObservedAt.UTC().Format("2006-01"), e.Certificate.IssuerName}]++
+	}
+
+	months := make([]issuerMonth, 0, len(counts))
+	for key, count := range counts {
+		months = append(months, issuerMonth{Month: key[0], Issuer: key[1], Count: count})
+	}
+	sort.Slice(months, func(i, j int) bool {
+		switch {
+		case months[i].Month != months[j].Month:
+			return months[i].Month < months[j].Month
+		case months[i].Count != months[j].Count:
+			return months[i].Count > months[j].Count
+		}
+		return months[i].Issuer < months[j].Issuer
+	})
+
+	return months
+}
+
+func runHistory(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	db := fs.String("db", "", "history file written by findcert daemon or watch -history")
+	since := fs.Duration("since", 0, "only certificates first seen within this long (ex: 720h)")
+	issuers := fs.Bool("issuers", false, "print the issuers of certificates by month first seen instead of each certificate")
+	output := addOutputFileFlag(fs)
+	parseFlags(fs, args)
+
+	if *db == "" {
+		return errExpectedHistory
+	}
+
+	all, err := readHistory(*db)
+	if err != nil {
+		return err
+	}
+
+	domains := make([]string, 0, fs.NArg())
+	for _, arg := range fs.Args() {
+		domains = append(domains, strings.ToLower(arg))
+	}
+
+	var events []historyEvent
+	for _, e := range all {
+		if *since > 0 && time.Since(e.ObservedAt) > *since {
+			continue
+		}
+		if historyMatches(e.Certificate, domains) {
+			events = append(events, e)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].ObservedAt.Before(events[j].ObservedAt)
+	})
+
+	return writeOutput(*output, func(out io.Writer) error {
+		if *issuers {
+			for _, m := range issuersByMonth(events) {
+				fmt.Fprintf(out, "%v %6v %v\n", m.Month, m.Count, m.Issuer)
+			}
+		} else {
+			for _, e := range events {
+				fmt.Fprintf(out, "First Seen: (%v) Kind: (%v) CommonName: (%v) Issuer: (%v) Query: (%v) SHA-256: (%v)\n",
+					e.ObservedAt.Format(time.RFC3339), e.Kind, e.Certificate.displayName(), e.Certificate.IssuerName, e.Query, e.Certificate.SHA256)
+			}
+		}
+
+		counts := make(map[string]int)
+		for _, e := range events {
+			counts[e.Kind]++
+		}
+		fmt.Fprintf(out, "Certificates: (%v) New: (%v) Baseline: (%v)\n", len(events), counts["new"], counts["baseline"])
+
+		return nil
+	})
+}
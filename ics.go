@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const icsTimeFormat = "20060102T150405Z"
+
+// writeICS as an iCalendar with one event at each certificate's NotAfter,
+// alarm is how long before expiry to remind, 0 disables the reminder
+func writeICS(w io.Writer, infos []certificateInfo, alarm time.Duration) error {
+	bw := bufio.NewWriter(w)
+	now := time.Now().UTC().Format(icsTimeFormat)
+
+	line := func(s string) {
+		// fold content lines longer than 75 octets as required by RFC 5545,
+		// continuation lines lose one octet to the leading space
+		limit := 75
+		for len(s) > limit {
+			cut := limit
+			for cut > 0 && s[cut]&0xC0 == 0x80 {
+				cut--
+			}
+			bw.WriteString(s[:cut] + "\r\n ")
+			s = s[cut:]
+			limit = 74
+		}
+		bw.WriteString(s + "\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//simplylib//findcert//EN")
+	line("CALSCALE:GREGORIAN")
+
+	for _, info := range infos {
+		name := info.displayName()
+
+		line("BEGIN:VEVENT")
+		line("UID:" + info.SHA256 + "@findcert")
+		line("DTSTAMP:" + now)
+		line("DTSTART:" + info.NotAfter.UTC().Format(icsTimeFormat))
+		line("SUMMARY:" + icsEscape("Certificate expires: "+name))
+		line("DESCRIPTION:" + icsEscape(fmt.Sprintf(
+			"Names: %v\nIssuer: %v\nSerial: %v\nSHA-256: %v\nhttps://crt.sh/?sha256=%v",
+			strings.Join(info.DNSNames, ", "),
+			info.Issuer,
+			info.Serial,
+			info.SHA256,
+			info.SHA256,
+		)))
+
+		if alarm > 0 {
+			line("BEGIN:VALARM")
+			line("ACTION:DISPLAY")
+			line("DESCRIPTION:" + icsEscape("Certificate for "+name+" expires soon"))
+			line("TRIGGER:-" + icsDuration(alarm))
+			line("END:VALARM")
+		}
+
+		line("END:VEVENT")
+	}
+
+	line("END:VCALENDAR")
+
+	return bw.Flush()
+}
+
+// icsEscape TEXT values per RFC 5545 section 3.3.11
+func icsEscape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// icsDuration formats d as an RFC 5545 dur-value to the second, ex: P30D, PT1H30M or PT45S, a
+// dur-time needs at least one of its parts so anything under a second is PT0S
+func icsDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d <= 0 {
+		return "PT0S"
+	}
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("P%dD", d/(24*time.Hour))
+	}
+
+	s := "PT"
+	if h := d / time.Hour; h > 0 {
+		s += fmt.Sprintf("%dH", h)
+	}
+	if m := (d % time.Hour) / time.Minute; m > 0 {
+		s += fmt.Sprintf("%dM", m)
+	}
+	if sec := (d % time.Minute) / time.Second; sec > 0 {
+		s += fmt.Sprintf("%dS", sec)
+	}
+
+	return s
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestICSDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{d: 30 * 24 * time.Hour, want: "P30D"},
+		{d: 90 * time.Minute, want: "PT1H30M"},
+		{d: 2 * time.Hour, want: "PT2H"},
+		{d: 36 * time.Hour, want: "PT36H"},
+		{d: 45 * time.Second, want: "PT45S"},
+		{d: time.Minute + 5*time.Second, want: "PT1M5S"},
+		{d: 300 * time.Millisecond, want: "PT0S"},
+		{d: 0, want: "PT0S"},
+	}
+
+	for _, tt := range tests {
+		if got := icsDuration(tt.d); got != tt.want {
+			t.Errorf("icsDuration(%v) = (%v), want (%v)", tt.d, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// punycodePrefix marks an internationalized label encoded as ASCII
+const punycodePrefix = "xn--"
+
+// toASCII lowercases domain and encodes each label containing non-ASCII characters per UTS #46 for
+// lookup, so a Unicode name matches how it is logged
+func toASCII(domain string) (string, error) {
+	labels := strings.Split(strings.ToLower(domain), ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		if strings.ContainsAny(label, "%_") {
+			return "", fmt.Errorf("%w (%v)", errWildcardUnicode, label)
+		}
+
+		encoded, err := idna.Lookup.ToASCII(label)
+		if err != nil {
+			return "", fmt.Errorf("could not encode label (%v) (%w)", label, err)
+		}
+		labels[i] = encoded
+	}
+
+	return strings.Join(labels, "."), nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
+
+var (
+	errWildcardUnicode = errors.New("cannot punycode encode a label containing LIKE wildcards")
+	latinConfusables   = make(map[rune]rune)
+	idnScripts         = []struct {
+		name  string
+		table *unicode.RangeTable
+	}{
+		{"Latin", unicode.Latin},
+		{"Cyrillic", unicode.Cyrillic},
+		{"Greek", unicode.Greek},
+		{"Armenian", unicode.Armenian},
+		{"Cherokee", unicode.Cherokee},
+		{"Georgian", unicode.Georgian},
+		{"Hebrew", unicode.Hebrew},
+		{"Arabic", unicode.Arabic},
+		{"Devanagari", unicode.Devanagari},
+		{"Thai", unicode.Thai},
+		// Chinese, Japanese and Korean names legitimately mix these scripts
+		{"CJK", unicode.Han},
+		{"CJK", unicode.Hiragana},
+		{"CJK", unicode.Katakana},
+		{"CJK", unicode.Hangul},
+	}
+)
+
+func init() {
+	for latin, glyphs := range unicodeHomoglyphs {
+		for _, glyph := range glyphs {
+			latinConfusables[glyph] = latin
+		}
+	}
+}
+
+// toUnicode decodes each xn-- label of name, labels that fail to decode are left as is
+func toUnicode(name string) string {
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if len(label) < len(punycodePrefix) || !strings.EqualFold(label[:len(punycodePrefix)], punycodePrefix) {
+			continue
+		}
+
+		if decoded, err := idna.Display.ToUnicode(label); err == nil {
+			labels[i] = decoded
+		}
+	}
+
+	return strings.Join(labels, ".")
+}
+
+// displayIDN shows name with its Unicode form when it is internationalized
+func displayIDN(name string) string {
+	if u := toUnicode(name); u != name {
+		return name + " (" + u + ")"
+	}
+
+	return name
+}
+
+// idnWarnings for labels of name mixing scripts or written entirely in look-alikes of Latin letters
+func idnWarnings(name string) []string {
+	unicodeName := toUnicode(name)
+	if unicodeName == name {
+		return nil
+	}
+
+	var warnings []string
+	for _, label := range strings.Split(unicodeName, ".") {
+		if isASCII(label) {
+			continue
+		}
+
+		scripts := make(map[string]struct{})
+		confusable := true
+		var latin strings.Builder
+		for _, r := range label {
+			if !unicode.IsLetter(r) {
+				latin.WriteRune(r)
+				continue
+			}
+
+			for _, s := range idnScripts {
+				if unicode.Is(s.table, r) {
+					scripts[s.name] = struct{}{}
+					break
+				}
+			}
+
+			switch l, ok := latinConfusables[r]; {
+			case ok:
+				latin.WriteRune(l)
+			case r < utf8.RuneSelf:
+				latin.WriteRune(r)
+			default:
+				confusable = false
+			}
+		}
+
+		switch {
+		case len(scripts) > 1:
+			warnings = append(warnings, fmt.Sprintf("mixed-script name %v", displayIDN(name)))
+		case confusable:
+			warnings = append(warnings, fmt.Sprintf("name %v is confusable with %v", displayIDN(name), latin.String()))
+		}
+	}
+
+	return warnings
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestToASCII(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   string
+		err    error
+	}{
+		{domain: "Example.COM", want: "example.com"},
+		{domain: "bücher.example", want: "xn--bcher-kva.example"},
+		{domain: "BÜCHER.example", want: "xn--bcher-kva.example"},
+		{domain: "%.bücher.example", want: "%.xn--bcher-kva.example"},
+		// UTS #46 maps fullwidth letters to ASCII
+		{domain: "ｅｘａｍｐｌｅ.com", want: "example.com"},
+		{domain: "例え.テスト", want: "xn--r8jz45g.xn--zckzah"},
+		{domain: "%ü.example", err: errWildcardUnicode},
+	}
+
+	for _, tt := range tests {
+		got, err := toASCII(tt.domain)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("toASCII(%q) = (%q) (%v), want (%q) (%v)", tt.domain, got, err, tt.want, tt.err)
+		}
+	}
+
+	// labels UTS #46 doesn't allow are rejected rather than encoded
+	if _, err := toASCII("a‍b.example"); err == nil {
+		t.Error("toASCII of a label with a bare zero width joiner succeeded")
+	}
+}
+
+func TestToUnicode(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "example.com", want: "example.com"},
+		{name: "xn--bcher-kva.example", want: "bücher.example"},
+		{name: "XN--BCHER-KVA.example", want: "bücher.example"},
+		{name: "*.xn--r8jz45g.xn--zckzah", want: "*.例え.テスト"},
+		// invalid punycode is left as is
+		{name: "xn--a!.example", want: "xn--a!.example"},
+	}
+
+	for _, tt := range tests {
+		if got := toUnicode(tt.name); got != tt.want {
+			t.Errorf("toUnicode(%q) = (%q), want (%q)", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIDNWarnings(t *testing.T) {
+	paypal, err := toASCII("pаypal.com") // Cyrillic а
+	if err != nil {
+		t.Fatal(err)
+	}
+	apple, err := toASCII("аррӏе.com") // all Cyrillic
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		warnings int
+	}{
+		{name: "example.com"},
+		{name: "xn--bcher-kva.example"},
+		{name: paypal, warnings: 1},
+		{name: apple, warnings: 1},
+	}
+
+	for _, tt := range tests {
+		if got := idnWarnings(tt.name); len(got) != tt.warnings {
+			t.Errorf("idnWarnings(%q) = (%q), want (%v) warnings", tt.name, got, tt.warnings)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+	opsgenieAlertsURL  = "https://api.opsgenie.com/v2/alerts"
+	// opsgenieMaxMessage is the longest message Opsgenie accepts for an alert
+	opsgenieMaxMessage = 130
+)
+
+var (
+	errPagerDutyKey = errors.New("pagerduty notifier needs token (an Events API v2 routing key) or $PAGERDUTY_ROUTING_KEY")
+	errOpsgenieKey  = errors.New("opsgenie notifier needs token (an API key) or $OPSGENIE_API_KEY")
+)
+
+// incidentKey deduplicates incidents of event, the same certificate found again by another monitor
+// or after a restart updates its open incident rather than opening another
+func incidentKey(event any) string {
+	if e, ok := event.(certificateEvent); ok && e.Certificate.SHA256 != "" {
+		return "findcert-" + e.Certificate.SHA256
+	}
+
+	return ""
+}
+
+// incidentSummary of an event from its message, the first line
+func incidentSummary(msg string) string {
+	summary, _, _ := strings.Cut(msg, "\n")
+	return summary
+}
+
+// newPagerDutySink triggers PagerDuty incidents by the Events API v2, url is only needed for a proxy
+func newPagerDutySink(cfg notifierConfig) (eventSink, error) {
+	key := cfg.Token
+	if key == "" {
+		key = os.Getenv("PAGERDUTY_ROUTING_KEY")
+	}
+	if key == "" {
+		return nil, errPagerDutyKey
+	}
+
+	url := cfg.URL
+	if url == "" {
+		url = pagerDutyEventsURL
+	}
+
+	text, err := cfg.message()
+	if err != nil {
+		return nil, err
+	}
+
+	return newWebhookSink(url, withMessage(text, func(msg, source string, event any) ([]byte, error) {
+		return formatPagerDuty(key, msg, source, event)
+	})), nil
+}
+
+// pagerDutySeverity of sev, PagerDuty has no severity between warning and critical
+func pagerDutySeverity(sev severity) string {
+	switch sev {
+	case severityCritical:
+		return "critical"
+	case severityWarning:
+		return "warning"
+	}
+
+	return "info"
+}
+
+// formatPagerDuty as a trigger event of the Events API v2 for routingKey
+func formatPagerDuty(routingKey, msg, source string, event any) ([]byte, error) {
+	type payload struct {
+		Summary       string    `json:"summary"`
+		Source        string    `json:"source"`
+		Severity      string    `json:"severity"`
+		Timestamp     time.Time `json:"timestamp"`
+		Component     string    `json:"component,omitempty"`
+		Class         string    `json:"class,omitempty"`
+		CustomDetails any       `json:"custom_details"`
+	}
+
+	p := payload{
+		Summary:       incidentSummary(msg),
+		Source:        "findcert " + source,
+		Severity:      "info",
+		Timestamp:     time.Now().UTC(),
+		CustomDetails: event,
+	}
+	p.Severity = pagerDutySeverity(eventSeverity(event))
+	if e, ok := event.(certificateEvent); ok {
+		p.Component, p.Class = e.Query, "certificate"
+	}
+
+	return json.Marshal(struct {
+		RoutingKey  string  `json:"routing_key"`
+		EventAction string  `json:"event_action"`
+		DedupKey    string  `json:"dedup_key,omitempty"`
+		Payload     payload `json:"payload"`
+	}{routingKey, "trigger", incidentKey(event), p})
+}
+
+// newOpsgenieSink creates Opsgenie alerts, url may be the EU instance's (ex:
+// https://api.eu.opsgenie.com/v2/alerts)
+func newOpsgenieSink(cfg notifierConfig) (eventSink, error) {
+	key := cfg.Token
+	if key == "" {
+		key = os.Getenv("OPSGENIE_API_KEY")
+	}
+	if key == "" {
+		return nil, errOpsgenieKey
+	}
+
+	url := cfg.URL
+	if url == "" {
+		url = opsgenieAlertsURL
+	}
+
+	text, err := cfg.message()
+	if err != nil {
+		return nil, err
+	}
+
+	s := newWebhookSink(url, withMessage(text, formatOpsgenie))
+	s.header = http.Header{"Authorization": {"GenieKey " + key}}
+
+	return s, nil
+}
+
+// opsgeniePriority of sev, P1 is the most urgent
+func opsgeniePriority(sev severity) string {
+	switch sev {
+	case severityCritical:
+		return "P1"
+	case severityWarning:
+		return "P3"
+	}
+
+	return "P5"
+}
+
+// formatOpsgenie as an alert of the Opsgenie Alert API, aliased so one is open per certificate
+func formatOpsgenie(msg, source string, event any) ([]byte, error) {
+	alert := struct {
+		Message     string            `json:"message"`
+		Alias       string            `json:"alias,omitempty"`
+		Description string            `json:"description"`
+		Source      string            `json:"source"`
+		Priority    string            `json:"priority"`
+		Tags        []string          `json:"tags"`
+		Details     map[string]string `json:"details,omitempty"`
+	}{
+		Message:     incidentSummary(msg),
+		Alias:       incidentKey(event),
+		Description: msg,
+		Source:      "findcert " + source,
+		Priority:    opsgeniePriority(eventSeverity(event)),
+		Tags:        []string{"findcert"},
+	}
+	if sev := eventSeverity(event); sev != 0 {
+		alert.Tags = append(alert.Tags, sev.String())
+	}
+	if message := []rune(alert.Message); len(message) > opsgenieMaxMessage {
+		alert.Message = string(message[:opsgenieMaxMessage-3]) + "..."
+	}
+
+	if e, ok := event.(certificateEvent); ok {
+		c := e.Certificate
+		alert.Details = map[string]string{
+			"query":      e.Query,
+			"sha256":     c.SHA256,
+			"issuer":     c.IssuerName,
+			"names":      strings.Join(c.DNSNames, ", "),
+			"not_before": c.NotBefore.Format(time.RFC3339),
+			"not_after":  c.NotAfter.Format(time.RFC3339),
+		}
+	}
+
+	return json.Marshal(alert)
+}
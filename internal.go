@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// internalSuffixes are name suffixes reserved or conventionally used for private networks
+var internalSuffixes = []string{
+	".local", ".localdomain", ".internal", ".intranet", ".lan", ".corp", ".home", ".home.arpa", ".private", ".localhost",
+}
+
+// internalLabels are labels that on their own suggest a host is not meant to be public
+var internalLabels = map[string]struct{}{
+	"localhost": {},
+	"intranet":  {},
+	"internal":  {},
+	"corp":      {},
+	"lan":       {},
+}
+
+// internalWarnings for private addresses and internal hostnames leaked into a publicly logged cert
+func internalWarnings(cert *x509.Certificate) []string {
+	var warnings []string
+
+	for _, ip := range cert.IPAddresses {
+		if isPrivateIP(ip) {
+			warnings = append(warnings, fmt.Sprintf("private IP address %v", ip))
+		}
+	}
+
+	for _, name := range certificateNames(cert) {
+		if reason := internalNameReason(name); reason != "" {
+			warnings = append(warnings, fmt.Sprintf("internal name %v (%v)", name, reason))
+		}
+	}
+
+	return warnings
+}
+
+// internalNameReason describes why name looks internal, empty if it does not
+func internalNameReason(name string) string {
+	name = strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(name, "*."), "."))
+
+	if ip := net.ParseIP(name); ip != nil {
+		if isPrivateIP(ip) {
+			return "private IP address"
+		}
+		return ""
+	}
+
+	if !strings.Contains(name, ".") {
+		return "single label name"
+	}
+
+	for _, suffix := range internalSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return "reserved " + suffix + " suffix"
+		}
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if _, ok := internalLabels[label]; ok {
+			return "label " + label
+		}
+	}
+
+	return ""
+}
+
+// isPrivateIP reports RFC 1918, RFC 4193, loopback and link-local addresses
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified()
+}
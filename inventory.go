@@ -0,0 +1,466 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// inventoryAsset is a hostname of an organization with the certificate CT says covers it and what
+// probing it found
+type inventoryAsset struct {
+	Name string `json:"name"`
+	Apex string `json:"apex"`
+	// certificate from CT covering the name, the valid one expiring last, else the last to expire
+	CrtshID     int64     `json:"crtsh_id,omitempty"`
+	SHA256      string    `json:"sha256"`
+	Issuer      string    `json:"issuer"`
+	NotAfter    time.Time `json:"not_after"`
+	ViaWildcard bool      `json:"via_wildcard,omitempty"`
+	// DNS status of the name by -dns-precheck: resolved, nxdomain, nodata or error, only resolved
+	// and error names are probed
+	DNS string `json:"dns,omitempty"`
+	// IPs the name resolved to and whether a TLS handshake succeeded, and with which certificate
+	IPs          []string `json:"ips,omitempty"`
+	Live         bool     `json:"live"`
+	ServedSHA256 string   `json:"served_sha256,omitempty"`
+	// Addresses probed one by one with -all-addresses, SplitCertificates when live ones served
+	// different certificates (ex: split-horizon DNS or a partial migration)
+	Addresses         []probedAddress `json:"addresses,omitempty"`
+	SplitCertificates bool            `json:"split_certificates,omitempty"`
+	// Stapled when the handshake included an OCSP response, described by Staple if it could be parsed
+	Stapled bool        `json:"ocsp_stapled"`
+	Staple  *ocspStaple `json:"ocsp_staple,omitempty"`
+	// TLS grade of the host, with -grade
+	TLS *tlsGrade `json:"tls,omitempty"`
+}
+
+// inventoryNames of apex in results, the concrete names equal to or under it
+func inventoryNames(apex string, results []result) []string {
+	seen := make(map[string]struct{})
+	for _, r := range results {
+		for _, name := range r.cert().DNSNames {
+			name = strings.ToLower(name)
+			if strings.HasPrefix(name, "*.") || (name != apex && !strings.HasSuffix(name, "."+apex)) {
+				continue
+			}
+			seen[name] = struct{}{}
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// coveringCertificate of name in results at now, preferring valid certificates then the latest expiry,
+// and whether it covers name by a wildcard
+func coveringCertificate(name string, results []result, now time.Time) (best result, viaWildcard bool, ok bool) {
+	var bestValid bool
+	for _, r := range results {
+		exact, wildcard := false, false
+		for _, n := range r.cert().DNSNames {
+			n = strings.ToLower(n)
+			exact = exact || n == name
+			wildcard = wildcard || wildcardCovers(n, name)
+		}
+		if !exact && !wildcard {
+			continue
+		}
+
+		valid := now.After(r.cert().NotBefore) && now.Before(r.cert().NotAfter)
+		if ok && (bestValid && !valid || bestValid == valid && !r.cert().NotAfter.After(best.cert().NotAfter)) {
+			continue
+		}
+		best, viaWildcard, ok, bestValid = r, !exact, true, valid
+	}
+
+	return best, viaWildcard, ok
+}
+
+// IP families probes may prefer or be limited to
+const (
+	ipFamilyAny     = "any"
+	ipFamilyV4      = "ipv4"
+	ipFamilyV6      = "ipv6"
+	ipFamilyV4Only  = "ipv4-only"
+	ipFamilyV6Only  = "ipv6-only"
+	ipFamilyAllowed = "any, ipv4, ipv6, ipv4-only or ipv6-only"
+)
+
+// sniNone as -sni sends no server name in probe handshakes
+const sniNone = "none"
+
+var (
+	errIPFamily = errors.New("unknown IP family, expected " + ipFamilyAllowed)
+	errPort     = errors.New("expected a port between 1 and 65535")
+)
+
+// probeOptions of how probeAsset connects to a name
+type probeOptions struct {
+	port string
+	// sni sent in handshakes instead of the name probed, sniNone to send none
+	sni     string
+	timeout time.Duration
+	// grade the TLS configuration of live names
+	grade bool
+	// family of addresses dialed first, or only with an -only family
+	family string
+	// allAddresses dials every address of a name rather than the first that answers
+	allAddresses bool
+}
+
+// serverName sent when probing name
+func (o probeOptions) serverName(name string) string {
+	switch o.sni {
+	case "":
+		return name
+	case sniNone:
+		return ""
+	}
+
+	return o.sni
+}
+
+// probedAddress is what one address of a name served
+type probedAddress struct {
+	IP           string `json:"ip"`
+	Live         bool   `json:"live"`
+	ServedSHA256 string `json:"served_sha256,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// orderAddresses of ips for family, those of the preferred family first and the other left out for
+// an -only family, otherwise in resolved order
+func orderAddresses(ips []string, family string) []string {
+	var v4, v6 []string
+	for _, ip := range ips {
+		if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+
+	switch family {
+	case ipFamilyV4:
+		return append(v4, v6...)
+	case ipFamilyV6:
+		return append(v6, v4...)
+	case ipFamilyV4Only:
+		return v4
+	case ipFamilyV6Only:
+		return v6
+	}
+
+	return ips
+}
+
+// probeAsset resolving its name, unless the DNS pre-check already did, and attempting a TLS handshake
+// with its addresses in the order of opts' family, each within opts' timeout. With opts' allAddresses
+// every address is dialed and reported, the first live one standing for the name
+func probeAsset(ctx context.Context, a *inventoryAsset, opts probeOptions) {
+	if len(a.IPs) == 0 {
+		lookupCtx, cancel := context.WithTimeout(ctx, opts.timeout)
+		addrs, err := net.DefaultResolver.LookupIPAddr(lookupCtx, a.Name)
+		cancel()
+		if err != nil {
+			return
+		}
+		for _, addr := range addrs {
+			a.IPs = append(a.IPs, addr.String())
+		}
+	}
+
+	dialer := tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: opts.timeout},
+		// only whether the host answers and with what certificate matters, it is not trusted with anything
+		Config: &tls.Config{ServerName: opts.serverName(a.Name), InsecureSkipVerify: true},
+	}
+
+	var (
+		state tls.ConnectionState
+		addr  string
+	)
+	// the addresses are dialed in turn rather than resolving the name again
+	for _, ip := range orderAddresses(a.IPs, opts.family) {
+		dialCtx, cancel := context.WithTimeout(ctx, opts.timeout)
+		conn, err := dialer.DialContext(dialCtx, "tcp", net.JoinHostPort(ip, opts.port))
+		cancel()
+
+		probed := probedAddress{IP: ip}
+		if err != nil {
+			probed.Error = err.Error()
+		} else {
+			probed.Live = true
+			s := conn.(*tls.Conn).ConnectionState()
+			conn.Close()
+			if len(s.PeerCertificates) > 0 {
+				sum := sha256.Sum256(s.PeerCertificates[0].Raw)
+				probed.ServedSHA256 = hex.EncodeToString(sum[:])
+			}
+			if !a.Live {
+				a.Live, a.ServedSHA256, state, addr = true, probed.ServedSHA256, s, net.JoinHostPort(ip, opts.port)
+			}
+		}
+
+		if !opts.allAddresses {
+			if a.Live {
+				break
+			}
+			continue
+		}
+		a.Addresses = append(a.Addresses, probed)
+		if probed.Live && probed.ServedSHA256 != a.ServedSHA256 {
+			a.SplitCertificates = true
+		}
+	}
+	if !a.Live || len(state.PeerCertificates) == 0 {
+		return
+	}
+
+	if len(state.OCSPResponse) > 0 {
+		a.Stapled = true
+		a.Staple, _ = parseOCSPStaple(state.OCSPResponse, state.PeerCertificates[0], time.Now())
+	}
+
+	if opts.grade {
+		a.TLS = gradeTLS(ctx, opts.serverName(a.Name), addr, opts.timeout, state)
+	}
+}
+
+func runInventory(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	domainsFile := fs.String("domains-file", "", "read apex domains from this file, one per line, as well as the arguments")
+	limit := fs.Int("n", 1000, "number of latest entries to check per apex domain")
+	probe := fs.Bool("probe", true, "resolve each name and attempt a TLS handshake to see if it is live and staples a fresh OCSP response")
+	port := fs.Int("port", 443, "port to attempt TLS handshakes on (ex: 465 or 993 for mail, 636 for LDAPS), the service must start with TLS rather than STARTTLS")
+	sni := fs.String("sni", "", "server name to send in TLS handshakes instead of each name probed, for hosts behind SNI-routing proxies, or none to send no server name")
+	timeout := fs.Duration("timeout", 5*time.Second, "time to resolve and handshake with each name")
+	grade := fs.Bool("grade", false, "with -probe, also grade the TLS versions each live host offers and whether it serves a complete chain")
+	concurrency := fs.Int("concurrency", 16, "names to probe at once")
+	precheck := fs.Bool("dns-precheck", false, "with -probe, resolve every name first and skip probing those that don't exist or have no addresses, faster on large portfolios")
+	doh := fs.String("doh", "", "with -dns-precheck, resolve over DNS over HTTPS at this URL (ex: https://cloudflare-dns.com/dns-query) instead of the system resolver")
+	dnsConcurrency := fs.Int("dns-concurrency", 64, "names to resolve at once with -dns-precheck")
+	ipFamily := fs.String("ip-family", ipFamilyAny, "family of addresses to dial first when probing, any, ipv4 or ipv6, or ipv4-only or ipv6-only to dial no others")
+	allAddresses := fs.Bool("all-addresses", false, "probe every A and AAAA address of a name and report the certificate each serves, to catch split-horizon or partially migrated deployments")
+	format := fs.String("format", "text", "output format: text, csv or json")
+	output := addOutputFileFlag(fs)
+	parseFlags(fs, args)
+
+	switch *format {
+	case "text", "csv", "json":
+	default:
+		return fmt.Errorf("%w (%v)", errUnknownFormat, *format)
+	}
+
+	if *port < 1 || *port > 65535 {
+		return fmt.Errorf("%w (%v)", errPort, *port)
+	}
+
+	switch *ipFamily {
+	case ipFamilyAny, ipFamilyV4, ipFamilyV6, ipFamilyV4Only, ipFamilyV6Only:
+	default:
+		return fmt.Errorf("%w (%v)", errIPFamily, *ipFamily)
+	}
+
+	apexes := fs.Args()
+	if *domainsFile != "" {
+		fromFile, err := readDomainsFile(*domainsFile)
+		if err != nil {
+			return err
+		}
+		apexes = append(apexes, fromFile...)
+	}
+	if len(apexes) == 0 {
+		return errExpectedDomains
+	}
+
+	var dns *dnsPrecheck
+	if *probe && *precheck {
+		var err error
+		if dns, err = newDNSPrecheck(*doh, *timeout); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	var assets []*inventoryAsset
+	for _, apex := range apexes {
+		apex = strings.ToLower(apex)
+		set, err := newPatternSet([]string{apex, "%." + apex}, nil, nil)
+		if err != nil {
+			return err
+		}
+		results, err := getCertificatesByPatterns(ctx, set, *limit)
+		if err != nil {
+			return fmt.Errorf("could not getCertificates of (%v) error (%w)", apex, err)
+		}
+
+		for _, name := range inventoryNames(apex, results) {
+			a := &inventoryAsset{Name: name, Apex: apex}
+			if r, viaWildcard, ok := coveringCertificate(name, results, now); ok {
+				info := r.info()
+				a.CrtshID, a.SHA256, a.Issuer, a.NotAfter, a.ViaWildcard = info.ID, info.SHA256, info.IssuerName, info.NotAfter, viaWildcard
+			}
+			assets = append(assets, a)
+		}
+	}
+
+	if *probe {
+		if dns != nil {
+			dns.run(ctx, assets, *dnsConcurrency)
+		}
+
+		var (
+			wg    sync.WaitGroup
+			slots = make(chan struct{}, *concurrency)
+		)
+		for _, a := range assets {
+			// a name that doesn't resolve can only time out
+			if a.DNS == dnsNXDomain || a.DNS == dnsNoData {
+				continue
+			}
+			wg.Add(1)
+			slots <- struct{}{}
+			go func(a *inventoryAsset) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				probeAsset(ctx, a, probeOptions{
+					port:         strconv.Itoa(*port),
+					sni:          *sni,
+					timeout:      *timeout,
+					grade:        *grade,
+					family:       *ipFamily,
+					allAddresses: *allAddresses,
+				})
+			}(a)
+		}
+		wg.Wait()
+	}
+
+	return writeOutput(*output, func(out io.Writer) error {
+		switch *format {
+		case "csv":
+			return writeInventoryCSV(out, assets)
+		case "json":
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(assets); err != nil {
+				return fmt.Errorf("could not write JSON (%w)", err)
+			}
+			return nil
+		}
+
+		live := 0
+		for _, a := range assets {
+			status := "-"
+			if a.Live {
+				status = "live"
+				live++
+			}
+			fmt.Fprintf(out, "%-4v %v IPs: (%v) Expires: (%v) Issuer: (%v) SHA-256: (%v)\n",
+				status,
+				displayIDN(a.Name),
+				strings.Join(a.IPs, ", "),
+				a.NotAfter.UTC().Format(time.RFC3339),
+				a.Issuer,
+				a.SHA256,
+			)
+			if a.DNS == dnsNXDomain || a.DNS == dnsNoData {
+				fmt.Fprintf(out, "     not probed, DNS: (%v)\n", a.DNS)
+			}
+			if a.ServedSHA256 != "" && a.ServedSHA256 != a.SHA256 {
+				fmt.Fprintf(out, "     serves a different certificate SHA-256: (%v)\n", a.ServedSHA256)
+			}
+			if a.SplitCertificates {
+				fmt.Fprintf(out, "     serves different certificates on different addresses\n")
+			}
+			for _, addr := range a.Addresses {
+				if addr.Live {
+					fmt.Fprintf(out, "     address (%v) serves SHA-256: (%v)\n", addr.IP, addr.ServedSHA256)
+					continue
+				}
+				fmt.Fprintf(out, "     address (%v) not live (%v)\n", addr.IP, addr.Error)
+			}
+			switch {
+			case a.Staple != nil:
+				fmt.Fprintf(out, "     OCSP staple: (%v) Fresh: (%v) Matches: (%v) Next Update: (%v)\n", a.Staple.Status, a.Staple.Fresh, a.Staple.Matches, a.Staple.NextUpdate)
+			case a.Stapled:
+				fmt.Fprintf(out, "     OCSP staple: (unparseable)\n")
+			case a.Live:
+				fmt.Fprintf(out, "     OCSP staple: (none)\n")
+			}
+			if a.TLS != nil {
+				fmt.Fprintf(out, "     TLS Grade: (%v) Protocols: (%v) Chain Complete: (%v)\n", a.TLS.Grade, strings.Join(a.TLS.Protocols, ", "), a.TLS.ChainComplete)
+				for _, issue := range a.TLS.Issues {
+					fmt.Fprintf(out, "     Warning: (%v)\n", issue)
+				}
+			}
+		}
+		fmt.Fprintf(out, "Names: (%v) Live: (%v)\n", len(assets), live)
+
+		return nil
+	})
+}
+
+// writeInventoryCSV to out, a row per asset with a header
+func writeInventoryCSV(out io.Writer, assets []*inventoryAsset) error {
+	w := csv.NewWriter(out)
+	_ = w.Write([]string{"name", "apex", "live", "ips", "sha256", "served_sha256", "ocsp_stapled", "ocsp_status", "ocsp_fresh", "tls_grade", "issuer", "not_after", "via_wildcard", "crtsh_id", "dns", "addresses", "split_certificates"})
+	for _, a := range assets {
+		var status, fresh, grade string
+		addresses := make([]string, 0, len(a.Addresses))
+		for _, addr := range a.Addresses {
+			addresses = append(addresses, addr.IP+"="+addr.ServedSHA256)
+		}
+		if a.Staple != nil {
+			status, fresh = a.Staple.Status, strconv.FormatBool(a.Staple.Fresh && a.Staple.Matches)
+		}
+		if a.TLS != nil {
+			grade = a.TLS.Grade
+		}
+		_ = w.Write([]string{
+			a.Name,
+			a.Apex,
+			strconv.FormatBool(a.Live),
+			strings.Join(a.IPs, " "),
+			a.SHA256,
+			a.ServedSHA256,
+			strconv.FormatBool(a.Stapled),
+			status,
+			fresh,
+			grade,
+			a.Issuer,
+			a.NotAfter.UTC().Format(time.RFC3339),
+			strconv.FormatBool(a.ViaWildcard),
+			strconv.FormatInt(a.CrtshID, 10),
+			a.DNS,
+			strings.Join(addresses, " "),
+			strconv.FormatBool(a.SplitCertificates),
+		})
+	}
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("could not write CSV (%w)", err)
+	}
+
+	return nil
+}
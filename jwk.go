@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"time"
+)
+
+var errUnsupportedJWKKey = errors.New("public key type has no JWK form")
+
+// jwk is a public key as a JSON Web Key (RFC 7517) with its certificate
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	// N and E of an RSA key
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Crv, X and Y of an EC key, Crv and X of an OKP key
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	// X5C is the certificate DER as standard base64, X5TS256 its SHA-256 as base64url
+	X5C     []string `json:"x5c"`
+	X5TS256 string   `json:"x5t#S256"`
+}
+
+// newJWK of cert's public key, its kid the RFC 7638 thumbprint of the key
+func newJWK(cert *x509.Certificate) (jwk, error) {
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	var k jwk
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		k.Kty, k.N, k.E = "RSA", b64(key.N.Bytes()), b64(big.NewInt(int64(key.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		k.Kty, k.Crv = "EC", key.Curve.Params().Name
+		k.X, k.Y = b64(key.X.FillBytes(make([]byte, size))), b64(key.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		k.Kty, k.Crv, k.X = "OKP", "Ed25519", b64(key)
+	default:
+		return jwk{}, fmt.Errorf("%w (%v)", errUnsupportedJWKKey, cert.PublicKeyAlgorithm)
+	}
+
+	// the thumbprint hashes the required members in lexicographic order with no whitespace
+	var thumbprint string
+	switch k.Kty {
+	case "RSA":
+		thumbprint = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, k.E, k.N)
+	case "EC":
+		thumbprint = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, k.Crv, k.X, k.Y)
+	case "OKP":
+		thumbprint = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, k.Crv, k.X)
+	}
+	sum := sha256.Sum256([]byte(thumbprint))
+	k.Kid = b64(sum[:])
+
+	certSum := sha256.Sum256(cert.Raw)
+	k.X5C = []string{base64.StdEncoding.EncodeToString(cert.Raw)}
+	k.X5TS256 = b64(certSum[:])
+
+	return k, nil
+}
+
+// jwks of certs, the keys with no JWK form are logged and left out
+func jwks(certs []*x509.Certificate) []jwk {
+	keys := make([]jwk, 0, len(certs))
+	for _, cert := range certs {
+		k, err := newJWK(cert)
+		if err != nil {
+			log.Printf("Warning: (skipping certificate of (%v), %v)\n", cert.Subject.CommonName, err)
+			continue
+		}
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+func init() {
+	registerOutputFormat("jwk", func(_ outputFlags, w io.Writer, _ time.Time) outputFormatter {
+		return &collectFormatter{flushCerts: func(_ string, certs []*x509.Certificate) error {
+			enc := json.NewEncoder(w)
+			for _, k := range jwks(certs) {
+				if err := enc.Encode(k); err != nil {
+					return fmt.Errorf("could not write JWK (%w)", err)
+				}
+			}
+			return nil
+		}}
+	})
+	registerOutputFormat("jwks", func(_ outputFlags, w io.Writer, _ time.Time) outputFormatter {
+		return &collectFormatter{flushCerts: func(_ string, certs []*x509.Certificate) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(struct {
+				Keys []jwk `json:"keys"`
+			}{jwks(certs)}); err != nil {
+				return fmt.Errorf("could not write JWKS (%w)", err)
+			}
+			return nil
+		}}
+	})
+}
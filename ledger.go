@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// replayEvents is set by the -replay flag of watch and the daemon to send events again that their
+// ledger already has
+var replayEvents bool
+
+// ledgerKey of an event, the SHA-256 of what it is about, its type and where it was sent
+type ledgerKey [sha256.Size]byte
+
+// newLedgerKey of the event of kind about the certificate with fingerprint, sent by the watcher of
+// query to destination
+func newLedgerKey(query, kind, destination string, fingerprint [sha256.Size]byte) ledgerKey {
+	return sha256.Sum256([]byte(query + "\x00" + kind + "\x00" + destination + "\x00" + hex.EncodeToString(fingerprint[:])))
+}
+
+// eventLedger of the events already sent, appended a key per line to a file so neither a restart
+// nor a poll retried after a backend error sends one twice, it is safe for concurrent use
+type eventLedger struct {
+	mu   sync.Mutex
+	f    *os.File
+	keys map[ledgerKey]struct{}
+	// replay sends events again even when the ledger has them
+	replay bool
+}
+
+// openEventLedger at path for appending, creating it if missing, replay sending events again that
+// the ledger already has
+func openEventLedger(path string, replay bool) (*eventLedger, error) {
+	l := &eventLedger{keys: make(map[ledgerKey]struct{}), replay: replay}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("could not read event ledger (%w)", err)
+	}
+	// a truncated last line from an interrupted write doesn't decode and is skipped
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		var key ledgerKey
+		if b, err := hex.DecodeString(scanner.Text()); err == nil && len(b) == len(key) {
+			copy(key[:], b)
+			l.keys[key] = struct{}{}
+		}
+	}
+
+	if l.f, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+		return nil, fmt.Errorf("could not open event ledger (%w)", err)
+	}
+	// end the truncated line, or the next key would be appended to it and lost
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		if _, err = l.f.WriteString("\n"); err != nil {
+			l.f.Close()
+			return nil, fmt.Errorf("could not write event ledger (%w)", err)
+		}
+	}
+
+	return l, nil
+}
+
+// sent is whether the event of key was sent before and isn't being replayed, false for a nil ledger
+func (l *eventLedger) sent(key ledgerKey) bool {
+	if l == nil || l.replay {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, ok := l.keys[key]
+	return ok
+}
+
+// record that the event of key was sent
+func (l *eventLedger) record(key ledgerKey) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.keys[key]; ok {
+		return nil
+	}
+	if _, err := l.f.WriteString(hex.EncodeToString(key[:]) + "\n"); err != nil {
+		return fmt.Errorf("could not write event ledger (%w)", err)
+	}
+	l.keys[key] = struct{}{}
+
+	return nil
+}
+
+// Close the ledger file
+func (l *eventLedger) Close() error {
+	return l.f.Close()
+}
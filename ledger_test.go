@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEventLedger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger")
+	sent := newLedgerKey("example.com", "new", "slack", sha256.Sum256([]byte("a")))
+	unsent := newLedgerKey("example.com", "new", "email", sha256.Sum256([]byte("a")))
+
+	l, err := openEventLedger(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err = l.record(sent); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// an interrupted write leaves a truncated last line
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteString("0123abc"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 1 {
+		t.Errorf("ledger has (%v) keys, want each recorded once", lines)
+	}
+
+	tests := []struct {
+		name   string
+		replay bool
+		key    ledgerKey
+		sent   bool
+	}{
+		{name: "recorded", key: sent, sent: true},
+		{name: "not recorded", key: unsent},
+		{name: "replayed", replay: true, key: sent},
+	}
+
+	for _, tt := range tests {
+		l, err := openEventLedger(path, tt.replay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := l.sent(tt.key); got != tt.sent {
+			t.Errorf("%v: sent (%v), want (%v)", tt.name, got, tt.sent)
+		}
+		l.Close()
+	}
+
+	// a key recorded after the truncated line is read back
+	l, err = openEventLedger(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = l.record(unsent); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	if l, err = openEventLedger(path, false); err != nil {
+		t.Fatal(err)
+	}
+	if !l.sent(unsent) {
+		t.Error("key recorded after a truncated line was lost")
+	}
+	l.Close()
+
+	var none *eventLedger
+	if none.sent(sent) || none.record(sent) != nil {
+		t.Error("nil ledger should have sent nothing and record without error")
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// asciiHomoglyphs are ASCII substitutions commonly used in lookalike domains
+var asciiHomoglyphs = map[rune][]string{
+	'a': {"4"},
+	'b': {"d", "6"},
+	'd': {"b", "cl"},
+	'e': {"3"},
+	'g': {"q", "9"},
+	'i': {"1", "l"},
+	'l': {"1", "i"},
+	'm': {"rn", "nn"},
+	'n': {"m"},
+	'o': {"0"},
+	's': {"5"},
+	'u': {"v"},
+	'w': {"vv"},
+	'z': {"2"},
+}
+
+// unicodeHomoglyphs are characters from other scripts rendered identically to a Latin letter
+var unicodeHomoglyphs = map[rune][]rune{
+	'a': {'а'},      // CYRILLIC SMALL LETTER A
+	'c': {'с'},      // CYRILLIC SMALL LETTER ES
+	'd': {'ԁ'},      // CYRILLIC SMALL LETTER KOMI DE
+	'e': {'е'},      // CYRILLIC SMALL LETTER IE
+	'h': {'һ'},      // CYRILLIC SMALL LETTER SHHA
+	'i': {'і'},      // CYRILLIC SMALL LETTER BYELORUSSIAN-UKRAINIAN I
+	'j': {'ј'},      // CYRILLIC SMALL LETTER JE
+	'l': {'ӏ'},      // CYRILLIC SMALL LETTER PALOCHKA
+	'o': {'о', 'ο'}, // CYRILLIC SMALL LETTER O, GREEK SMALL LETTER OMICRON
+	'p': {'р'},      // CYRILLIC SMALL LETTER ER
+	's': {'ѕ'},      // CYRILLIC SMALL LETTER DZE
+	'w': {'ԝ'},      // CYRILLIC SMALL LETTER WE
+	'x': {'х'},      // CYRILLIC SMALL LETTER HA
+	'y': {'у'},      // CYRILLIC SMALL LETTER U
+}
+
+// lookalikeTLDs are swapped in for the domain's own suffix
+var lookalikeTLDs = []string{
+	"com", "net", "org", "co", "io", "info", "biz", "app", "dev", "xyz", "online", "site", "shop", "top", "us", "uk", "de",
+}
+
+// lookalikeDomains of domain: omitted, repeated, swapped and homoglyph characters in its first label,
+// hyphenation, and the same label under other TLDs, internationalized variants are punycode encoded
+func lookalikeDomains(domain string) []string {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	label, suffix, ok := strings.Cut(domain, ".")
+	if !ok || label == "" {
+		return nil
+	}
+
+	seen := map[string]struct{}{domain: {}}
+	var names []string
+	add := func(l string, s string) {
+		if l == "" || strings.HasPrefix(l, "-") || strings.HasSuffix(l, "-") {
+			return
+		}
+
+		name, err := toASCII(l + "." + s)
+		if err != nil {
+			return
+		}
+		if _, ok := seen[name]; ok {
+			return
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+
+	runes := []rune(label)
+	for i, r := range runes {
+		// omission
+		add(string(runes[:i])+string(runes[i+1:]), suffix)
+
+		// repetition
+		add(string(runes[:i+1])+string(runes[i:]), suffix)
+
+		// transposition
+		if i+1 < len(runes) && runes[i] != runes[i+1] {
+			swapped := append([]rune(nil), runes...)
+			swapped[i], swapped[i+1] = swapped[i+1], swapped[i]
+			add(string(swapped), suffix)
+		}
+
+		// hyphenation
+		if i > 0 {
+			add(string(runes[:i])+"-"+string(runes[i:]), suffix)
+		}
+
+		for _, glyph := range asciiHomoglyphs[r] {
+			add(string(runes[:i])+glyph+string(runes[i+1:]), suffix)
+		}
+
+		for _, glyph := range unicodeHomoglyphs[r] {
+			add(string(runes[:i])+string(glyph)+string(runes[i+1:]), suffix)
+		}
+	}
+
+	for _, tld := range lookalikeTLDs {
+		add(label, tld)
+	}
+
+	return names
+}
+
+func runLookalikes(ctx context.Context, fs *flag.FlagSet, args []string) (err error) {
+	limit := fs.Int("n", 100, "number of latest entries to return")
+	interval := fs.Duration("interval", 0, "keep watching, polling crt.sh this often and reporting only new lookalike certificates")
+	list := fs.Bool("list", false, "only print the generated lookalike names")
+	output := addOutputFileFlag(fs)
+	splunkOpts := addSplunkFlags(fs)
+	parseFlags(fs, args)
+
+	if fs.NArg() != 1 {
+		return errExpectedArguments
+	}
+	domain := fs.Arg(0)
+
+	names := lookalikeDomains(domain)
+	if *list {
+		return writeOutput(*output, func(out io.Writer) error {
+			for _, name := range names {
+				fmt.Fprintln(out, name)
+			}
+			return nil
+		})
+	}
+
+	// wildcard certificates are logged with the *. prefix as their identity
+	identities := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		identities = append(identities, name, "*."+name)
+	}
+	log.Printf("searching for certificates on (%v) lookalikes of (%v)\n", len(names), domain)
+
+	splunk, err := splunkOpts.sink()
+	if err != nil {
+		return err
+	}
+
+	w := newWatcher(domain, *limit, splunkRoutes(splunk), func(ctx context.Context) ([]result, error) {
+		return getCertificatesByNames(ctx, identities, *limit)
+	})
+	w.baseline = true
+	w.source = "lookalike"
+	w.floor = severityCritical
+
+	out, closeOutput, err := openOutput(*output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := closeOutput(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+	w.out = out
+
+	if *interval == 0 {
+		if err = w.poll(ctx); err != nil {
+			return fmt.Errorf("could not search lookalikes of (%v) (%w)", domain, err)
+		}
+		return nil
+	}
+
+	w.watch(ctx, *interval)
+
+	return nil
+}
@@ -2,9 +2,6 @@ package main
 
 import (
 	"context"
-	"crypto/x509"
-	"database/sql"
-	"encoding/pem"
 	"errors"
 	"flag"
 	"fmt"
@@ -12,56 +9,117 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+)
 
-	_ "github.com/lib/pq"
-	"github.com/simplylib/multierror"
+var (
+	errExpectedArguments = errors.New("expected 1 argument: domain name")
+	errSplunkToken       = errors.New("-splunk-url requires a token via -splunk-token or $SPLUNK_HEC_TOKEN")
+	errUnknownFormat     = errors.New("unknown output format")
+	errExpectedCommand   = errors.New("expected a command")
+	errQuietFormat       = errors.New("-q prints fingerprints only and can't be combined with -format")
 )
 
-const certificateQuery = "SELECT certificate FROM certificate_and_identities WHERE name_value LIKE $1 ORDER BY certificate_id DESC LIMIT $2;"
+// command is a findcert subcommand
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, fs *flag.FlagSet, args []string) error
+}
 
-// getCertificates as a slice of bytes in the der format
-func getCertificates(ctx context.Context, domainName string, limit int) (certs [][]byte, err error) {
-	db, err := sql.Open("postgres", "host=crt.sh user=guest dbname=certwatch binary_parameters=yes")
-	if err != nil {
-		return nil, fmt.Errorf("could not open SQL connection to postgres at crt.sh due to error (%w)", err)
-	}
-	defer func() {
-		if err2 := db.Close(); err2 != nil {
-			err = multierror.Append(err, err2)
-		}
-	}()
+// commands in the order they are listed in usage
+var commands = []command{
+	{"search", "<domain name or pattern>...", "print certificates for a domain name", runSearch},
+	{"watch", "<domain name or pattern>...", "poll for newly logged certificates of a domain name", runWatch},
+	{"lookalikes", "<domain name>", "find certificates for typosquatted and homoglyph lookalikes of a domain name", runLookalikes},
+	{"verify", "<certificate.pem>", "check that a certificate is present in the CT logs", runVerify},
+	{"subdomains", "<domain name or pattern>...", "list the unique DNS names found in certificates", runSubdomains},
+	{"stats", "<domain name or pattern>...", "summarize issuers and validity of certificates", runStats},
+	{"serve", "", "serve search results as JSON over HTTP", runServe},
+	{"export", "<target> <domain name>", "write certificates to a directory or object storage", runExport},
+	{"renewals", "<domain name or pattern>...", "report renewal lead times, overlaps and gaps in coverage", runRenewals},
+	{"inventory", "<apex domain>...", "list an organization's hostnames from CT with their certificates, IPs and whether they are live", runInventory},
+	{"reconcile", "<apex domain>...", "compare names in CT against an inventory of expected hostnames from DNS zones or Terraform state", runReconcile},
+	{"expiring", "<domain name or pattern>...", "list certificates expiring soon across many domains, grouped by domain", runExpiring},
+	{"duplicates", "<domain name or pattern>...", "count Let's Encrypt issuances per name set against the duplicate certificate limit", runDuplicates},
+	{"revoked", "<domain name or pattern>...", "check certificates against Mozilla's OneCRL revocation list in bulk, without OCSP", runRevoked},
+	{"check", "<domain name or pattern>...", "evaluate certificates against a policy file and report violations", runCheck},
+	{"report", "<domain name or pattern>...", "write an HTML report of certificates, expiry and warnings", runReport},
+	{"diff", "<snapshot file> <domain name>", "report certificates added, removed or renewed since a snapshot", runDiff},
+	{"raw-sql", "<query>", "run a read-only SQL query on crt.sh selecting a certificate column", runRawSQL},
+	{"health", "", "check that crt.sh and the CT log list are reachable, for health probes", runHealth},
+	{"daemon", "", "run monitors from a config file on cron-like schedules", runDaemon},
+	{"history", "[domain name]...", "query the certificates recorded by monitors over time", runHistory},
+	{"backfill", "<domain name or pattern>...", "record the whole CT history of newly monitored domains as a baseline, resumably", runBackfill},
+	{"ack", "<sha256>...", "acknowledge or snooze certificates or keys so watch and the daemon stop alerting on them", runAck},
+	{"state", "<export|import>", "move what watch and the daemon have seen between hosts without re-alerting", runState},
+	{"service", "<install|uninstall|run>", "manage the daemon as a systemd or Windows service", runService},
+}
 
-	var rows *sql.Rows
-	rows, err = db.QueryContext(
-		ctx,
-		certificateQuery,
-		domainName,
-		limit,
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprint(out,
+		os.Args[0]+" finds certificates from their domain name by querying crt.sh\n",
+		"\nUsage: "+os.Args[0]+" <command> [flags] [arguments]\n",
+		"Ex: "+os.Args[0]+" search github.com // print the latest certificate of github.com\n",
+		"\nCommands:\n",
 	)
-	if err != nil {
-		return nil, fmt.Errorf("could not execute SQL on postgres for finding certificates (%w)", err)
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-11v %v\n", c.name, c.summary)
 	}
-	defer func() {
-		err = multierror.Append(err, rows.Close())
-	}()
-
-	var (
-		der  []byte
-		ders [][]byte
-	)
-	for rows.Next() {
-		err = rows.Scan(&der)
-		if err != nil {
-			return nil, fmt.Errorf("could not scan row (%w)", err)
-		}
+	fmt.Fprint(out, "\nRun '"+os.Args[0]+" <command> -h' for the flags of a command.\n")
+}
 
-		ders = append(ders, der)
+// newFlagSet for a command with usage listing its arguments and flags
+func newFlagSet(c command) *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(),
+			c.summary+"\n",
+			"\nUsage: "+os.Args[0]+" "+c.name+" [flags] "+c.args+"\n",
+			"\nFlags:\n",
+		)
+		fs.PrintDefaults()
 	}
 
-	return ders, nil
+	return fs
+}
+
+// verbose is set by the -v flag of every command
+var verbose bool
+
+// parseFlags of a command adding the flags common to every command
+func parseFlags(fs *flag.FlagSet, args []string) {
+	fs.BoolVar(&verbose, "v", false, "be verbose")
+	fs.Var(crtshMirrors, "crtsh-hosts", "comma separated crt.sh database hosts to fail over between, in order of preference ($FINDCERT_CRTSH_HOSTS sets the default)")
+	fs.IntVar(&crtshMirrors.breakerFailures, "crtsh-breaker-failures", defaultBreakerFailures, "failures in a row that open a crt.sh host's circuit, so queries skip it to the next host or fail fast, 0 to never open it")
+	fs.DurationVar(&crtshMirrors.breakerCooldown, "crtsh-breaker-cooldown", defaultBreakerCooldown, "how long an open circuit skips its crt.sh host before a query tries it again")
+	fs.Float64Var(&crtshLimiter.qps, "crtsh-qps", defaultCrtshQPS, "most queries a second to send crt.sh across everything this process runs, 0 for unlimited")
+	fs.IntVar(&crtshLimiter.concurrency, "crtsh-concurrency", defaultCrtshConcurrency, "most queries to run on crt.sh at once, 0 for unlimited")
+	fs.Int64Var(&crtshUsage.maxQueries, "max-queries", 0, "fail once this many queries have been sent to crt.sh, 0 for unlimited")
+	fs.Int64Var(&crtshUsage.maxRows, "max-rows", 0, "fail once this many rows have been received from crt.sh, 0 for unlimited")
+	fs.BoolVar(&crtshAdmission.force, "force", false, "run patterns that look broad enough to overload crt.sh (ex: %paypal% or %.co.uk) without counting their matches first")
+	fs.DurationVar(&crtshAdmission.timeout, "admission-timeout", defaultAdmissionTimeout, "refuse a broad pattern unless counting its matches on crt.sh finishes within this")
+	fs.Int64Var(&crtshAdmission.maxMatches, "admission-max-rows", defaultAdmissionMaxMatches, "refuse a broad pattern matching more names than this on crt.sh, 0 for unlimited")
+
+	// ExitOnError means Parse exits instead of returning an error
+	_ = fs.Parse(args)
+
+	if verbose {
+		log.SetFlags(log.LstdFlags | log.Lshortfile)
+	}
 }
 
-var errExpectedArguments = errors.New("expected 1 argument: domain name")
+// lookupCommand by name
+func lookupCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+
+	return command{}, false
+}
 
 func run() error {
 	ctx, cancelFunc := context.WithCancel(context.Background())
@@ -78,60 +136,44 @@ func run() error {
 
 	log.SetFlags(0)
 
-	verbose := flag.Bool("v", false, "be verbose")
-	limit := flag.Int("n", 1, "number of entries to return")
-	printPEM := flag.Bool("pem", false, "print PEM encoded certificate")
-
-	flag.CommandLine.Usage = func() {
-		fmt.Fprint(flag.CommandLine.Output(),
-			os.Args[0]+" from its domain name by querying crt.sh\n",
-			"\nUsage: "+os.Args[0]+" [flags] <domain name>\n",
-			"Ex: "+os.Args[0]+" github.com // print all current certificates \n",
-			"\nFlags:",
-		)
-		flag.CommandLine.PrintDefaults()
+	if len(os.Args) < 2 {
+		usage()
+		return errExpectedCommand
 	}
 
-	flag.Parse()
-
-	if *verbose {
-		log.SetFlags(log.LstdFlags | log.Lshortfile)
+	switch os.Args[1] {
+	case "-h", "-help", "--help", "help":
+		usage()
+		return nil
 	}
 
-	if flag.NArg() != 1 {
-		return errExpectedArguments
+	c, ok := lookupCommand(os.Args[1])
+	args := os.Args[2:]
+	if !ok {
+		// "findcert [flags] github.com" predates subcommands, treat it as a search
+		c, _ = lookupCommand("search")
+		args = os.Args[1:]
 	}
 
-	ders, err := getCertificates(ctx, flag.Args()[0], *limit)
-	if err != nil {
-		return fmt.Errorf("could not getCertificates of (%v) error (%w)", flag.Args()[0], err)
+	err := c.run(ctx, newFlagSet(c), args)
+	if verbose || crtshUsage.budgeted() {
+		crtshUsage.report()
 	}
-
-	var cert *x509.Certificate
-	for _, der := range ders {
-		cert, err = x509.ParseCertificate(der)
-		if err != nil {
-			return fmt.Errorf("could not parse x509 certificate (%w)", err)
-		}
-
-		log.Printf("CommonName: (%v) Issued On: (%v)\n", cert.Subject.CommonName, cert.NotBefore)
-
-		if *printPEM {
-			err = pem.Encode(log.Default().Writer(), &pem.Block{
-				Type:  "CERTIFICATE",
-				Bytes: []byte(der),
-			})
-			if err != nil {
-				return fmt.Errorf("could not encode PEM (%w)", err)
-			}
-		}
+	if errors.Is(err, errQueryPrinted) {
+		return nil
 	}
 
-	return nil
+	return err
 }
 
 func main() {
 	if err := run(); err != nil {
+		// errors such as policy violations exit with a status telling CI pipelines how bad they are
+		var coder interface{ ExitCode() int }
+		if errors.As(err, &coder) {
+			log.Print(err)
+			os.Exit(coder.ExitCode())
+		}
 		log.Fatal(err)
 	}
 }
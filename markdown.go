@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// writeMarkdown of certs found by query as a summary table followed by a section per certificate
+func writeMarkdown(w io.Writer, query string, certs []*x509.Certificate, now time.Time) error {
+	bw := bufio.NewWriter(w)
+
+	rcs := make([]reportCertificate, 0, len(certs))
+	for _, cert := range certs {
+		rcs = append(rcs, newReportCertificate(cert, now))
+	}
+
+	fmt.Fprintf(bw, "## Certificates for `%v`\n\n", strings.ReplaceAll(query, "`", "'"))
+	fmt.Fprintln(bw, "| Common name | NotBefore | NotAfter | Issuer | Warnings |")
+	fmt.Fprintln(bw, "| --- | --- | --- | --- | --- |")
+	for _, rc := range rcs {
+		fmt.Fprintf(bw, "| %v | %v | %v | %v | %v |\n",
+			markdownCell(rc.displayName()),
+			markdownDate(rc.NotBefore),
+			markdownDate(rc.NotAfter),
+			markdownCell(rc.Issuer),
+			markdownCell(strings.Join(rc.Warnings, ", ")),
+		)
+	}
+
+	for _, rc := range rcs {
+		fmt.Fprintf(bw, "\n### %v\n\n", markdownText(rc.displayName()))
+		fmt.Fprintf(bw, "- **Subject:** %v\n", markdownText(rc.Subject))
+		fmt.Fprintf(bw, "- **DNS names:** %v\n", markdownText(strings.Join(rc.DNSNames, ", ")))
+		fmt.Fprintf(bw, "- **Issuer:** %v\n", markdownText(rc.Issuer))
+		fmt.Fprintf(bw, "- **Serial:** `%v`\n", rc.Serial)
+		fmt.Fprintf(bw, "- **Valid:** %v to %v (%v)\n", markdownDate(rc.NotBefore), markdownDate(rc.NotAfter), rc.ExpiresIn)
+		if rc.KeyBits > 0 {
+			fmt.Fprintf(bw, "- **Public key:** %v %v bits\n", rc.KeyAlgorithm, rc.KeyBits)
+		} else {
+			fmt.Fprintf(bw, "- **Public key:** %v\n", rc.KeyAlgorithm)
+		}
+		fmt.Fprintf(bw, "- **Signature:** %v\n", rc.SignatureAlgorithm)
+		fmt.Fprintf(bw, "- **SHA-256:** [`%v`](https://crt.sh/?sha256=%v)\n", rc.SHA256, rc.SHA256)
+		if len(rc.Warnings) > 0 {
+			fmt.Fprintf(bw, "- **Warnings:** %v\n", markdownText(strings.Join(rc.Warnings, ", ")))
+		}
+	}
+
+	return bw.Flush()
+}
+
+func markdownDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04 MST")
+}
+
+// markdownText escapes characters that would otherwise be rendered as formatting
+func markdownText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		"*", `\*`,
+		"_", `\_`,
+		"`", "\\`",
+		"[", `\[`,
+		"]", `\]`,
+		"<", "&lt;",
+		">", "&gt;",
+	).Replace(s)
+}
+
+// markdownCell escapes s for use inside a table cell
+func markdownCell(s string) string {
+	return strings.ReplaceAll(markdownText(s), "|", `\|`)
+}
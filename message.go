@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+var errNotifierTemplate = errors.New("notifier type has no message to template")
+
+// messageText renders the message of an event for people
+type messageText func(source string, event any) (string, error)
+
+// messageData is what a notifier's template is executed with, the fields of a certificate event
+// (ex: {{.Certificate.CommonName}}, {{.Severity}}, {{join .Anomalies "; "}}) are empty for other events
+type messageData struct {
+	certificateEvent
+	// Source of the event (ex: watch or daemon)
+	Source string
+	// Event as sent to notifiers, for events other than of certificates
+	Event any
+	// Text is the message findcert would send without a template
+	Text string
+	// CrtShURL of the certificate
+	CrtShURL string
+}
+
+// messageFuncs of notifier templates, besides text/template's own
+var messageFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// message of cfg's notifier, from its template or eventText without one
+func (cfg notifierConfig) message() (messageText, error) {
+	if cfg.Template == "" {
+		return func(source string, event any) (string, error) {
+			return eventText(source, event), nil
+		}, nil
+	}
+
+	tmpl, err := template.New(cfg.Type).Funcs(messageFuncs).Option("missingkey=error").Parse(cfg.Template)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %v notifier template (%w)", cfg.Type, err)
+	}
+
+	return func(source string, event any) (string, error) {
+		data := messageData{Source: source, Event: event, Text: eventText(source, event)}
+		if e, ok := event.(certificateEvent); ok {
+			data.certificateEvent = e
+			if e.Certificate.SHA256 != "" {
+				data.CrtShURL = "https://crt.sh/?sha256=" + e.Certificate.SHA256
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", fmt.Errorf("could not execute %v notifier template (%w)", cfg.Type, err)
+		}
+		return buf.String(), nil
+	}, nil
+}
+
+// withMessage makes the format of a sink from text, rendering the message it is handed
+func withMessage(text messageText, format func(msg, source string, event any) ([]byte, error)) func(source string, event any) ([]byte, error) {
+	return func(source string, event any) ([]byte, error) {
+		msg, err := text(source, event)
+		if err != nil {
+			return nil, err
+		}
+		return format(msg, source, event)
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/simplylib/multierror"
+)
+
+const (
+	// crtshDSNFormat is the postgres connection string of a crt.sh database host
+	crtshDSNFormat = "host=%v user=guest dbname=certwatch binary_parameters=yes"
+	// defaultCrtshHosts when neither -crtsh-hosts nor $FINDCERT_CRTSH_HOSTS is set
+	defaultCrtshHosts = "crt.sh"
+
+	// mirrorBackoff a host is passed over for after failing, doubling with each consecutive failure
+	mirrorBackoff    = 30 * time.Second
+	maxMirrorBackoff = 10 * time.Minute
+
+	// defaultBreakerFailures in a row open a host's circuit, so it isn't queried for defaultBreakerCooldown
+	defaultBreakerFailures = 5
+	defaultBreakerCooldown = 2 * time.Minute
+)
+
+var (
+	errNoCrtshHosts = errors.New("expected at least one crt.sh host")
+	errCircuitOpen  = errors.New("circuit open for every crt.sh host")
+)
+
+// circuit states of a crt.sh host
+const (
+	// circuitClosed hosts are queried
+	circuitClosed = "closed"
+	// circuitOpen hosts failed too often in a row and are not queried until their cooldown ends
+	circuitOpen = "open"
+	// circuitHalfOpen hosts finished their cooldown, one query at a time tries them again
+	circuitHalfOpen = "half_open"
+)
+
+// crtshMirrors queried by every command, set by the -crtsh-hosts flag
+var crtshMirrors = newMirrorSet(splitList(defaultCrtshHostList()))
+
+// defaultCrtshHostList from $FINDCERT_CRTSH_HOSTS, or crt.sh
+func defaultCrtshHostList() string {
+	if hosts := os.Getenv("FINDCERT_CRTSH_HOSTS"); hosts != "" {
+		return hosts
+	}
+
+	return defaultCrtshHosts
+}
+
+// crtshDSN of host
+func crtshDSN(host string) string {
+	return fmt.Sprintf(crtshDSNFormat, host)
+}
+
+// crtshMirror is a crt.sh database host and how it has been doing
+type crtshMirror struct {
+	host      string
+	failures  int
+	downUntil time.Time
+	lastErr   error
+
+	// openUntil is when the circuit's cooldown ends once failures reach the breaker's threshold
+	openUntil time.Time
+	// probing while a query tries the host with its circuit half open
+	probing bool
+	// opens of the circuit since the process started
+	opens int64
+}
+
+// mirrorSet of crt.sh database hosts, queries go to the host that last worked and fail over in order
+type mirrorSet struct {
+	mu        sync.Mutex
+	mirrors   []*crtshMirror
+	preferred *crtshMirror
+
+	// breakerFailures in a row open a host's circuit for breakerCooldown, 0 never opens it, set by the
+	// -crtsh-breaker-failures and -crtsh-breaker-cooldown flags
+	breakerFailures int
+	breakerCooldown time.Duration
+}
+
+// newMirrorSet of hosts in order of preference
+func newMirrorSet(hosts []string) *mirrorSet {
+	s := &mirrorSet{breakerFailures: defaultBreakerFailures, breakerCooldown: defaultBreakerCooldown}
+	for _, host := range hosts {
+		s.mirrors = append(s.mirrors, &crtshMirror{host: host})
+	}
+
+	return s
+}
+
+// String of the hosts, for flag.Value
+func (s *mirrorSet) String() string {
+	if s == nil {
+		return ""
+	}
+
+	return strings.Join(s.hosts(), ",")
+}
+
+// Set the hosts from a comma separated list, for flag.Value
+func (s *mirrorSet) Set(list string) error {
+	hosts := splitList(list)
+	if len(hosts) == 0 {
+		return errNoCrtshHosts
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mirrors = newMirrorSet(hosts).mirrors
+	s.preferred = nil
+
+	return nil
+}
+
+// order to try the mirrors in at now: the preferred mirror, the rest that are up, then those
+// backing off by whichever comes back soonest so a query is still attempted when all are down,
+// unless their circuits are open
+func (s *mirrorSet) order(now time.Time) []*crtshMirror {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var up, down []*crtshMirror
+	for _, m := range s.mirrors {
+		switch {
+		case now.Before(m.downUntil):
+			down = append(down, m)
+		case m == s.preferred:
+			up = append([]*crtshMirror{m}, up...)
+		default:
+			up = append(up, m)
+		}
+	}
+	sort.SliceStable(down, func(i, j int) bool {
+		return down[i].downUntil.Before(down[j].downUntil)
+	})
+
+	return append(up, down...)
+}
+
+// succeeded marks m as working and preferred for later queries
+func (s *mirrorSet) succeeded(m *crtshMirror) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.circuit(m, time.Now()) != circuitClosed {
+		log.Printf("crt.sh host (%v) circuit closed\n", m.host)
+	}
+	m.failures = 0
+	m.downUntil = time.Time{}
+	m.lastErr = nil
+	m.openUntil = time.Time{}
+	m.probing = false
+	s.preferred = m
+}
+
+// failed marks m as down at now, backing off longer the more it has failed in a row
+func (s *mirrorSet) failed(m *crtshMirror, err error, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	backoff := mirrorBackoff
+	for i := 0; i < m.failures && backoff < maxMirrorBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxMirrorBackoff {
+		backoff = maxMirrorBackoff
+	}
+
+	m.failures++
+	m.downUntil = now.Add(backoff)
+	m.lastErr = err
+	m.probing = false
+	if s.preferred == m {
+		s.preferred = nil
+	}
+
+	// reaching the threshold opens the circuit, as does failing the query trying it half open
+	if s.breakerFailures > 0 && m.failures >= s.breakerFailures {
+		m.openUntil = now.Add(s.breakerCooldown)
+		m.opens++
+		log.Printf("crt.sh host (%v) circuit open for (%v) after (%v) failures in a row\n", m.host, s.breakerCooldown, m.failures)
+	}
+}
+
+// circuit state of m at now, the lock must be held
+func (s *mirrorSet) circuit(m *crtshMirror, now time.Time) string {
+	switch {
+	case s.breakerFailures <= 0 || m.failures < s.breakerFailures:
+		return circuitClosed
+	case now.Before(m.openUntil):
+		return circuitOpen
+	}
+
+	return circuitHalfOpen
+}
+
+// admit a query to m at now: always with its circuit closed, never with it open, and one query at a
+// time with it half open
+func (s *mirrorSet) admit(m *crtshMirror, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch s.circuit(m, now) {
+	case circuitOpen:
+		return false
+	case circuitHalfOpen:
+		if m.probing {
+			return false
+		}
+		m.probing = true
+	}
+
+	return true
+}
+
+// settled query to m that neither succeeded nor failed over, letting another query try it half open
+func (s *mirrorSet) settled(m *crtshMirror) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m.probing = false
+}
+
+// withDB calls fn with a database of the first mirror it works on, failing over to the next
+// mirror when connecting or querying fails in a way another host may not
+func (s *mirrorSet) withDB(ctx context.Context, fn func(db *sql.DB) error) error {
+	mirrors := s.order(time.Now())
+	if len(mirrors) == 0 {
+		return errNoCrtshHosts
+	}
+
+	var errs error
+	for i, m := range mirrors {
+		// a host with its circuit open is passed over for the next, failing fast once none are left
+		if !s.admit(m, time.Now()) {
+			continue
+		}
+
+		if err := crtshUsage.query(); err != nil {
+			s.settled(m)
+			return err
+		}
+		release, err := crtshLimiter.acquire(ctx)
+		if err != nil {
+			s.settled(m)
+			return err
+		}
+		err = useDB(m.host, fn)
+		release()
+		if err == nil {
+			s.succeeded(m)
+			return nil
+		}
+		if ctx.Err() != nil || !failoverError(err) {
+			s.settled(m)
+			return &queryError{err: err}
+		}
+
+		s.failed(m, err, time.Now())
+		if len(mirrors) == 1 {
+			return &queryError{retryable: true, err: err}
+		}
+		if i < len(mirrors)-1 {
+			log.Printf("crt.sh host (%v) failed, failing over (%v)\n", m.host, err)
+		}
+		errs = multierror.Append(errs, fmt.Errorf("host (%v) (%w)", m.host, err))
+	}
+
+	if errs == nil {
+		return &queryError{retryable: true, err: fmt.Errorf("%w (%v)", errCircuitOpen, s)}
+	}
+
+	return &queryError{retryable: true, err: errs}
+}
+
+// useDB of host for fn, closing it after
+func useDB(host string, fn func(db *sql.DB) error) (err error) {
+	db, err := sql.Open("postgres", crtshDSN(host))
+	if err != nil {
+		return fmt.Errorf("could not open SQL connection to postgres at (%v) due to error (%w)", host, err)
+	}
+	defer func() {
+		if err2 := db.Close(); err2 != nil {
+			err = multierror.Append(err, err2)
+		}
+	}()
+
+	return fn(db)
+}
+
+// failoverError is whether err is from the connection or the server's state rather than the query,
+// so trying another host may succeed
+func failoverError(err error) bool {
+	var (
+		netErr net.Error
+		pqErr  *pq.Error
+	)
+	switch {
+	case errors.As(err, &netErr),
+		errors.Is(err, driver.ErrBadConn),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case errors.As(err, &pqErr):
+		switch pqErr.Code.Class() {
+		// connection exception, insufficient resources, operator intervention (ex: shutdown, statement timeout)
+		case "08", "53", "57":
+			return true
+		}
+	}
+
+	return false
+}
+
+// mirrorStatus of a crt.sh host as reported by health endpoints
+type mirrorStatus struct {
+	Host      string     `json:"host"`
+	Preferred bool       `json:"preferred,omitempty"`
+	Failures  int        `json:"consecutive_failures,omitempty"`
+	DownUntil *time.Time `json:"down_until,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	// Circuit is closed, open or half_open, see the -crtsh-breaker-failures flag
+	Circuit          string     `json:"circuit"`
+	CircuitOpenUntil *time.Time `json:"circuit_open_until,omitempty"`
+	CircuitOpens     int64      `json:"circuit_opens,omitempty"`
+}
+
+// status of each mirror in configured order
+func (s *mirrorSet) status() []mirrorStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([]mirrorStatus, 0, len(s.mirrors))
+	for _, m := range s.mirrors {
+		st := mirrorStatus{
+			Host:         m.host,
+			Preferred:    m == s.preferred,
+			Failures:     m.failures,
+			Circuit:      s.circuit(m, now),
+			CircuitOpens: m.opens,
+		}
+		if st.Circuit == circuitOpen {
+			openUntil := m.openUntil
+			st.CircuitOpenUntil = &openUntil
+		}
+		if !m.downUntil.IsZero() {
+			downUntil := m.downUntil
+			st.DownUntil = &downUntil
+		}
+		if m.lastErr != nil {
+			st.LastError = m.lastErr.Error()
+		}
+		statuses = append(statuses, st)
+	}
+
+	return statuses
+}
+
+// writeMetrics of each host's circuit and failures to w in the Prometheus text format
+func (s *mirrorSet) writeMetrics(w io.Writer) {
+	statuses := s.status()
+
+	fmt.Fprintf(w, "# TYPE findcert_crtsh_circuit_state gauge\n")
+	for _, st := range statuses {
+		for _, state := range []string{circuitClosed, circuitOpen, circuitHalfOpen} {
+			value := 0
+			if st.Circuit == state {
+				value = 1
+			}
+			fmt.Fprintf(w, "findcert_crtsh_circuit_state{host=%q,state=%q} %v\n", st.Host, state, value)
+		}
+	}
+	fmt.Fprintf(w, "# TYPE findcert_crtsh_circuit_opens_total counter\n")
+	for _, st := range statuses {
+		fmt.Fprintf(w, "findcert_crtsh_circuit_opens_total{host=%q} %v\n", st.Host, st.CircuitOpens)
+	}
+	fmt.Fprintf(w, "# TYPE findcert_crtsh_consecutive_failures gauge\n")
+	for _, st := range statuses {
+		fmt.Fprintf(w, "findcert_crtsh_consecutive_failures{host=%q} %v\n", st.Host, st.Failures)
+	}
+}
+
+// hosts of the mirrors in configured order
+func (s *mirrorSet) hosts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hosts := make([]string, 0, len(s.mirrors))
+	for _, m := range s.mirrors {
+		hosts = append(hosts, m.host)
+	}
+
+	return hosts
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMirrorCircuit(t *testing.T) {
+	s := newMirrorSet([]string{"a", "b"})
+	s.breakerFailures, s.breakerCooldown = 2, time.Minute
+	a := s.mirrors[0]
+	now := time.Now()
+	errDown := errors.New("down")
+
+	steps := []struct {
+		name    string
+		do      func()
+		at      time.Time
+		circuit string
+		admit   bool
+	}{
+		{name: "new", do: func() {}, at: now, circuit: circuitClosed, admit: true},
+		{name: "one failure", do: func() { s.failed(a, errDown, now) }, at: now, circuit: circuitClosed, admit: true},
+		{name: "threshold", do: func() { s.failed(a, errDown, now) }, at: now, circuit: circuitOpen},
+		{name: "cooldown over", do: func() {}, at: now.Add(2 * time.Minute), circuit: circuitHalfOpen, admit: true},
+		{name: "probing", do: func() {}, at: now.Add(2 * time.Minute), circuit: circuitHalfOpen},
+		{name: "probe settled", do: func() { s.settled(a) }, at: now.Add(2 * time.Minute), circuit: circuitHalfOpen, admit: true},
+		{name: "probe failed", do: func() { s.failed(a, errDown, now.Add(2*time.Minute)) }, at: now.Add(2 * time.Minute), circuit: circuitOpen},
+		{name: "probe succeeded", do: func() { s.succeeded(a) }, at: now.Add(4 * time.Minute), circuit: circuitClosed, admit: true},
+	}
+
+	for _, step := range steps {
+		step.do()
+
+		s.mu.Lock()
+		circuit := s.circuit(a, step.at)
+		s.mu.Unlock()
+		if circuit != step.circuit {
+			t.Fatalf("%v: circuit (%v), want (%v)", step.name, circuit, step.circuit)
+		}
+		if admit := s.admit(a, step.at); admit != step.admit {
+			t.Fatalf("%v: admit (%v), want (%v)", step.name, admit, step.admit)
+		}
+	}
+
+	if st := s.status()[0]; st.CircuitOpens != 2 || !st.Preferred {
+		t.Errorf("status (%+v), want 2 opens and preferred", st)
+	}
+}
+
+func TestMirrorOrder(t *testing.T) {
+	s := newMirrorSet([]string{"a", "b", "c"})
+	a, b, c := s.mirrors[0], s.mirrors[1], s.mirrors[2]
+	now := time.Now()
+	errDown := errors.New("down")
+
+	s.succeeded(c)
+	s.failed(a, errDown, now)
+	s.failed(a, errDown, now)
+	s.failed(b, errDown, now)
+
+	// the preferred host first, then those up, then those down by whichever comes back soonest
+	want := []*crtshMirror{c, b, a}
+	if got := s.order(now); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("order (%v), want c, b, a", got)
+	}
+	if got := s.order(now.Add(time.Hour)); got[0] != c {
+		t.Errorf("order once all are up starts with (%v), want the preferred c", got[0].host)
+	}
+}
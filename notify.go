@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	errUnknownNotifier   = errors.New("unknown notifier type")
+	errNotifierURL       = errors.New("notifier needs a url")
+	errWebhookStatus     = errors.New("unexpected HTTP status from webhook")
+	errUndefinedNotifier = errors.New("monitor notifies an undefined notifier")
+)
+
+// eventSink receives events about certificates, Flush sends any it batched
+type eventSink interface {
+	Send(ctx context.Context, source string, event any) error
+	Flush(ctx context.Context) error
+}
+
+// notifierConfig is a named destination for events in the daemon config
+type notifierConfig struct {
+	Type  string `json:"type"`
+	URL   string `json:"url"`
+	Token string `json:"token"`
+	// Chat is the chat ID of the telegram type or the room ID of the matrix type
+	Chat string `json:"chat"`
+	// Command is run for each event by the exec type
+	Command []string `json:"command"`
+	// Template overrides the message of the notifier, or the whole body of the webhook type, see
+	// messageData for what it is executed with
+	Template string `json:"template"`
+	// Digest, if set, batches new certificates into one summary per period (ex: 1h or 24h)
+	Digest string `json:"digest"`
+}
+
+// newNotifier builds the sink of a notifier type from its config
+type newNotifier func(cfg notifierConfig) (eventSink, error)
+
+// notifierTypes by the type name notifiers are configured with, registerNotifier adds more
+var notifierTypes = map[string]newNotifier{
+	"splunk": func(cfg notifierConfig) (eventSink, error) {
+		if cfg.Template != "" {
+			return nil, fmt.Errorf("%w (%v)", errNotifierTemplate, cfg.Type)
+		}
+		if cfg.URL == "" {
+			return nil, errNotifierURL
+		}
+		token := cfg.Token
+		if token == "" {
+			token = os.Getenv("SPLUNK_HEC_TOKEN")
+		}
+		if token == "" {
+			return nil, errDaemonSplunkAuth
+		}
+		return newSplunkSink(cfg.URL, token), nil
+	},
+	"webhook": func(cfg notifierConfig) (eventSink, error) {
+		if cfg.URL == "" {
+			return nil, errNotifierURL
+		}
+		if cfg.Template == "" {
+			return newWebhookSink(cfg.URL, formatWebhookJSON), nil
+		}
+		text, err := cfg.message()
+		if err != nil {
+			return nil, err
+		}
+		return newWebhookSink(cfg.URL, withMessage(text, func(msg, source string, event any) ([]byte, error) {
+			return []byte(msg), nil
+		})), nil
+	},
+	"slack": func(cfg notifierConfig) (eventSink, error) {
+		if cfg.URL == "" {
+			return nil, errNotifierURL
+		}
+		text, err := cfg.message()
+		if err != nil {
+			return nil, err
+		}
+		return newWebhookSink(cfg.URL, withMessage(text, formatSlack)), nil
+	},
+	"exec": func(cfg notifierConfig) (eventSink, error) {
+		if cfg.Template != "" {
+			return nil, fmt.Errorf("%w (%v)", errNotifierTemplate, cfg.Type)
+		}
+		if len(cfg.Command) == 0 {
+			return nil, errExecCommand
+		}
+		return newExecSink(cfg.Command, cfg), nil
+	},
+	"pagerduty": newPagerDutySink,
+	"opsgenie":  newOpsgenieSink,
+	"ntfy":      newNtfySink,
+	"gotify":    newGotifySink,
+	"telegram":  newTelegramSink,
+	"matrix":    newMatrixSink,
+}
+
+// registerNotifier as typ for notifiers to be configured with, replacing any type already named so
+func registerNotifier(typ string, newSink newNotifier) {
+	notifierTypes[typ] = newSink
+}
+
+// newEventSink from its config, each call returns a sink of its own as sinks may batch
+func newEventSink(cfg notifierConfig) (eventSink, error) {
+	newSink, ok := notifierTypes[cfg.Type]
+	if !ok {
+		types := make([]string, 0, len(notifierTypes))
+		for typ := range notifierTypes {
+			types = append(types, typ)
+		}
+		sort.Strings(types)
+
+		return nil, fmt.Errorf("%w (%v), expected one of (%v)", errUnknownNotifier, cfg.Type, strings.Join(types, ", "))
+	}
+
+	sink, err := newSink(cfg)
+	if err != nil || cfg.Digest == "" {
+		return sink, err
+	}
+
+	period, err := time.ParseDuration(cfg.Digest)
+	if err != nil || period <= 0 {
+		return nil, fmt.Errorf("%w (%v)", errDigestPeriod, cfg.Digest)
+	}
+
+	return newDigestSink(sink, period), nil
+}
+
+// notifyRoute sends events at or above minSeverity to sink
+type notifyRoute struct {
+	name        string
+	sink        eventSink
+	minSeverity severity
+}
+
+// splunkRoutes sends every event to s, none if s is nil
+func splunkRoutes(s *splunkSink) []notifyRoute {
+	if s == nil {
+		return nil
+	}
+
+	return []notifyRoute{{name: "splunk", sink: s, minSeverity: severityInfo}}
+}
+
+// webhookSink posts each event to a URL as it is sent, formatted by format
+type webhookSink struct {
+	url    string
+	format func(source string, event any) ([]byte, error)
+	// header is added to each request (ex: Authorization)
+	header http.Header
+	client *http.Client
+}
+
+func newWebhookSink(url string, format func(source string, event any) ([]byte, error)) *webhookSink {
+	return &webhookSink{
+		url:    url,
+		format: format,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Send the event immediately
+func (s *webhookSink) Send(ctx context.Context, source string, event any) error {
+	body, err := s.format(source, event)
+	if err != nil {
+		return fmt.Errorf("could not encode webhook event (%w)", err)
+	}
+
+	return s.do(ctx, http.MethodPost, s.url, body)
+}
+
+// do the request of method to target with the JSON body and s's headers
+func (s *webhookSink) do(ctx context.Context, method, target string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not create request (%w)", err)
+	}
+	for k, v := range s.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// the URL is left out as many, like Slack's and Telegram's, hold a secret
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("could not %v to webhook (%w)", method, err)
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w (%v)", errWebhookStatus, resp.Status)
+	}
+
+	return nil
+}
+
+// Flush does nothing as events are not batched
+func (s *webhookSink) Flush(ctx context.Context) error {
+	return nil
+}
+
+// formatWebhookJSON as the event with the source it came from
+func formatWebhookJSON(source string, event any) ([]byte, error) {
+	return json.Marshal(struct {
+		Source string `json:"source"`
+		Event  any    `json:"event"`
+	}{source, event})
+}
+
+// formatSlack as a message for a Slack incoming webhook
+func formatSlack(msg, source string, event any) ([]byte, error) {
+	return json.Marshal(struct {
+		Text string `json:"text"`
+	}{msg})
+}
+
+// eventText describes event for people, its first line summarizing it
+func eventText(source string, event any) string {
+	if d, ok := event.(certificateDigest); ok {
+		return digestText(d)
+	}
+
+	e, ok := event.(certificateEvent)
+	if !ok {
+		return fmt.Sprintf("findcert %v: %v", source, event)
+	}
+
+	c := e.Certificate
+	text := fmt.Sprintf("[%v] New certificate for %v (%v) issued by %v on %v",
+		e.Severity,
+		c.displayName(),
+		e.Query,
+		c.IssuerName,
+		c.NotBefore.Format(time.RFC3339),
+	)
+	if len(c.DNSNames) > 1 {
+		text += "\nNames: " + strings.Join(c.DNSNames, ", ")
+	}
+	if len(e.Anomalies) > 0 {
+		text += "\nAnomalies: " + strings.Join(e.Anomalies, "; ")
+	}
+	if len(e.Warnings) > 0 {
+		text += "\nWarnings: " + strings.Join(e.Warnings, "; ")
+	}
+
+	return text
+}
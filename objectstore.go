@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const gcsEndpoint = "https://storage.googleapis.com"
+
+var (
+	errObjectStoreScheme      = errors.New("export target must be of the form s3://bucket/prefix or gs://bucket/prefix")
+	errObjectStoreCredentials = errors.New("object storage credentials not set, expected $AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY")
+	errObjectStoreStatus      = errors.New("unexpected HTTP status from object storage")
+)
+
+// objectStore uploads objects to an S3-compatible bucket using AWS Signature Version 4,
+// GCS is reached through its S3 interoperability API using HMAC keys
+type objectStore struct {
+	scheme       string
+	endpoint     string
+	region       string
+	bucket       string
+	prefix       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+// newObjectStore for target (s3://bucket/prefix or gs://bucket/prefix), an empty endpoint picks the provider default
+func newObjectStore(target string, endpoint string) (*objectStore, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse export target (%w)", err)
+	}
+	if u.Host == "" {
+		return nil, errObjectStoreScheme
+	}
+
+	store := &objectStore{
+		scheme:       u.Scheme,
+		region:       os.Getenv("AWS_REGION"),
+		bucket:       u.Host,
+		prefix:       strings.Trim(u.Path, "/"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		client:       &http.Client{Timeout: 5 * time.Minute},
+	}
+	if store.accessKey == "" || store.secretKey == "" {
+		return nil, errObjectStoreCredentials
+	}
+
+	switch u.Scheme {
+	case "s3":
+		if store.region == "" {
+			store.region = "us-east-1"
+		}
+		store.endpoint = "https://s3." + store.region + ".amazonaws.com"
+	case "gs":
+		store.region = "auto"
+		store.endpoint = gcsEndpoint
+	default:
+		return nil, errObjectStoreScheme
+	}
+
+	if endpoint != "" {
+		store.endpoint = strings.TrimRight(endpoint, "/")
+	}
+
+	return store, nil
+}
+
+// key of name, relative to the store prefix
+func (o *objectStore) key(name string) string {
+	if o.prefix == "" {
+		return name
+	}
+
+	return o.prefix + "/" + name
+}
+
+// location of name as a s3:// or gs:// URL
+func (o *objectStore) location(name string) string {
+	return o.scheme + "://" + o.bucket + "/" + o.key(name)
+}
+
+// Put body under name, relative to the store prefix
+func (o *objectStore) Put(ctx context.Context, name string, contentType string, body []byte) error {
+	key := o.key(name)
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPut,
+		o.endpoint+"/"+uriEncode(o.bucket+"/"+key),
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return fmt.Errorf("could not create request (%w)", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	o.sign(req, body, time.Now().UTC())
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not upload (%v) (%w)", key, err)
+	}
+	defer resp.Body.Close()
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<12))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w uploading (%v) (%v) (%s)", errObjectStoreStatus, key, resp.Status, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
+
+// sign req with AWS Signature Version 4
+func (o *objectStore) sign(req *http.Request, body []byte, now time.Time) {
+	payloadSum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payloadSum[:])
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if o.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", o.sessionToken)
+	}
+
+	signedHeaders := []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	if o.sessionToken != "" {
+		signedHeaders = append(signedHeaders, "x-amz-security-token")
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, h := range signedHeaders {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = req.URL.Host
+		}
+		canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(v) + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + o.region + "/s3/aws4_request"
+	requestSum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestSum[:])
+
+	key := hmacSHA256([]byte("AWS4"+o.secretKey), date)
+	key = hmacSHA256(key, o.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		o.accessKey,
+		scope,
+		strings.Join(signedHeaders, ";"),
+		hex.EncodeToString(hmacSHA256(key, stringToSign)),
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode an object path per the SigV4 rules, leaving '/' alone
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+// exportManifest describes the PEM files uploaded by an export
+type exportManifest struct {
+	Query        string                `json:"query"`
+	GeneratedAt  time.Time             `json:"generated_at"`
+	Certificates []exportManifestEntry `json:"certificates"`
+}
+
+type exportManifestEntry struct {
+	File string `json:"file"`
+	certificateInfo
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha1"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+var (
+	oidOCSPBasic = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+
+	// ocspHashes of a CertID by their AlgorithmIdentifier OID
+	ocspHashes = map[string]crypto.Hash{
+		"1.3.14.3.2.26":          crypto.SHA1,
+		"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+		"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+		"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+	}
+
+	errOCSPStatus       = errors.New("OCSP response is not successful")
+	errOCSPResponseType = errors.New("OCSP response is not a basic response")
+	errOCSPTrailingData = errors.New("trailing data after OCSP response")
+)
+
+// ocspResponse and the types below it are the ASN.1 of RFC 6960 section 4.2.1, a stapled response
+// is only parsed to describe it, its signature is not checked
+type ocspResponse struct {
+	Status asn1.Enumerated
+	Bytes  ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	Type     asn1.ObjectIdentifier
+	Response []byte
+}
+
+type ocspBasicResponse struct {
+	Data      ocspResponseData
+	Algorithm pkix.AlgorithmIdentifier
+	Signature asn1.BitString
+	Certs     []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Version     int `asn1:"optional,default:0,explicit,tag:0"`
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []ocspSingleResponse
+	Extensions  []pkix.Extension `asn1:"optional,explicit,tag:1"`
+}
+
+type ocspSingleResponse struct {
+	CertID     ocspCertID
+	Good       asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked    ocspRevokedInfo  `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate time.Time        `asn1:"generalized"`
+	NextUpdate time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	Extensions []pkix.Extension `asn1:"optional,explicit,tag:1"`
+}
+
+type ocspCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	KeyHash       []byte
+	Serial        *big.Int
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"optional,explicit,tag:0"`
+}
+
+// ocspStaple describes the OCSP response a server stapled for its certificate
+type ocspStaple struct {
+	// Status of the certificate, good, revoked or unknown
+	Status     string    `json:"status"`
+	ThisUpdate time.Time `json:"this_update"`
+	NextUpdate time.Time `json:"next_update,omitempty"`
+	// Fresh when now is between ThisUpdate and NextUpdate
+	Fresh bool `json:"fresh"`
+	// Matches when the response is for the served certificate, its serial and issuer name
+	Matches bool `json:"matches"`
+}
+
+// parseOCSPStaple of cert at now from the DER of a stapled OCSP response
+func parseOCSPStaple(der []byte, cert *x509.Certificate, now time.Time) (*ocspStaple, error) {
+	var resp ocspResponse
+	rest, err := asn1.Unmarshal(der, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse OCSP response (%w)", err)
+	}
+	if len(rest) > 0 {
+		return nil, errOCSPTrailingData
+	}
+	if resp.Status != 0 {
+		return nil, fmt.Errorf("%w (%v)", errOCSPStatus, resp.Status)
+	}
+	if !resp.Bytes.Type.Equal(oidOCSPBasic) {
+		return nil, fmt.Errorf("%w (%v)", errOCSPResponseType, resp.Bytes.Type)
+	}
+
+	var basic ocspBasicResponse
+	if _, err = asn1.Unmarshal(resp.Bytes.Response, &basic); err != nil {
+		return nil, fmt.Errorf("could not parse basic OCSP response (%w)", err)
+	}
+	if len(basic.Data.Responses) == 0 {
+		return nil, fmt.Errorf("could not parse basic OCSP response (%w)", errOCSPStatus)
+	}
+
+	// a response may hold several, the one for cert if there is one
+	single := basic.Data.Responses[0]
+	matches := false
+	for _, r := range basic.Data.Responses {
+		if ocspMatches(r.CertID, cert) {
+			single, matches = r, true
+			break
+		}
+	}
+
+	staple := &ocspStaple{
+		Status:     "revoked",
+		ThisUpdate: single.ThisUpdate,
+		NextUpdate: single.NextUpdate,
+		Fresh:      !now.Before(single.ThisUpdate) && (single.NextUpdate.IsZero() || now.Before(single.NextUpdate)),
+		Matches:    matches,
+	}
+	switch {
+	case bool(single.Good):
+		staple.Status = "good"
+	case bool(single.Unknown):
+		staple.Status = "unknown"
+	}
+
+	return staple, nil
+}
+
+// ocspMatches when id is for cert, by serial and the hash of its issuer's name
+func ocspMatches(id ocspCertID, cert *x509.Certificate) bool {
+	if id.Serial == nil || id.Serial.Cmp(cert.SerialNumber) != 0 {
+		return false
+	}
+
+	hash, ok := ocspHashes[id.HashAlgorithm.Algorithm.String()]
+	if !ok || !hash.Available() {
+		return false
+	}
+	h := hash.New()
+	h.Write(cert.RawIssuer)
+
+	return bytes.Equal(h.Sum(nil), id.NameHash)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// opensslEscaper of characters openssl config values treat specially
+var opensslEscaper = strings.NewReplacer(`\`, `\\`, `$`, `\$`, `#`, `\#`, `"`, `\"`)
+
+// opensslNewKey is the -newkey argument of openssl req for a key like cert's
+func opensslNewKey(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("rsa:%v", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ec -pkeyopt ec_paramgen_curve:" + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "ed25519"
+	}
+
+	return "rsa:2048"
+}
+
+// writeOpenSSLConfig for openssl req reissuing a certificate like cert, with its subject, names and usages
+func writeOpenSSLConfig(w io.Writer, cert *x509.Certificate) error {
+	info := newCertificateInfo(cert)
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "# like %v SHA-256 %v issued by %v\n", info.displayName(), info.SHA256, info.IssuerName)
+	fmt.Fprintf(bw, "# openssl req -new -newkey %v -nodes -keyout key.pem -out req.pem -config this.cnf\n", opensslNewKey(cert))
+	fmt.Fprintln(bw, "[ req ]")
+	fmt.Fprintln(bw, "prompt             = no")
+	fmt.Fprintln(bw, "distinguished_name = req_dn")
+	fmt.Fprintln(bw, "req_extensions     = req_ext")
+	fmt.Fprintln(bw)
+
+	fmt.Fprintln(bw, "[ req_dn ]")
+	subject := cert.Subject
+	for _, attr := range []struct {
+		name   string
+		values []string
+	}{
+		{"C", subject.Country},
+		{"ST", subject.Province},
+		{"L", subject.Locality},
+		{"O", subject.Organization},
+		{"OU", subject.OrganizationalUnit},
+		{"CN", []string{subject.CommonName}},
+	} {
+		for i, value := range attr.values {
+			if value == "" {
+				continue
+			}
+			// openssl takes repeated attributes prefixed with an index and a dot
+			name := attr.name
+			if i > 0 {
+				name = fmt.Sprintf("%v.%v", i, attr.name)
+			}
+			fmt.Fprintf(bw, "%v = %v\n", name, opensslEscaper.Replace(value))
+		}
+	}
+	fmt.Fprintln(bw)
+
+	fmt.Fprintln(bw, "[ req_ext ]")
+	if usages := keyUsages(cert); len(usages) > 0 {
+		fmt.Fprintf(bw, "keyUsage         = critical, %v\n", strings.Join(usages, ", "))
+	}
+	if usages := extKeyUsages(cert); len(usages) > 0 {
+		for i, usage := range usages {
+			if usage == "any" {
+				usages[i] = "anyExtendedKeyUsage"
+			}
+		}
+		fmt.Fprintf(bw, "extendedKeyUsage = %v\n", strings.Join(usages, ", "))
+	}
+	hasSANs := len(cert.DNSNames)+len(cert.IPAddresses)+len(cert.EmailAddresses) > 0
+	if hasSANs {
+		fmt.Fprintln(bw, "subjectAltName   = @alt_names")
+	}
+
+	if hasSANs {
+		fmt.Fprintln(bw)
+		fmt.Fprintln(bw, "[ alt_names ]")
+		for i, name := range cert.DNSNames {
+			fmt.Fprintf(bw, "DNS.%v = %v\n", i+1, opensslEscaper.Replace(name))
+		}
+		for i, ip := range cert.IPAddresses {
+			fmt.Fprintf(bw, "IP.%v = %v\n", i+1, ip)
+		}
+		for i, email := range cert.EmailAddresses {
+			fmt.Fprintf(bw, "email.%v = %v\n", i+1, opensslEscaper.Replace(email))
+		}
+	}
+
+	return bw.Flush()
+}
+
+func init() {
+	registerOutputFormat("openssl", func(_ outputFlags, w io.Writer, _ time.Time) outputFormatter {
+		return &collectFormatter{flushCerts: func(_ string, certs []*x509.Certificate) error {
+			for i, cert := range certs {
+				// a config per certificate, split them into files to use more than one
+				if i > 0 {
+					if _, err := fmt.Fprintln(w); err != nil {
+						return fmt.Errorf("could not write OpenSSL config (%w)", err)
+					}
+				}
+				if err := writeOpenSSLConfig(w, cert); err != nil {
+					return fmt.Errorf("could not write OpenSSL config (%w)", err)
+				}
+			}
+			return nil
+		}}
+	})
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// outputFlags select how commands listing certificates print them
+type outputFlags struct {
+	printPEM      *bool
+	chain         *bool
+	byIssuer      *bool
+	timeline      *bool
+	timelineWidth *int
+	format        *string
+	icsAlarm      *time.Duration
+	quiet         *bool
+	quietIDs      *bool
+	print0        *bool
+	maxSkew       *time.Duration
+	workers       *int
+	unordered     *bool
+	output        *string
+	splunk        splunkFlags
+}
+
+func addOutputFlags(fs *flag.FlagSet) outputFlags {
+	return outputFlags{
+		printPEM:      fs.Bool("pem", false, "print PEM encoded certificate"),
+		chain:         fs.Bool("chain", false, "with -pem, follow each certificate by its intermediates from crt.sh, a fullchain bundle as web servers expect"),
+		byIssuer:      fs.Bool("group-by-issuer", false, "group results under the CA that issued them"),
+		timeline:      fs.Bool("timeline", false, "draw the validity windows of the certificates as an ASCII chart"),
+		timelineWidth: fs.Int("timeline-width", 60, "width in columns of the -timeline chart"),
+		format:        fs.String("format", "text", "output format: "+strings.Join(outputFormatNames(), ", ")),
+		icsAlarm:      fs.Duration("ics-alarm", 30*24*time.Hour, "with -format=ics, remind this long before expiry (0 to disable)"),
+		quiet:         fs.Bool("q", false, "print only the SHA-256 fingerprint of each certificate, one per line"),
+		quietIDs:      fs.Bool("ids", false, "with -q, print crt.sh IDs instead of fingerprints"),
+		print0:        fs.Bool("print0", false, "with -q, terminate each line by NUL instead of newline, for xargs -0"),
+		maxSkew:       fs.Duration("max-log-skew", defaultMaxLoggingSkew, "warn about certificates first logged to CT longer than this before or after their NotBefore"),
+		workers:       fs.Int("workers", runtime.GOMAXPROCS(0), "parse and summarize this many certificates at once"),
+		unordered:     fs.Bool("unordered", false, "print certificates as they are summarized rather than in the order found"),
+		output:        fs.String("output", "", "write certificates to this file instead of stdout, diagnostics still go to stderr"),
+		splunk:        addSplunkFlags(fs),
+	}
+}
+
+// validate the flags before any slow query is run
+func (o outputFlags) validate() error {
+	if _, ok := outputFormats[*o.format]; !ok {
+		return fmt.Errorf("%w (%v)", errUnknownFormat, *o.format)
+	}
+	if *o.quiet && *o.format != "text" {
+		return errQuietFormat
+	}
+	if *o.chain && (!*o.printPEM || *o.quiet || *o.format != "text") {
+		return errChainWithoutPEM
+	}
+
+	_, err := o.splunk.sink()
+	return err
+}
+
+// quietLogs discards log output with -q, returning a func restoring it so errors are still printed
+func (o outputFlags) quietLogs() func() {
+	if !*o.quiet {
+		return func() {}
+	}
+
+	w := log.Writer()
+	log.SetOutput(io.Discard)
+
+	return func() { log.SetOutput(w) }
+}
+
+// addOutputFileFlag of commands whose results aren't certificates in an output format, see writeOutput
+func addOutputFileFlag(fs *flag.FlagSet) *string {
+	return fs.String("output", "", "write results to this file instead of stdout, diagnostics still go to stderr")
+}
+
+// writeOutput of a command's results by write to stdout, or the file at path if set, buffered and
+// apart from the diagnostics logged to stderr
+func writeOutput(path string, write func(w io.Writer) error) (err error) {
+	f := os.Stdout
+	if path != "" {
+		if f, err = os.Create(path); err != nil {
+			return fmt.Errorf("could not create output (%w)", err)
+		}
+		defer func() {
+			if closeErr := f.Close(); closeErr != nil && err == nil {
+				err = fmt.Errorf("could not write output (%w)", closeErr)
+			}
+		}()
+	}
+
+	w := bufio.NewWriter(f)
+	if err = write(w); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return fmt.Errorf("could not write output (%w)", err)
+	}
+
+	return nil
+}
+
+// openOutput of a long running command's results, stdout or the file at path if set, unbuffered so
+// each result is seen as it is written, done closes the file and does nothing for stdout
+func openOutput(path string) (out io.Writer, done func() error, err error) {
+	if path == "" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create output (%w)", err)
+	}
+
+	return f, func() error {
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("could not write output (%w)", err)
+		}
+		return nil
+	}, nil
+}
+
+// write results found by query in the selected format to stdout or -output, sending them to Splunk
+// as source if configured
+func (o outputFlags) write(ctx context.Context, source string, query string, results []result) (err error) {
+	splunk, err := o.splunk.sink()
+	if err != nil {
+		return err
+	}
+
+	w := os.Stdout
+	if *o.output != "" {
+		if w, err = os.Create(*o.output); err != nil {
+			return fmt.Errorf("could not create output (%w)", err)
+		}
+		defer func() {
+			if closeErr := w.Close(); closeErr != nil && err == nil {
+				err = fmt.Errorf("could not write output (%w)", closeErr)
+			}
+		}()
+	}
+
+	f, err := o.formatter(w, time.Now())
+	if err != nil {
+		return err
+	}
+	if text, ok := f.(*textFormatter); ok && *o.chain {
+		fetcher := newChainFetcher()
+		text.chain = func(r result) ([]*x509.Certificate, error) {
+			return fetcher.chain(ctx, r, text.now)
+		}
+	}
+	if err = f.writeHeader(query); err != nil {
+		return err
+	}
+
+	analyzeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for r := range analyzeResults(analyzeCtx, results, *o.workers, !*o.unordered) {
+		if err = f.writeResult(r); err != nil {
+			return err
+		}
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	if err = f.flush(); err != nil {
+		return err
+	}
+
+	if splunk == nil {
+		return nil
+	}
+	for _, r := range results {
+		err = splunk.Send(ctx, source, certificateEvent{
+			Query:       query,
+			Certificate: r.info(),
+		})
+		if err != nil {
+			return fmt.Errorf("could not send certificate to Splunk (%w)", err)
+		}
+	}
+	if err = splunk.Flush(ctx); err != nil {
+		return fmt.Errorf("could not flush Splunk events (%w)", err)
+	}
+
+	return nil
+}
+
+// formatter selected by the flags writing to w
+func (o outputFlags) formatter(w io.Writer, now time.Time) (outputFormatter, error) {
+	if *o.quiet {
+		return &quietFormatter{w: bufio.NewWriter(w), ids: *o.quietIDs, print0: *o.print0}, nil
+	}
+
+	newFormatter, ok := outputFormats[*o.format]
+	if !ok {
+		return nil, fmt.Errorf("%w (%v)", errUnknownFormat, *o.format)
+	}
+
+	return newFormatter(o, w, now), nil
+}
+
+// outputFormatter writes results in one format, a header before the first result and anything it
+// needs every result for on flush
+type outputFormatter interface {
+	writeHeader(query string) error
+	writeResult(r result) error
+	flush() error
+}
+
+// newOutputFormatter configured by o writing to w, now is when results are judged (ex: expired)
+type newOutputFormatter func(o outputFlags, w io.Writer, now time.Time) outputFormatter
+
+// outputFormats by -format name, registerOutputFormat adds more
+var outputFormats = map[string]newOutputFormatter{
+	"text": func(o outputFlags, w io.Writer, now time.Time) outputFormatter {
+		return &textFormatter{
+			w:             bufio.NewWriter(w),
+			now:           now,
+			maxSkew:       *o.maxSkew,
+			printPEM:      *o.printPEM,
+			byIssuer:      *o.byIssuer,
+			timeline:      *o.timeline,
+			timelineWidth: *o.timelineWidth,
+		}
+	},
+	"json": func(_ outputFlags, w io.Writer, now time.Time) outputFormatter {
+		return &jsonFormatter{w: bufio.NewWriter(w), now: now}
+	},
+	"ics": func(o outputFlags, w io.Writer, _ time.Time) outputFormatter {
+		return &collectFormatter{flushInfos: func(_ string, infos []certificateInfo) error {
+			if err := writeICS(w, infos, *o.icsAlarm); err != nil {
+				return fmt.Errorf("could not write iCalendar (%w)", err)
+			}
+			return nil
+		}}
+	},
+	"markdown": func(_ outputFlags, w io.Writer, now time.Time) outputFormatter {
+		return &collectFormatter{flushCerts: func(query string, certs []*x509.Certificate) error {
+			if err := writeMarkdown(w, query, certs, now); err != nil {
+				return fmt.Errorf("could not write Markdown (%w)", err)
+			}
+			return nil
+		}}
+	},
+	"dot": func(_ outputFlags, w io.Writer, _ time.Time) outputFormatter {
+		return &collectFormatter{flushCerts: func(_ string, certs []*x509.Certificate) error {
+			if err := buildCertificateGraph(certs).writeDOT(w); err != nil {
+				return fmt.Errorf("could not write DOT graph (%w)", err)
+			}
+			return nil
+		}}
+	},
+	"mermaid": func(_ outputFlags, w io.Writer, _ time.Time) outputFormatter {
+		return &collectFormatter{flushCerts: func(_ string, certs []*x509.Certificate) error {
+			if err := buildCertificateGraph(certs).writeMermaid(w); err != nil {
+				return fmt.Errorf("could not write Mermaid graph (%w)", err)
+			}
+			return nil
+		}}
+	},
+}
+
+// registerOutputFormat as name for -format, replacing any format already named so
+func registerOutputFormat(name string, newFormatter newOutputFormatter) {
+	outputFormats[name] = newFormatter
+}
+
+// outputFormatNames sorted, for flag help
+func outputFormatNames() []string {
+	names := make([]string, 0, len(outputFormats))
+	for name := range outputFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// textFormatter prints results as printResult does, grouped by issuer once all are written with byIssuer
+type textFormatter struct {
+	w             *bufio.Writer
+	now           time.Time
+	maxSkew       time.Duration
+	printPEM      bool
+	byIssuer      bool
+	timeline      bool
+	timelineWidth int
+	// chain, if set, returns the intermediates printed after each PEM certificate
+	chain func(r result) ([]*x509.Certificate, error)
+
+	results []result
+}
+
+func (f *textFormatter) writeHeader(string) error {
+	return nil
+}
+
+func (f *textFormatter) writeResult(r result) error {
+	if f.byIssuer || f.timeline {
+		f.results = append(f.results, r)
+	}
+	if f.byIssuer {
+		return nil
+	}
+
+	return f.print(r, "")
+}
+
+// print r prefixed by indent, followed by its chain if wanted
+func (f *textFormatter) print(r result, indent string) error {
+	if err := printResult(f.w, r, f.now, f.maxSkew, f.printPEM, indent); err != nil {
+		return err
+	}
+	if f.chain == nil {
+		return nil
+	}
+
+	chain, err := f.chain(r)
+	if err != nil {
+		return fmt.Errorf("could not find chain of (%v) (%w)", r.info().SHA256, err)
+	}
+	for _, cert := range chain {
+		if err = pem.Encode(f.w, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+			return fmt.Errorf("could not encode PEM (%w)", err)
+		}
+	}
+
+	return nil
+}
+
+func (f *textFormatter) flush() error {
+	if f.byIssuer {
+		for _, group := range groupByIssuer(f.results) {
+			fmt.Fprintf(f.w, "Issuer: (%v) CA ID: (%v) Certificates: (%v)\n", group.name, group.caID, len(group.results))
+			for _, r := range group.results {
+				if err := f.print(r, "  "); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if f.timeline {
+		for _, line := range renderTimeline(certificatesOf(f.results), f.timelineWidth, f.now) {
+			fmt.Fprintln(f.w, line)
+		}
+	}
+
+	if err := f.w.Flush(); err != nil {
+		return fmt.Errorf("could not write results (%w)", err)
+	}
+
+	return nil
+}
+
+// quietFormatter writes only the SHA-256 fingerprint or crt.sh ID of each result, one per line
+type quietFormatter struct {
+	w      *bufio.Writer
+	ids    bool
+	print0 bool
+}
+
+func (f *quietFormatter) writeHeader(string) error {
+	return nil
+}
+
+func (f *quietFormatter) writeResult(r result) error {
+	terminator := "\n"
+	if f.print0 {
+		terminator = "\x00"
+	}
+
+	id := r.info().SHA256
+	if f.ids {
+		id = strconv.FormatInt(r.id, 10)
+	}
+	if _, err := fmt.Fprint(f.w, id, terminator); err != nil {
+		return fmt.Errorf("could not write (%v) (%w)", id, err)
+	}
+
+	return nil
+}
+
+func (f *quietFormatter) flush() error {
+	if err := f.w.Flush(); err != nil {
+		return fmt.Errorf("could not write results (%w)", err)
+	}
+
+	return nil
+}
+
+// jsonFormatter streams a searchResponse, each certificate written as it comes rather than the
+// whole response held until the end
+type jsonFormatter struct {
+	w   *bufio.Writer
+	now time.Time
+	// buf is reused to indent each certificate
+	buf   bytes.Buffer
+	count int
+}
+
+func (f *jsonFormatter) writeHeader(query string) error {
+	q, err := json.Marshal(query)
+	if err != nil {
+		return fmt.Errorf("could not write JSON (%w)", err)
+	}
+	fmt.Fprintf(f.w, "{\n  \"schema_version\": %d,\n  \"query\": %s,\n  \"certificates\": [", jsonSchemaVersion, q)
+
+	return nil
+}
+
+func (f *jsonFormatter) writeResult(r result) error {
+	data, err := json.Marshal(r.info().notYetValid(f.now))
+	if err != nil {
+		return fmt.Errorf("could not write JSON (%w)", err)
+	}
+
+	// indented as json.Encoder with SetIndent("", "  ") would the whole response
+	f.buf.Reset()
+	if f.count > 0 {
+		f.buf.WriteByte(',')
+	}
+	f.buf.WriteString("\n    ")
+	if err = json.Indent(&f.buf, data, "    ", "  "); err != nil {
+		return fmt.Errorf("could not write JSON (%w)", err)
+	}
+	f.count++
+
+	_, err = f.w.Write(f.buf.Bytes())
+	return err
+}
+
+func (f *jsonFormatter) flush() error {
+	if f.count > 0 {
+		f.w.WriteString("\n  ")
+	}
+	f.w.WriteString("]\n}\n")
+
+	if err := f.w.Flush(); err != nil {
+		return fmt.Errorf("could not write JSON (%w)", err)
+	}
+
+	return nil
+}
+
+// collectFormatter collects results for formats that need all of them at once, handing them to
+// flushInfos or flushCerts
+type collectFormatter struct {
+	flushInfos func(query string, infos []certificateInfo) error
+	flushCerts func(query string, certs []*x509.Certificate) error
+
+	query   string
+	results []result
+}
+
+func (f *collectFormatter) writeHeader(query string) error {
+	f.query = query
+	return nil
+}
+
+func (f *collectFormatter) writeResult(r result) error {
+	f.results = append(f.results, r)
+	return nil
+}
+
+func (f *collectFormatter) flush() error {
+	if f.flushCerts != nil {
+		return f.flushCerts(f.query, certificatesOf(f.results))
+	}
+
+	infos := make([]certificateInfo, 0, len(f.results))
+	for _, r := range f.results {
+		infos = append(infos, r.info())
+	}
+
+	return f.flushInfos(f.query, infos)
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+// minPatternLiterals is the fewest letters or digits a pattern with wildcards must contain,
+// anything less matches a large part of the log and only times out on crt.sh
+const minPatternLiterals = 4
+
+var (
+	errExpectedPatterns = errors.New("expected at least 1 argument: domain name or LIKE pattern")
+	errBroadPattern     = errors.New("pattern would match too much of the log")
+)
+
+// patternSet is the LIKE patterns names must match, and those they must not
+type patternSet struct {
+	include []string
+	exclude []string
+}
+
+// String describes the set for logs and snapshots, exclusions are prefixed with !
+func (p patternSet) String() string {
+	s := strings.Join(p.include, " ")
+	for _, pattern := range p.exclude {
+		s += " !" + pattern
+	}
+
+	return s
+}
+
+// patternFlags add keyword searches, exclusions and a zone's hostnames to the domain names and LIKE
+// patterns given as arguments
+type patternFlags struct {
+	keywords *string
+	exclude  *string
+	zoneFile *string
+}
+
+func addPatternFlags(fs *flag.FlagSet) patternFlags {
+	return patternFlags{
+		keywords: fs.String("keywords", "", "comma separated keywords to search for anywhere in names (ex: paypal,secure)"),
+		exclude:  fs.String("exclude", "", "comma separated LIKE patterns of names to leave out (ex: %.staging.example.com)"),
+		zoneFile: fs.String("zone-file", "", "also search the A, AAAA and CNAME hostnames of this BIND zone file"),
+	}
+}
+
+// patterns from the arguments of fs, the zone file's hostnames, keywords and exclusions, each included
+// pattern checked to not be too broad
+func (f patternFlags) patterns(fs *flag.FlagSet) (patternSet, error) {
+	args := fs.Args()
+	if *f.zoneFile != "" {
+		names, err := readZoneFile(*f.zoneFile)
+		if err != nil {
+			return patternSet{}, err
+		}
+		args = append(args[:len(args):len(args)], names...)
+	}
+
+	return newPatternSet(args, splitList(*f.keywords), splitList(*f.exclude))
+}
+
+// splitList of comma separated values, leaving out empty ones
+func splitList(s string) []string {
+	var values []string
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// newPatternSet from domain names or LIKE patterns, keywords and exclusions, each included pattern checked to not be too broad
+func newPatternSet(args []string, keywords []string, excludes []string) (patternSet, error) {
+	var set patternSet
+	for _, arg := range args {
+		pattern, err := toASCII(arg)
+		if err != nil {
+			return patternSet{}, fmt.Errorf("could not normalize (%v) (%w)", arg, err)
+		}
+		if pattern != strings.ToLower(arg) {
+			log.Printf("searching for (%v) as (%v)\n", arg, pattern)
+		}
+		set.include = append(set.include, pattern)
+	}
+
+	for _, keyword := range keywords {
+		// a Unicode keyword can only be found as a whole punycode encoded label
+		ascii, err := toASCII(keyword)
+		if err != nil {
+			return patternSet{}, fmt.Errorf("could not normalize (%v) (%w)", keyword, err)
+		}
+		set.include = append(set.include, keywordPattern(ascii))
+	}
+
+	for _, exclude := range excludes {
+		pattern, err := toASCII(exclude)
+		if err != nil {
+			return patternSet{}, fmt.Errorf("could not normalize (%v) (%w)", exclude, err)
+		}
+		set.exclude = append(set.exclude, pattern)
+	}
+
+	if len(set.include) == 0 {
+		return patternSet{}, errExpectedPatterns
+	}
+
+	for _, pattern := range set.include {
+		if err := validatePattern(pattern); err != nil {
+			return patternSet{}, err
+		}
+	}
+
+	return set, nil
+}
+
+// keywordPattern matches names containing keyword
+func keywordPattern(keyword string) string {
+	return "%" + escapeLike(keyword) + "%"
+}
+
+// escapeLike so s matches literally in a LIKE pattern using postgres' default \ escape
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// validatePattern rejects LIKE patterns with wildcards but too few literal letters or digits around
+// them to be selective, a pattern without wildcards matches one name exactly however short
+func validatePattern(pattern string) error {
+	var (
+		literals int
+		wildcard bool
+		escaped  bool
+	)
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+			continue
+		case r == '%', r == '_':
+			wildcard = true
+			continue
+		}
+
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			literals++
+		}
+	}
+
+	if wildcard && literals < minPatternLiterals {
+		return fmt.Errorf("%w (%v), it needs at least %v letters or digits", errBroadPattern, pattern, minPatternLiterals)
+	}
+
+	return nil
+}
+
+// getCertificatesByPatterns in a single query, a certificate matching several patterns is only returned once
+func getCertificatesByPatterns(ctx context.Context, set patternSet, limit int) ([]result, error) {
+	found, err := parsed(queryCertificates(ctx, patternsQuery, set.queryArgs(limit)...))
+	if err != nil {
+		return nil, err
+	}
+
+	return dedupeResults(found, make(map[int64]struct{}, len(found))), nil
+}
+
+// getAllCertificatesByPatterns a page of pageSize rows at a time, newest first
+func getAllCertificatesByPatterns(ctx context.Context, set patternSet, pageSize int) ([]result, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var results []result
+	for r := range streamCertificatesByPatterns(ctx, set, pageSize) {
+		if r.err != nil {
+			return nil, r.err
+		}
+		results = append(results, r.result)
+	}
+
+	return results, nil
+}
+
+// streamedResult is a result sent by a stream, or the error that ended it
+type streamedResult struct {
+	result
+	err error
+}
+
+// streamCertificatesByPatterns matching set newest first, fetching a page of pageSize rows only once the
+// receiver has taken every result of the last. The channel is closed after the last result or an error,
+// a receiver stopping early must cancel ctx
+func streamCertificatesByPatterns(ctx context.Context, set patternSet, pageSize int) <-chan streamedResult {
+	return streamCertificatesByPatternsBefore(ctx, set, pageSize, math.MaxInt64)
+}
+
+// streamCertificatesByPatternsBefore is streamCertificatesByPatterns of the certificates with a crt.sh
+// ID below before, to resume a stream
+func streamCertificatesByPatternsBefore(ctx context.Context, set patternSet, pageSize int, before int64) <-chan streamedResult {
+	stream := make(chan streamedResult)
+
+	go func() {
+		defer close(stream)
+
+		send := func(r streamedResult) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case stream <- r:
+				return true
+			}
+		}
+
+		seen := make(map[int64]struct{})
+		for {
+			page, err := parsed(queryCertificates(ctx, patternsPageQuery, set.pageQueryArgs(before, pageSize)...))
+			if err != nil {
+				send(streamedResult{err: err})
+				return
+			}
+			for _, r := range dedupeResults(page, seen) {
+				if !send(streamedResult{result: r}) {
+					return
+				}
+			}
+
+			if len(page) < pageSize {
+				return
+			}
+			// a certificate split across pages was already kept from the first of them
+			before = page[len(page)-1].id
+		}
+	}()
+
+	return stream
+}
+
+// countCertificatesByPatterns matching set
+func countCertificatesByPatterns(ctx context.Context, set patternSet) (int64, error) {
+	return countRows(ctx, patternsCountQuery, pq.Array(set.include), pq.Array(set.excludeArray()))
+}
+
+// estimateCertificatesByPatterns is postgres' estimate of the rows matching set, not yet deduplicated
+func estimateCertificatesByPatterns(ctx context.Context, set patternSet) (int64, error) {
+	return estimateRows(ctx, patternsEstimateQuery, pq.Array(set.include), pq.Array(set.excludeArray()))
+}
+
+// queryArgs of patternsQuery for set
+func (p patternSet) queryArgs(limit int) []any {
+	return []any{pq.Array(p.include), pq.Array(p.excludeArray()), limit}
+}
+
+// pageQueryArgs of patternsPageQuery for set
+func (p patternSet) pageQueryArgs(before int64, pageSize int) []any {
+	return []any{pq.Array(p.include), pq.Array(p.excludeArray()), before, pageSize}
+}
+
+// excludeArray of the exclusions, never nil as NOT (x LIKE ANY(NULL)) is NULL rather than true
+func (p patternSet) excludeArray() []string {
+	if p.exclude == nil {
+		return []string{}
+	}
+
+	return p.exclude
+}
+
+// dedupeResults not in seen, crt.sh has a row per matching identity so certificates repeat
+func dedupeResults(found []result, seen map[int64]struct{}) []result {
+	var results []result
+	for _, r := range found {
+		if _, ok := seen[r.id]; ok {
+			continue
+		}
+		seen[r.id] = struct{}{}
+		results = append(results, r)
+	}
+
+	return results
+}
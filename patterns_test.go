@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidatePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		broad   bool
+	}{
+		{pattern: "x.ai"},
+		{pattern: "t.co"},
+		{pattern: "example.com"},
+		{pattern: "%.example.com"},
+		{pattern: "%.x.ai", broad: true},
+		{pattern: "%.co", broad: true},
+		{pattern: "%", broad: true},
+		{pattern: "a_c%", broad: true},
+		{pattern: "%paypal%"},
+		// escaped wildcards are literals, so the pattern matches one name exactly
+		{pattern: `a\_b`},
+		{pattern: `%a\%b`, broad: true},
+	}
+
+	for _, tt := range tests {
+		err := validatePattern(tt.pattern)
+		if broad := errors.Is(err, errBroadPattern); broad != tt.broad || (err != nil && !broad) {
+			t.Errorf("validatePattern(%q) = (%v), want broad (%v)", tt.pattern, err, tt.broad)
+		}
+	}
+}
+
+func TestNewPatternSet(t *testing.T) {
+	tests := []struct {
+		args     []string
+		keywords []string
+		want     []string
+		err      error
+	}{
+		{args: []string{"x.ai"}, want: []string{"x.ai"}},
+		{args: []string{"Example.COM", "%.example.com"}, want: []string{"example.com", "%.example.com"}},
+		{keywords: []string{"paypal"}, want: []string{"%paypal%"}},
+		{keywords: []string{"a_b"}, want: []string{`%a\_b%`}, err: errBroadPattern},
+		{args: []string{"%.x.ai"}, err: errBroadPattern},
+		{err: errExpectedPatterns},
+	}
+
+	for _, tt := range tests {
+		set, err := newPatternSet(tt.args, tt.keywords, nil)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("newPatternSet(%q, %q) error = (%v), want (%v)", tt.args, tt.keywords, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(set.include) != len(tt.want) {
+			t.Errorf("newPatternSet(%q, %q) = (%q), want (%q)", tt.args, tt.keywords, set.include, tt.want)
+			continue
+		}
+		for i := range tt.want {
+			if set.include[i] != tt.want[i] {
+				t.Errorf("newPatternSet(%q, %q) = (%q), want (%q)", tt.args, tt.keywords, set.include, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// execTimeout is how long a notifier command has to handle an event
+const execTimeout = 30 * time.Second
+
+var errExecCommand = errors.New("exec notifier needs a command")
+
+// execSink runs a command for each event with the event as JSON on stdin, formatted as webhooks
+// are, and the notifier's url and token in $FINDCERT_NOTIFIER_URL and $FINDCERT_NOTIFIER_TOKEN
+type execSink struct {
+	command []string
+	env     []string
+}
+
+func newExecSink(command []string, cfg notifierConfig) *execSink {
+	return &execSink{
+		command: command,
+		env: append(os.Environ(),
+			"FINDCERT_NOTIFIER_URL="+cfg.URL,
+			"FINDCERT_NOTIFIER_TOKEN="+cfg.Token,
+		),
+	}
+}
+
+// Send the event by running the command, an exit status other than 0 is an error
+func (s *execSink) Send(ctx context.Context, source string, event any) error {
+	body, err := formatWebhookJSON(source, event)
+	if err != nil {
+		return fmt.Errorf("could not encode event (%w)", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, execTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.command[0], s.command[1:]...)
+	cmd.Env = s.env
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stderr = &stderr
+
+	if err = cmd.Run(); err != nil {
+		return fmt.Errorf("could not run notifier (%v) (%w) stderr (%v)", s.command[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// Flush does nothing as events are not batched
+func (s *execSink) Flush(ctx context.Context) error {
+	return nil
+}
+
+// registerNotifierPlugins registers each executable in dir as a notifier type named after the file
+// without its extension (ex: pagerduty.sh is type pagerduty), run as an exec notifier
+func registerNotifierPlugins(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("could not read plugin directory (%w)", err)
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("could not stat plugin (%v) (%w)", entry.Name(), err)
+		}
+		if !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		typ := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		registerNotifier(typ, func(cfg notifierConfig) (eventSink, error) {
+			return newExecSink(append([]string{path}, cfg.Command...), cfg), nil
+		})
+	}
+
+	return nil
+}
+
+var errUnterminatedQuote = errors.New("unterminated quote")
+
+// hookSink runs a command template for each new or expiring certificate event, see newHookSink
+type hookSink struct {
+	args []string
+}
+
+// newHookSink from a command line split as a shell would without expanding anything, whose
+// arguments may hold the placeholders of hookPlaceholders
+func newHookSink(command string) (*hookSink, error) {
+	args, err := splitCommand(command)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse command (%v) (%w)", command, err)
+	}
+	if len(args) == 0 {
+		return nil, errExecCommand
+	}
+
+	return &hookSink{args: args}, nil
+}
+
+// hookPlaceholders of the event of kind (ex: new_certificate) about c, each also set as an
+// environment variable (ex: {sha256} as $FINDCERT_SHA256), {} is the certificate's name. Only new
+// certificates have a {severity} and only expiring ones {expires_in_days}
+func hookPlaceholders(source, kind, query string, sev severity, c certificateInfo) map[string]string {
+	severity := ""
+	if sev != 0 {
+		severity = sev.String()
+	}
+
+	return map[string]string{
+		"event":           kind,
+		"expires_in_days": "",
+		"name":            c.displayName(),
+		"dns_names":       strings.Join(c.DNSNames, ","),
+		"sha256":          c.SHA256,
+		"crtsh_id":        fmt.Sprint(c.ID),
+		"issuer":          c.IssuerName,
+		"not_before":      c.NotBefore.UTC().Format(time.RFC3339),
+		"not_after":       c.NotAfter.UTC().Format(time.RFC3339),
+		"query":           query,
+		"severity":        severity,
+		"source":          source,
+	}
+}
+
+// Send runs the command for a certificateEvent or an expiring watchEvent, other events are ignored
+func (s *hookSink) Send(ctx context.Context, source string, event any) error {
+	var placeholders map[string]string
+	switch e := event.(type) {
+	case certificateEvent:
+		placeholders = hookPlaceholders(source, eventNewCertificate, e.Query, e.Severity, e.Certificate)
+	case watchEvent:
+		if e.Type != eventExpiring || e.Certificate == nil {
+			return nil
+		}
+		placeholders = hookPlaceholders(source, e.Type, e.Query, e.Severity, *e.Certificate)
+		if e.ExpiresInDays != nil {
+			placeholders["expires_in_days"] = fmt.Sprint(*e.ExpiresInDays)
+		}
+	default:
+		return nil
+	}
+
+	pairs := []string{"{}", placeholders["name"]}
+	env := os.Environ()
+	for key, value := range placeholders {
+		pairs = append(pairs, "{"+key+"}", value)
+		env = append(env, "FINDCERT_"+strings.ToUpper(key)+"="+value)
+	}
+	replacer := strings.NewReplacer(pairs...)
+
+	// arguments are passed to the command as is, a certificate's names never reach a shell
+	args := make([]string, 0, len(s.args))
+	for _, arg := range s.args {
+		args = append(args, replacer.Replace(arg))
+	}
+
+	return runCommand(ctx, args, env)
+}
+
+// runCommand args with env within execTimeout, its output goes to stderr
+func runCommand(ctx context.Context, args []string, env []string) error {
+	ctx, cancel := context.WithTimeout(ctx, execTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = env
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("could not run (%v) (%w) stderr (%v)", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// Flush does nothing as events are not batched
+func (s *hookSink) Flush(ctx context.Context) error {
+	return nil
+}
+
+// splitCommand into arguments at unquoted whitespace, outside single quotes a backslash escapes the
+// next character
+func splitCommand(command string) ([]string, error) {
+	var (
+		args    []string
+		arg     strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range command {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+				continue
+			}
+			arg.WriteRune(r)
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+				continue
+			}
+			arg.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errUnterminatedQuote
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+
+	return args, nil
+}
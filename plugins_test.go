@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHookSink(t *testing.T) {
+	days := 7
+	c := certificateInfo{SHA256: "ab", CommonName: "example.com", NotAfter: time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		name  string
+		event any
+		want  string
+	}{
+		{name: "new", event: certificateEvent{Query: "example.com", Severity: severityWarning, Certificate: c}, want: "new_certificate example.com warning  2030-01-02T00:00:00Z"},
+		{name: "expiring", event: watchEvent{Type: eventExpiring, Query: "example.com", ExpiresInDays: &days, Certificate: &c}, want: "expiring example.com  7 2030-01-02T00:00:00Z"},
+		{name: "other event", event: watchEvent{Type: eventBackendError, Query: "example.com", Error: "down"}},
+	}
+
+	for _, tt := range tests {
+		out := filepath.Join(t.TempDir(), "out")
+		// placeholders in the arguments, the environment for the script
+		hook := &hookSink{args: []string{"sh", "-c", `printf '%s %s %s %s %s' "$1" "$FINDCERT_NAME" "$FINDCERT_SEVERITY" "$FINDCERT_EXPIRES_IN_DAYS" "$FINDCERT_NOT_AFTER" > "$0"`, out, "{event}"}}
+		if err := hook.Send(context.Background(), "watch", tt.event); err != nil {
+			t.Fatalf("%v: (%v)", tt.name, err)
+		}
+
+		got, err := os.ReadFile(out)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%v: ran the command, want it ignored", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: (%v)", tt.name, err)
+		}
+		if !bytes.Equal(got, []byte(tt.want)) {
+			t.Errorf("%v: (%s), want (%v)", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEventStreamExpiring(t *testing.T) {
+	results := benchmarkResults(benchmarkDERs(t, 1))
+	sink := &recordingSink{}
+	s := newEventStream(&bytes.Buffer{})
+	s.expiring = []eventSink{sink}
+
+	// a week before the leaf expires, twice, as two polls would
+	now := results[0].cert().NotAfter.Add(-7 * 24 * time.Hour)
+	for i := 0; i < 2; i++ {
+		s.emitExpiring("example.com", results, now)
+	}
+
+	if len(sink.buffered) != 1 {
+		t.Fatalf("sent (%v) expiring events, want 1", len(sink.buffered))
+	}
+	if e, ok := sink.buffered[0].(watchEvent); !ok || e.Type != eventExpiring || *e.ExpiresInDays != 7 {
+		t.Errorf("sent (%+v), want expiring in 7 days", sink.buffered[0])
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// alertPolicy of a monitor assigns severities by who issued a new certificate and whether it renews
+// one already seen, in place of judging every new certificate alike
+type alertPolicy struct {
+	// AllowedCAs are crt.sh CA IDs or case insensitive parts of the issuer's name (ex: Let's Encrypt)
+	AllowedCAs []string `json:"allowed_cas"`
+	// Renewal is the severity of a certificate from an allowed CA for names already seen, default info
+	Renewal severity `json:"renewal"`
+	// UnknownCA is the severity of a certificate from a CA not allowed, default critical
+	UnknownCA severity `json:"unknown_ca"`
+}
+
+// newAlertPolicy allowing the comma separated CAs, nil if there are none
+func newAlertPolicy(allowedCAs string) *alertPolicy {
+	var cas []string
+	for _, ca := range strings.Split(allowedCAs, ",") {
+		if ca = strings.TrimSpace(ca); ca != "" {
+			cas = append(cas, ca)
+		}
+	}
+	if len(cas) == 0 {
+		return nil
+	}
+
+	return &alertPolicy{AllowedCAs: cas}
+}
+
+// allowed is whether r was issued by an allowed CA
+func (p *alertPolicy) allowed(r result) bool {
+	issuer := strings.ToLower(friendlyIssuer(r.cert()) + " " + r.cert().Issuer.String())
+	for _, ca := range p.AllowedCAs {
+		if r.issuerCAID != 0 && ca == fmt.Sprint(r.issuerCAID) {
+			return true
+		}
+		if strings.Contains(issuer, strings.ToLower(ca)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// apply p to the severity sev of r, a renewal when all its names are on certificates seen before,
+// a critical certificate (ex: a weak key or lookalike names) stays critical
+func (p *alertPolicy) apply(r result, sev severity, renewal bool) severity {
+	if sev >= severityCritical {
+		return sev
+	}
+
+	if !p.allowed(r) {
+		if p.UnknownCA == 0 {
+			return severityCritical
+		}
+		return p.UnknownCA
+	}
+
+	if renewal {
+		if p.Renewal == 0 {
+			return severityInfo
+		}
+		return p.Renewal
+	}
+
+	return sev
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var errUnknownPurpose = errors.New("unknown key usage")
+
+// oidPattern matches dotted OIDs, accepted for extended key usages findcert has no name for
+var oidPattern = regexp.MustCompile(`^[0-2](\.[0-9]+)+$`)
+
+// purposeFlags restrict results to certificates of a particular purpose
+type purposeFlags struct {
+	eku      *string
+	keyUsage *string
+}
+
+func addPurposeFlags(fs *flag.FlagSet) purposeFlags {
+	return purposeFlags{
+		eku:      fs.String("eku", "", "comma separated extended key usages a certificate must have one of, prefix with ! to leave out (ex: serverAuth,!emailProtection)"),
+		keyUsage: fs.String("key-usage", "", "comma separated key usages a certificate must have one of, prefix with ! to leave out (ex: keyCertSign)"),
+	}
+}
+
+// usageFilter of names a certificate must have one of, and names it must have none of
+type usageFilter struct {
+	include []string
+	exclude []string
+}
+
+// matches reports whether names satisfy the filter, an empty filter matches everything
+func (u usageFilter) matches(names []string) bool {
+	has := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		has[name] = struct{}{}
+	}
+
+	for _, name := range u.exclude {
+		if _, ok := has[name]; ok {
+			return false
+		}
+	}
+	if len(u.include) == 0 {
+		return true
+	}
+	for _, name := range u.include {
+		if _, ok := has[name]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseUsageFilter from a comma separated list, each name checked by valid
+func parseUsageFilter(list string, valid func(name string) bool) (usageFilter, error) {
+	var u usageFilter
+	for _, name := range splitList(list) {
+		exclude := strings.HasPrefix(name, "!")
+		name = strings.TrimPrefix(name, "!")
+		if !valid(name) {
+			return usageFilter{}, fmt.Errorf("%w (%v)", errUnknownPurpose, name)
+		}
+
+		if exclude {
+			u.exclude = append(u.exclude, name)
+		} else {
+			u.include = append(u.include, name)
+		}
+	}
+
+	return u, nil
+}
+
+// purposeFilter is the extended key usages and key usages results are filtered by
+type purposeFilter struct {
+	eku      usageFilter
+	keyUsage usageFilter
+}
+
+// filter from the flags
+func (f purposeFlags) filter() (purposeFilter, error) {
+	return newPurposeFilter(*f.eku, *f.keyUsage)
+}
+
+// newPurposeFilter from comma separated lists of usages, extended key usages are named as in
+// -format=json output or given as OIDs
+func newPurposeFilter(ekus string, keyUsages string) (purposeFilter, error) {
+	eku, err := parseUsageFilter(ekus, func(name string) bool {
+		for _, known := range extKeyUsageNames {
+			if name == known {
+				return true
+			}
+		}
+		return oidPattern.MatchString(name)
+	})
+	if err != nil {
+		return purposeFilter{}, err
+	}
+
+	keyUsage, err := parseUsageFilter(keyUsages, func(name string) bool {
+		for _, known := range keyUsageNames {
+			if name == known.name {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return purposeFilter{}, err
+	}
+
+	return purposeFilter{eku: eku, keyUsage: keyUsage}, nil
+}
+
+// apply the filter to results, a certificate without an extended key usage extension
+// only matches an -eku filter that has no included usages
+func (p purposeFilter) apply(results []result) []result {
+	var kept []result
+	for _, r := range results {
+		if p.eku.matches(extKeyUsages(r.cert())) && p.keyUsage.matches(keyUsages(r.cert())) {
+			kept = append(kept, r)
+		}
+	}
+
+	return kept
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+var (
+	errNtfyTopic = errors.New("ntfy notifier needs url of a topic (ex: https://ntfy.sh/mytopic)")
+	errGotifyKey = errors.New("gotify notifier needs token, an application token")
+)
+
+// pushTitle of event, shown as the notification's title
+func pushTitle(event any) string {
+	switch e := event.(type) {
+	case certificateEvent:
+		return "New certificate for " + e.Certificate.displayName()
+	case certificateDigest:
+		return fmt.Sprintf("%v new certificates", e.Count)
+	}
+
+	return "findcert"
+}
+
+// newNtfySink publishes to the ntfy topic at cfg.URL, with token as an access token if the topic
+// is protected
+func newNtfySink(cfg notifierConfig) (eventSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("%w (%v)", errNtfyTopic, cfg.URL)
+	}
+	topic := path.Base(u.Path)
+	if topic == "/" || topic == "." {
+		return nil, fmt.Errorf("%w (%v)", errNtfyTopic, cfg.URL)
+	}
+	// messages are published as JSON to the server's root, which names the topic in the body
+	u.Path = path.Dir(strings.TrimSuffix(u.Path, "/"))
+
+	message, err := cfg.message()
+	if err != nil {
+		return nil, err
+	}
+
+	s := newWebhookSink(u.String(), withMessage(message, func(msg, source string, event any) ([]byte, error) {
+		return formatNtfy(topic, msg, event)
+	}))
+	if cfg.Token != "" {
+		s.header = http.Header{"Authorization": {"Bearer " + cfg.Token}}
+	}
+
+	return s, nil
+}
+
+// ntfyPriority of sev, from 1 (min) to 5 (max, a long vibration and pop-over)
+func ntfyPriority(sev severity) int {
+	switch sev {
+	case severityCritical:
+		return 5
+	case severityWarning:
+		return 4
+	}
+
+	return 3
+}
+
+// formatNtfy as a JSON message published to topic
+func formatNtfy(topic, text string, event any) ([]byte, error) {
+	msg := struct {
+		Topic    string   `json:"topic"`
+		Title    string   `json:"title"`
+		Message  string   `json:"message"`
+		Priority int      `json:"priority"`
+		Tags     []string `json:"tags"`
+	}{
+		Topic:    topic,
+		Title:    pushTitle(event),
+		Message:  text,
+		Priority: ntfyPriority(eventSeverity(event)),
+		Tags:     []string{"lock"},
+	}
+	if eventSeverity(event) >= severityCritical {
+		// ntfy shows tags matching an emoji short code as the emoji
+		msg.Tags = append(msg.Tags, "rotating_light")
+	}
+
+	return json.Marshal(msg)
+}
+
+// newGotifySink sends messages to the Gotify server at cfg.URL as the application of token
+func newGotifySink(cfg notifierConfig) (eventSink, error) {
+	if cfg.URL == "" {
+		return nil, errNotifierURL
+	}
+	if cfg.Token == "" {
+		return nil, errGotifyKey
+	}
+
+	u := cfg.URL
+	if !strings.HasSuffix(u, "/message") {
+		u = strings.TrimSuffix(u, "/") + "/message"
+	}
+
+	message, err := cfg.message()
+	if err != nil {
+		return nil, err
+	}
+
+	s := newWebhookSink(u, withMessage(message, formatGotify))
+	s.header = http.Header{"X-Gotify-Key": {cfg.Token}}
+
+	return s, nil
+}
+
+// gotifyPriority of sev, the Android app notifies with sound from 4 and pops up from 8
+func gotifyPriority(sev severity) int {
+	switch sev {
+	case severityCritical:
+		return 8
+	case severityWarning:
+		return 5
+	}
+
+	return 2
+}
+
+// formatGotify as a message of the Gotify API
+func formatGotify(text, source string, event any) ([]byte, error) {
+	msg := struct {
+		Title    string `json:"title"`
+		Message  string `json:"message"`
+		Priority int    `json:"priority"`
+	}{
+		Title:    pushTitle(event),
+		Message:  text,
+		Priority: gotifyPriority(eventSeverity(event)),
+	}
+
+	return json.Marshal(msg)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// matchMode is how certificateSearch matches its Domain against the identities of certificates
+type matchMode int
+
+const (
+	// matchLike treats Domain as a LIKE pattern (ex: %.example.com)
+	matchLike matchMode = iota
+	// matchExact matches only identities equal to Domain
+	matchExact
+	// matchSubdomains matches Domain and any name below it, literally
+	matchSubdomains
+)
+
+// certificateSearch is a query for certificates on crt.sh, compiled by sql rather than written out
+// as a constant for every combination of its options
+type certificateSearch struct {
+	Domain string
+	Match  matchMode
+	// Limit of rows returned, 0 for no limit
+	Limit int
+	// IssuedAfter, if set, skips certificates with an earlier NotBefore
+	IssuedAfter time.Time
+	// ExcludeExpired skips certificates whose NotAfter has passed on crt.sh's clock
+	ExcludeExpired bool
+	// Dedupe returns each certificate once even if several of its identities match, so Limit counts
+	// certificates rather than identities
+	Dedupe bool
+}
+
+// sql of s and its parameters, newest certificates first
+func (s certificateSearch) sql() (string, []any) {
+	var args []any
+	param := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	query := resultColumns
+	if s.Dedupe {
+		query = "SELECT DISTINCT ON (certificate_id) " + strings.TrimPrefix(resultColumns, "SELECT ")
+	}
+
+	var where []string
+	switch s.Match {
+	case matchExact:
+		where = append(where, "name_value = "+param(s.Domain))
+	case matchSubdomains:
+		where = append(where, "(name_value = "+param(s.Domain)+" OR name_value LIKE "+param("%."+escapeLike(s.Domain))+")")
+	default:
+		where = append(where, "name_value LIKE "+param(s.Domain))
+	}
+	if !s.IssuedAfter.IsZero() {
+		where = append(where, "x509_notBefore(certificate) > "+param(s.IssuedAfter.UTC()))
+	}
+	if s.ExcludeExpired {
+		where = append(where, "x509_notAfter(certificate) > now() AT TIME ZONE 'UTC'")
+	}
+
+	query += " WHERE " + strings.Join(where, " AND ") + " ORDER BY certificate_id DESC"
+	if s.Limit > 0 {
+		query += " LIMIT " + param(s.Limit)
+	}
+
+	return query + ";", args
+}
+
+// searchCertificates matching s, newest first, each parsed when first needed so r.parse reports
+// a certificate that can't be parsed
+func searchCertificates(ctx context.Context, s certificateSearch) ([]result, error) {
+	query, args := s.sql()
+	return queryCertificates(ctx, query, args...)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultCrtshQPS and defaultCrtshConcurrency keep bulk use polite to the public database
+	defaultCrtshQPS         = 2
+	defaultCrtshConcurrency = 4
+)
+
+// crtshLimiter is shared by every query to crt.sh, set by the -crtsh-qps and -crtsh-concurrency flags
+var crtshLimiter = &queryLimiter{qps: defaultCrtshQPS, concurrency: defaultCrtshConcurrency}
+
+// queryLimiter spaces queries to at most qps a second with at most concurrency running at once,
+// either is unlimited when not positive
+type queryLimiter struct {
+	qps         float64
+	concurrency int
+
+	mu    sync.Mutex
+	next  time.Time
+	slots chan struct{}
+}
+
+// acquire waits for a query to be allowed, the returned func must be called when it is done
+func (l *queryLimiter) acquire(ctx context.Context) (release func(), err error) {
+	l.mu.Lock()
+	if l.slots == nil && l.concurrency > 0 {
+		l.slots = make(chan struct{}, l.concurrency)
+	}
+	slots := l.slots
+
+	var wait time.Duration
+	if l.qps > 0 {
+		now := time.Now()
+		if l.next.Before(now) {
+			l.next = now
+		}
+		wait = l.next.Sub(now)
+		l.next = l.next.Add(time.Duration(float64(time.Second) / l.qps))
+	}
+	l.mu.Unlock()
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case slots <- struct{}{}:
+	}
+
+	return func() { <-slots }, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/simplylib/multierror"
+)
+
+var (
+	errExpectedRawQuery      = errors.New("expected 1 argument: SQL query, or -file")
+	errRawCertificateColumn  = errors.New("query must select a certificate column with the DER of each certificate")
+	errRawUnexpectedDERValue = errors.New("certificate column is not bytea")
+)
+
+func runRawSQL(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	file := fs.String("file", "", "read the query from this file instead of the argument")
+	timeout := fs.Duration("timeout", time.Minute, "statement timeout of the query on crt.sh")
+	output := addOutputFlags(fs)
+	parseFlags(fs, args)
+
+	var query string
+	switch {
+	case *file != "" && fs.NArg() == 0:
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			return fmt.Errorf("could not read query (%w)", err)
+		}
+		query = string(data)
+	case *file == "" && fs.NArg() == 1:
+		query = fs.Arg(0)
+	default:
+		return errExpectedRawQuery
+	}
+
+	if err := output.validate(); err != nil {
+		return err
+	}
+	defer output.quietLogs()()
+
+	results, err := rawQuery(ctx, query, *timeout)
+	if err != nil {
+		return err
+	}
+
+	return output.write(ctx, "raw-sql", strings.TrimSpace(query), results)
+}
+
+// rawQuery run in a read-only transaction on crt.sh, the query must select a certificate column and
+// may select certificate_id (or id), issuer_ca_id and first_seen to fill in those details of results
+func rawQuery(ctx context.Context, query string, timeout time.Duration) (results []result, err error) {
+	err = crtshMirrors.withDB(ctx, func(db *sql.DB) (err error) {
+		results, err = rawQueryDB(ctx, db, query, timeout)
+		return err
+	})
+	if err != nil {
+		// the certificates scanned before cancellation are still returned
+		if ctx.Err() != nil {
+			return results, err
+		}
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// rawQueryDB runs rawQuery on db
+func rawQueryDB(ctx context.Context, db *sql.DB, query string, timeout time.Duration) (results []result, err error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("could not begin read-only transaction (%w)", err)
+	}
+	// nothing is ever committed
+	defer func() {
+		if err2 := tx.Rollback(); err2 != nil && !errors.Is(err2, sql.ErrTxDone) {
+			err = multierror.Append(err, err2)
+		}
+	}()
+
+	// SET does not take parameters, the timeout is an integer so it is safe to format in
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", timeout.Milliseconds())); err != nil {
+		return nil, fmt.Errorf("could not set statement timeout (%w)", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("could not execute SQL on postgres (%w)", err)
+	}
+	defer func() {
+		err = multierror.Append(err, rows.Close())
+	}()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("could not read columns (%w)", err)
+	}
+
+	certColumn, idColumn, caColumn, firstSeenColumn := -1, -1, -1, -1
+	for i, name := range columns {
+		switch strings.ToLower(name) {
+		case "certificate":
+			certColumn = i
+		case "certificate_id", "id":
+			idColumn = i
+		case "issuer_ca_id":
+			caColumn = i
+		case "first_seen":
+			firstSeenColumn = i
+		}
+	}
+	if certColumn == -1 {
+		return nil, fmt.Errorf("%w (got %v)", errRawCertificateColumn, strings.Join(columns, ", "))
+	}
+
+	values := make([]any, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	// a query joining identities returns a row per name, keep each certificate once
+	seen := make(map[[sha256.Size]byte]struct{})
+	for rows.Next() {
+		if err = ctx.Err(); err != nil {
+			return results, fmt.Errorf("stopped scanning after (%v) certificates (%w)", len(results), err)
+		}
+
+		if err = rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("could not scan row (%w)", err)
+		}
+
+		der, ok := values[certColumn].([]byte)
+		if !ok {
+			return nil, fmt.Errorf("%w (%T)", errRawUnexpectedDERValue, values[certColumn])
+		}
+		if err = crtshUsage.row(len(der)); err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(der)
+		if _, ok := seen[sum]; ok {
+			continue
+		}
+		seen[sum] = struct{}{}
+
+		var id, caID int64
+		if idColumn != -1 {
+			id, _ = values[idColumn].(int64)
+		}
+		if caColumn != -1 {
+			caID, _ = values[caColumn].(int64)
+		}
+		r := newResult(id, caID, der)
+		if firstSeenColumn != -1 {
+			if t, ok := values[firstSeenColumn].(time.Time); ok {
+				r.firstSeen = t.UTC()
+			}
+		}
+
+		if _, err = r.parse(); err != nil {
+			return nil, err
+		}
+
+		results = append(results, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not read rows (%w)", err)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// readAPIMaxAge is how long responses of the read-only API may be cached, monitors poll far less often
+const readAPIMaxAge = "public, max-age=30"
+
+// readAPITables served by the read-only API and queryable by Grafana's JSON datasource
+var readAPITables = []string{"certificates", "expiry", "alerts"}
+
+// monitorCertificates are the latest certificates found by a monitor, soonest to expire first
+type monitorCertificates struct {
+	Project      string            `json:"project,omitempty"`
+	Monitor      string            `json:"monitor"`
+	Query        string            `json:"query"`
+	Certificates []certificateInfo `json:"certificates"`
+}
+
+// monitorExpiry is the certificate of a monitor expiring soonest, the one to renew next
+type monitorExpiry struct {
+	Project       string     `json:"project,omitempty"`
+	Monitor       string     `json:"monitor"`
+	Query         string     `json:"query"`
+	NotAfter      *time.Time `json:"not_after,omitempty"`
+	ExpiresInDays *int       `json:"expires_in_days,omitempty"`
+	CommonName    string     `json:"common_name,omitempty"`
+	SHA256        string     `json:"sha256,omitempty"`
+}
+
+// readAlert is an alert of the dashboard as JSON
+type readAlert struct {
+	At      time.Time `json:"at"`
+	Project string    `json:"project,omitempty"`
+	Name    string    `json:"name"`
+	certificateEvent
+}
+
+// readAPIHandler serves a read-only, cacheable view of the daemon's monitors of project for dashboards
+// and status pages, apart from /healthz which is for operations:
+//
+//	GET /api/v1/certificates  latest certificates per monitor
+//	GET /api/v1/expiry        soonest expiry per monitor, soonest first
+//	GET /api/v1/alerts        recent alerts, newest first
+//
+// and under /grafana/ the endpoints of Grafana's JSON datasource, whose targets are the same tables.
+// The monitors outside projects are served for "", every monitor for allProjects
+type readAPIHandler struct {
+	d       *daemon
+	project string
+}
+
+func (h readAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/grafana/") {
+		h.serveGrafana(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	now := time.Now()
+	w.Header().Set("Cache-Control", readAPIMaxAge)
+	switch strings.TrimPrefix(r.URL.Path, "/api/v1/") {
+	case "certificates":
+		writeJSON(w, http.StatusOK, h.certificates())
+	case "expiry":
+		writeJSON(w, http.StatusOK, h.expiry(now))
+	case "alerts":
+		writeJSON(w, http.StatusOK, h.alerts())
+	default:
+		writeJSONError(w, http.StatusNotFound, "not found, expected one of "+strings.Join(readAPITables, ", "))
+	}
+}
+
+// certificates of every monitor of the project
+func (h readAPIHandler) certificates() []monitorCertificates {
+	monitors := h.d.projectMonitors(h.project)
+
+	all := make([]monitorCertificates, 0, len(monitors))
+	for _, m := range monitors {
+		m.mu.Lock()
+		latest := m.latest
+		m.mu.Unlock()
+
+		mc := monitorCertificates{Project: m.project, Monitor: m.config.Name, Query: m.watcher.query, Certificates: []certificateInfo{}}
+		for _, r := range latest {
+			mc.Certificates = append(mc.Certificates, r.info())
+		}
+		sort.SliceStable(mc.Certificates, func(i, j int) bool {
+			return mc.Certificates[i].NotAfter.Before(mc.Certificates[j].NotAfter)
+		})
+		all = append(all, mc)
+	}
+
+	return all
+}
+
+// expiry of every monitor of the project at now, of its certificate not yet expired that expires soonest
+func (h readAPIHandler) expiry(now time.Time) []monitorExpiry {
+	certs := h.certificates()
+
+	all := make([]monitorExpiry, 0, len(certs))
+	for _, mc := range certs {
+		e := monitorExpiry{Project: mc.Project, Monitor: mc.Monitor, Query: mc.Query}
+		for _, c := range mc.Certificates {
+			if c.NotAfter.Before(now) {
+				continue
+			}
+			notAfter, days := c.NotAfter, int(c.NotAfter.Sub(now).Hours()/24)
+			e.NotAfter, e.ExpiresInDays, e.CommonName, e.SHA256 = &notAfter, &days, c.displayName(), c.SHA256
+			break
+		}
+		all = append(all, e)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].NotAfter == nil || all[j].NotAfter == nil {
+			return all[j].NotAfter == nil && all[i].NotAfter != nil
+		}
+		return all[i].NotAfter.Before(*all[j].NotAfter)
+	})
+
+	return all
+}
+
+// alerts of every monitor of the project
+func (h readAPIHandler) alerts() []readAlert {
+	recent := h.d.alerts.recent(h.project)
+
+	alerts := make([]readAlert, 0, len(recent))
+	for _, a := range recent {
+		alerts = append(alerts, readAlert{At: a.At, Project: a.Project, Name: a.Name, certificateEvent: a.certificateEvent})
+	}
+
+	return alerts
+}
+
+// grafanaColumn and grafanaTable are a table response of Grafana's JSON datasource
+type grafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type grafanaTable struct {
+	Type    string          `json:"type"`
+	Columns []grafanaColumn `json:"columns"`
+	Rows    [][]any         `json:"rows"`
+}
+
+// serveGrafana the endpoints of Grafana's JSON datasource, GET / to test the connection, POST
+// /search for the tables and POST /query for the tables its targets name
+func (h readAPIHandler) serveGrafana(w http.ResponseWriter, r *http.Request) {
+	switch strings.TrimPrefix(r.URL.Path, "/grafana") {
+	case "/":
+		writeJSON(w, http.StatusOK, struct {
+			Status string `json:"status"`
+		}{"ok"})
+	case "/search":
+		writeJSON(w, http.StatusOK, readAPITables)
+	case "/query":
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		var req struct {
+			Targets []struct {
+				Target string `json:"target"`
+			} `json:"targets"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "could not decode query")
+			return
+		}
+
+		now := time.Now()
+		tables := make([]grafanaTable, 0, len(req.Targets))
+		for _, t := range req.Targets {
+			tables = append(tables, h.grafanaTable(t.Target, now))
+		}
+		writeJSON(w, http.StatusOK, tables)
+	default:
+		writeJSONError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// monitorLabel of a monitor in a table, its name prefixed by its project
+func monitorLabel(project, monitor string) string {
+	if project == "" {
+		return monitor
+	}
+
+	return project + "/" + monitor
+}
+
+// grafanaTable named target at now, empty for an unknown target
+func (h readAPIHandler) grafanaTable(target string, now time.Time) grafanaTable {
+	t := grafanaTable{Type: "table", Rows: [][]any{}}
+
+	switch target {
+	case "certificates":
+		t.Columns = []grafanaColumn{{"Monitor", "string"}, {"Common name", "string"}, {"Issuer", "string"}, {"NotAfter", "time"}, {"SHA-256", "string"}}
+		for _, mc := range h.certificates() {
+			for _, c := range mc.Certificates {
+				t.Rows = append(t.Rows, []any{monitorLabel(mc.Project, mc.Monitor), c.displayName(), c.IssuerName, c.NotAfter.UnixMilli(), c.SHA256})
+			}
+		}
+	case "expiry":
+		t.Columns = []grafanaColumn{{"Monitor", "string"}, {"Common name", "string"}, {"NotAfter", "time"}, {"Expires in days", "number"}}
+		for _, e := range h.expiry(now) {
+			if e.NotAfter == nil {
+				t.Rows = append(t.Rows, []any{monitorLabel(e.Project, e.Monitor), "", nil, nil})
+				continue
+			}
+			t.Rows = append(t.Rows, []any{monitorLabel(e.Project, e.Monitor), e.CommonName, e.NotAfter.UnixMilli(), *e.ExpiresInDays})
+		}
+	case "alerts":
+		t.Columns = []grafanaColumn{{"Found", "time"}, {"Severity", "string"}, {"Query", "string"}, {"Common name", "string"}, {"Issuer", "string"}}
+		for _, a := range h.alerts() {
+			t.Rows = append(t.Rows, []any{a.At.UnixMilli(), a.Severity.String(), a.Query, a.Name, a.Certificate.IssuerName})
+		}
+	}
+
+	return t
+}
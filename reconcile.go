@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	errExpectedInventory = errors.New("expected an inventory of hostnames via -expected")
+	errInventoryFormat   = errors.New("unknown inventory format, expected list, zone or tfstate")
+)
+
+// reconciliation of the names CT knows under an apex against the names an inventory expects
+type reconciliation struct {
+	Apex string `json:"apex"`
+	// Unexpected names are on certificates but not in the inventory, possibly shadow IT
+	Unexpected []reconciledName `json:"unexpected"`
+	// Uncertified names are in the inventory without a certificate, possibly dead records
+	Uncertified []string `json:"uncertified"`
+	// Matched is the number of names both in the inventory and on certificates
+	Matched int `json:"matched"`
+}
+
+// reconciledName found in CT with the certificate covering it
+type reconciledName struct {
+	Name     string    `json:"name"`
+	SHA256   string    `json:"sha256"`
+	Issuer   string    `json:"issuer"`
+	NotAfter time.Time `json:"not_after"`
+}
+
+// readInventory of hostnames from the file at name in format, list, zone or tfstate, "" picks one by
+// the file's extension
+func readInventory(name, format string) ([]string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".tfstate", ".json":
+			format = "tfstate"
+		case ".zone", ".db":
+			format = "zone"
+		default:
+			format = "list"
+		}
+	}
+
+	switch format {
+	case "list":
+		return readDomainsFile(name)
+	case "zone":
+		return readZoneFile(name)
+	case "tfstate":
+		return readTerraformState(name)
+	}
+
+	return nil, fmt.Errorf("%w (%v)", errInventoryFormat, format)
+}
+
+// terraformState is the part of a Terraform state file holding DNS records
+type terraformState struct {
+	Resources []struct {
+		Type      string `json:"type"`
+		Instances []struct {
+			Attributes map[string]any `json:"attributes"`
+		} `json:"instances"`
+	} `json:"resources"`
+}
+
+// readTerraformState at name for the hostnames of its DNS record resources (ex: aws_route53_record,
+// cloudflare_record or google_dns_record_set), from their fqdn, hostname or name attribute
+func readTerraformState(name string) ([]string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not read Terraform state (%w)", err)
+	}
+
+	var state terraformState
+	if err = json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("could not decode Terraform state (%v) (%w)", name, err)
+	}
+
+	var names []string
+	for _, resource := range state.Resources {
+		if !strings.Contains(resource.Type, "record") {
+			continue
+		}
+		for _, instance := range resource.Instances {
+			attrs := instance.Attributes
+			if t, ok := attrs["type"].(string); ok {
+				if _, ok = zoneHostTypes[strings.ToUpper(t)]; !ok {
+					continue
+				}
+			}
+			for _, key := range []string{"fqdn", "hostname", "name"} {
+				if host, ok := attrs[key].(string); ok && strings.Contains(strings.TrimSuffix(host, "."), ".") {
+					names = append(names, strings.TrimSuffix(strings.ToLower(host), "."))
+					break
+				}
+			}
+		}
+	}
+
+	return names, nil
+}
+
+// reconcile the names of apex in results at now against expected, the inventory names under apex,
+// a wildcard in either covering the names it matches
+func reconcile(apex string, results []result, expected []string, now time.Time) reconciliation {
+	rec := reconciliation{Apex: apex, Unexpected: []reconciledName{}, Uncertified: []string{}}
+
+	inventory := make(map[string]struct{})
+	for _, name := range expected {
+		if name == apex || strings.HasSuffix(name, "."+apex) {
+			inventory[name] = struct{}{}
+		}
+	}
+
+	for _, name := range inventoryNames(apex, results) {
+		_, ok := inventory[name]
+		for expectedName := range inventory {
+			ok = ok || wildcardCovers(expectedName, name)
+		}
+		if ok {
+			rec.Matched++
+			continue
+		}
+
+		n := reconciledName{Name: name}
+		if r, _, ok := coveringCertificate(name, results, now); ok {
+			info := r.info()
+			n.SHA256, n.Issuer, n.NotAfter = info.SHA256, info.IssuerName, info.NotAfter
+		}
+		rec.Unexpected = append(rec.Unexpected, n)
+	}
+
+	for name := range inventory {
+		covered := false
+		if strings.HasPrefix(name, "*.") {
+			for _, r := range results {
+				for _, n := range r.cert().DNSNames {
+					n = strings.ToLower(n)
+					covered = covered || n == name || wildcardCovers(name, n)
+				}
+			}
+		} else {
+			_, _, covered = coveringCertificate(name, results, now)
+		}
+		if !covered {
+			rec.Uncertified = append(rec.Uncertified, name)
+		}
+	}
+	sort.Strings(rec.Uncertified)
+
+	return rec
+}
+
+func runReconcile(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	expected := fs.String("expected", "", "comma separated files of the hostnames expected to exist: lists of one per line, DNS zone files or Terraform state")
+	inventoryFormat := fs.String("expected-format", "", "format of the -expected files: list, zone or tfstate, by default picked by extension")
+	domainsFile := fs.String("domains-file", "", "read apex domains from this file, one per line, as well as the arguments")
+	limit := fs.Int("n", 1000, "number of latest entries to check per apex domain")
+	format := fs.String("format", "text", "output format: text or json")
+	output := addOutputFileFlag(fs)
+	parseFlags(fs, args)
+
+	switch *format {
+	case "text", "json":
+	default:
+		return fmt.Errorf("%w (%v)", errUnknownFormat, *format)
+	}
+
+	var inventory []string
+	for _, file := range splitList(*expected) {
+		names, err := readInventory(file, *inventoryFormat)
+		if err != nil {
+			return err
+		}
+		inventory = append(inventory, names...)
+	}
+	if len(inventory) == 0 {
+		return errExpectedInventory
+	}
+	for i, name := range inventory {
+		inventory[i] = strings.ToLower(name)
+	}
+
+	apexes := fs.Args()
+	if *domainsFile != "" {
+		fromFile, err := readDomainsFile(*domainsFile)
+		if err != nil {
+			return err
+		}
+		apexes = append(apexes, fromFile...)
+	}
+	if len(apexes) == 0 {
+		return errExpectedDomains
+	}
+
+	now := time.Now()
+	recs := make([]reconciliation, 0, len(apexes))
+	for _, apex := range apexes {
+		apex = strings.ToLower(apex)
+		set, err := newPatternSet([]string{apex, "%." + apex}, nil, nil)
+		if err != nil {
+			return err
+		}
+		results, err := getCertificatesByPatterns(ctx, set, *limit)
+		if err != nil {
+			return fmt.Errorf("could not getCertificates of (%v) error (%w)", apex, err)
+		}
+
+		recs = append(recs, reconcile(apex, results, inventory, now))
+	}
+
+	return writeOutput(*output, func(out io.Writer) error {
+		if *format == "json" {
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(recs); err != nil {
+				return fmt.Errorf("could not write JSON (%w)", err)
+			}
+			return nil
+		}
+
+		for _, rec := range recs {
+			fmt.Fprintf(out, "Apex: (%v) Matched: (%v) Not in inventory: (%v) Without certificates: (%v)\n",
+				rec.Apex, rec.Matched, len(rec.Unexpected), len(rec.Uncertified))
+			for _, n := range rec.Unexpected {
+				fmt.Fprintf(out, "  not in inventory %v Expires: (%v) Issuer: (%v) SHA-256: (%v)\n",
+					displayIDN(n.Name),
+					n.NotAfter.UTC().Format(time.RFC3339),
+					n.Issuer,
+					n.SHA256,
+				)
+			}
+			for _, name := range rec.Uncertified {
+				fmt.Fprintf(out, "  no certificate %v\n", displayIDN(name))
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errRedisURL   = errors.New("expected a redis:// or rediss:// URL")
+	errRedisReply = errors.New("unexpected reply from Redis")
+)
+
+// redisPoolSize is how many commands a redisClient runs at once, each on its own connection
+const redisPoolSize = 8
+
+// redisClient speaks just enough RESP to GET and SET with an expiry, over a pool of up to
+// redisPoolSize connections so one slow reply doesn't hold up the other commands, a connection is
+// dropped after an error
+type redisClient struct {
+	addr     string
+	useTLS   bool
+	username string
+	password string
+	db       int
+	// timeout of each command, waiting for a free connection included
+	timeout time.Duration
+
+	// slots hold a token for each command running, idle the connections between commands
+	slots chan struct{}
+	idle  chan *redisConn
+}
+
+// redisConn is a connection of a redisClient
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// newRedisClient of a redis://[user:password@]host[:port][/db] URL, rediss:// for TLS
+func newRedisClient(rawURL string, timeout time.Duration) (*redisClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Host == "" {
+		return nil, fmt.Errorf("%w (%v)", errRedisURL, rawURL)
+	}
+
+	c := &redisClient{
+		addr:    u.Host,
+		useTLS:  u.Scheme == "rediss",
+		timeout: timeout,
+		slots:   make(chan struct{}, redisPoolSize),
+		idle:    make(chan *redisConn, redisPoolSize),
+	}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("%w (%v)", errRedisURL, rawURL)
+		}
+	}
+
+	return c, nil
+}
+
+// get the value of key, ok false when it isn't set
+func (c *redisClient) get(key string) (value []byte, ok bool, err error) {
+	reply, err := c.do("GET", key)
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+	value, ok = reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("%w (%v) to GET", errRedisReply, reply)
+	}
+
+	return value, true, nil
+}
+
+// set key to value expiring after ttl
+func (c *redisClient) set(key string, value []byte, ttl time.Duration) error {
+	_, err := c.do("SET", key, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+// do the command on an idle connection, or a new one if none is, within the timeout, the reply is
+// nil, a string, an int64 or []byte
+func (c *redisClient) do(args ...string) (any, error) {
+	deadline := time.Now().Add(c.timeout)
+
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	select {
+	case c.slots <- struct{}{}:
+	case <-timer.C:
+		return nil, fmt.Errorf("could not run Redis command, every connection busy for (%v)", c.timeout)
+	}
+	defer func() { <-c.slots }()
+
+	var rc *redisConn
+	select {
+	case rc = <-c.idle:
+	default:
+		var err error
+		if rc, err = c.dial(deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := rc.roundTrip(args, deadline)
+	if err != nil {
+		// the connection may be mid-reply, a new one is dialed in its place
+		rc.conn.Close()
+		return nil, err
+	}
+	c.idle <- rc
+
+	return reply, nil
+}
+
+// dial the server by deadline, authenticating and selecting the database
+func (c *redisClient) dial(deadline time.Time) (*redisConn, error) {
+	dialer := &net.Dialer{Deadline: deadline}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if c.useTLS {
+		host, _, _ := net.SplitHostPort(c.addr)
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.addr, &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+	} else {
+		conn, err = dialer.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to Redis (%w)", err)
+	}
+	rc := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+
+	var setup [][]string
+	switch {
+	case c.username != "" && c.password != "":
+		setup = append(setup, []string{"AUTH", c.username, c.password})
+	case c.password != "":
+		setup = append(setup, []string{"AUTH", c.password})
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	for _, args := range setup {
+		if _, err = rc.roundTrip(args, deadline); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("could not set up Redis connection (%w)", err)
+		}
+	}
+
+	return rc, nil
+}
+
+// roundTrip args as a RESP array of bulk strings and read the reply by deadline
+func (c *redisConn) roundTrip(args []string, deadline time.Time) (any, error) {
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, fmt.Errorf("could not send Redis command (%w)", err)
+	}
+
+	return c.readReply()
+}
+
+// readReply of a simple string, error, integer or bulk string, a nil bulk string is nil
+func (c *redisConn) readReply() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("could not read Redis reply (%w)", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("%w (empty line)", errRedisReply)
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, fmt.Errorf("%w (%v)", errRedisReply, line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("%w (%v)", errRedisReply, line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err = io.ReadFull(c.r, data); err != nil {
+			return nil, fmt.Errorf("could not read Redis reply (%w)", err)
+		}
+		return data[:n], nil
+	}
+
+	return nil, fmt.Errorf("%w (%v)", errRedisReply, line)
+}
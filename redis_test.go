@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveFakeRedis answers GET <key> with the key as its value, after delay for the key "slow"
+func serveFakeRedis(t *testing.T, delay time.Duration) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					// *2 $3 GET $n key
+					var args []string
+					for i := 0; i < 5; i++ {
+						line, err := r.ReadString('\n')
+						if err != nil {
+							return
+						}
+						args = append(args, strings.TrimSuffix(line, "\r\n"))
+					}
+					key := args[4]
+					if key == "slow" {
+						time.Sleep(delay)
+					}
+					fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(key), key)
+				}
+			}(conn)
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestRedisClientPool(t *testing.T) {
+	addr := serveFakeRedis(t, 500*time.Millisecond)
+	c, err := newRedisClient("redis://"+addr, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slow := make(chan error, 1)
+	go func() {
+		_, _, err := c.get("slow")
+		slow <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// a command isn't held up by another's slow reply
+	start := time.Now()
+	value, ok, err := c.get("fast")
+	if err != nil || !ok || string(value) != "fast" {
+		t.Fatalf("got (%s) (%v) (%v), want fast", value, ok, err)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("fast command took (%v) behind the slow one", elapsed)
+	}
+	if err = <-slow; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRedisClientTimeout(t *testing.T) {
+	addr := serveFakeRedis(t, 500*time.Millisecond)
+	c, err := newRedisClient("redis://"+addr, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err = c.get("slow"); err == nil {
+		t.Fatal("slow reply within the timeout, want an error")
+	}
+
+	// the connection timed out mid-reply is dropped rather than reused
+	value, ok, err := c.get("fast")
+	if err != nil || !ok || string(value) != "fast" {
+		t.Errorf("got (%s) (%v) (%v) after a timeout, want fast", value, ok, err)
+	}
+}
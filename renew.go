@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// renewHook runs a command, such as an ACME client, for each name whose newest certificate is
+// expiring within before. It runs once per certificate, a name is only renewed again once a newer
+// certificate for it is found and that one nears expiry too
+type renewHook struct {
+	args   []string
+	before time.Duration
+	// renewed names and the expiry of the certificate the hook last ran for
+	renewed map[string]time.Time
+}
+
+// newRenewHook from a command line whose arguments may hold {} for the name to renew and {not_after}
+// for when its certificate expires, also set as $FINDCERT_NAME and $FINDCERT_NOT_AFTER. before is a
+// duration (default 720h, when certificates start warning they are expiring)
+func newRenewHook(command, before string) (*renewHook, error) {
+	args, err := splitCommand(command)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse renew command (%v) (%w)", command, err)
+	}
+	if len(args) == 0 {
+		return nil, errExecCommand
+	}
+
+	h := &renewHook{args: args, before: expiringSoon, renewed: make(map[string]time.Time)}
+	if before != "" {
+		if h.before, err = time.ParseDuration(before); err != nil {
+			return nil, fmt.Errorf("could not parse renew_before (%w)", err)
+		}
+	}
+
+	return h, nil
+}
+
+// newestExpiry of each name in results, the expiry of the certificate that covers it the longest
+func newestExpiry(results []result) map[string]time.Time {
+	expiry := make(map[string]time.Time)
+	for _, r := range results {
+		names := r.cert().DNSNames
+		if len(names) == 0 && r.cert().Subject.CommonName != "" {
+			names = []string{r.cert().Subject.CommonName}
+		}
+		for _, name := range names {
+			name = strings.ToLower(name)
+			if r.cert().NotAfter.After(expiry[name]) {
+				expiry[name] = r.cert().NotAfter
+			}
+		}
+	}
+
+	return expiry
+}
+
+// check results at now, running the hook for names expiring within before. A failed run is
+// logged and retried on the next check
+func (h *renewHook) check(ctx context.Context, results []result, now time.Time) {
+	for name, notAfter := range newestExpiry(results) {
+		if notAfter.Sub(now) > h.before || h.renewed[name].Equal(notAfter) {
+			continue
+		}
+
+		replacer := strings.NewReplacer("{}", name, "{not_after}", notAfter.UTC().Format(time.RFC3339))
+		args := make([]string, 0, len(h.args))
+		for _, arg := range h.args {
+			args = append(args, replacer.Replace(arg))
+		}
+		env := append(os.Environ(),
+			"FINDCERT_NAME="+name,
+			"FINDCERT_NOT_AFTER="+notAfter.UTC().Format(time.RFC3339),
+		)
+
+		log.Printf("Renewing: (%v) Expires: (%v)\n", name, notAfter)
+		if err := runCommand(ctx, args, env); err != nil {
+			log.Printf("could not renew (%v) (%v)\n", name, err)
+			continue
+		}
+		h.renewed[name] = notAfter
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// validityGap is a period in which no certificate was valid
+type validityGap struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// renewalAnalysis of the validity windows of a set of certificates
+type renewalAnalysis struct {
+	Gaps            []validityGap
+	Renewals        int
+	Overlaps        int
+	LateRenewals    int
+	AverageLeadTime time.Duration
+}
+
+// dedupeCertificates removes precertificates whose final certificate is also present,
+// they share an issuer and serial number but are separate log entries
+func dedupeCertificates(certs []*x509.Certificate) []*x509.Certificate {
+	seen := make(map[string]struct{}, len(certs))
+	out := make([]*x509.Certificate, 0, len(certs))
+	for _, cert := range certs {
+		key := string(cert.RawIssuer) + "/" + cert.SerialNumber.String()
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		out = append(out, cert)
+	}
+
+	return out
+}
+
+// sortByValidity orders certs by NotBefore then NotAfter
+func sortByValidity(certs []*x509.Certificate) {
+	sort.SliceStable(certs, func(i, j int) bool {
+		if !certs[i].NotBefore.Equal(certs[j].NotBefore) {
+			return certs[i].NotBefore.Before(certs[j].NotBefore)
+		}
+		return certs[i].NotAfter.Before(certs[j].NotAfter)
+	})
+}
+
+// analyzeRenewals finds gaps in coverage across all certs and, for certificates covering the same
+// names, how long before expiry each was renewed
+func analyzeRenewals(certs []*x509.Certificate) renewalAnalysis {
+	var a renewalAnalysis
+	if len(certs) == 0 {
+		return a
+	}
+
+	certs = dedupeCertificates(certs)
+	sortByValidity(certs)
+
+	coveredUntil := certs[0].NotAfter
+	for _, cert := range certs[1:] {
+		if cert.NotBefore.After(coveredUntil) {
+			a.Gaps = append(a.Gaps, validityGap{From: coveredUntil, To: cert.NotBefore})
+		}
+		if cert.NotAfter.After(coveredUntil) {
+			coveredUntil = cert.NotAfter
+		}
+	}
+
+	previous := make(map[string]*x509.Certificate)
+	var totalLead time.Duration
+	for _, cert := range certs {
+		key := nameSetKey(newCertificateInfo(cert))
+
+		prev, ok := previous[key]
+		previous[key] = cert
+		if !ok {
+			continue
+		}
+
+		lead := prev.NotAfter.Sub(cert.NotBefore)
+		if lead > 0 {
+			a.Overlaps++
+		} else {
+			a.LateRenewals++
+		}
+		totalLead += lead
+		a.Renewals++
+	}
+	if a.Renewals > 0 {
+		a.AverageLeadTime = totalLead / time.Duration(a.Renewals)
+	}
+
+	return a
+}
+
+func runRenewals(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	source := addSourceFlags(fs, 1000)
+	output := addOutputFileFlag(fs)
+	parseFlags(fs, args)
+
+	_, results, err := source.certificates(ctx, fs)
+	if err != nil {
+		return err
+	}
+	certs := certificatesOf(results)
+
+	certs = dedupeCertificates(certs)
+	sortByValidity(certs)
+
+	a := analyzeRenewals(certs)
+
+	return writeOutput(*output, func(out io.Writer) error {
+		for _, cert := range certs {
+			fmt.Fprintf(out, "%v - %v CommonName: (%v)\n",
+				cert.NotBefore.UTC().Format(time.RFC3339),
+				cert.NotAfter.UTC().Format(time.RFC3339),
+				cert.Subject.CommonName,
+			)
+		}
+
+		fmt.Fprintf(out, "Renewals: (%v) Overlapping: (%v) After expiry: (%v) Average lead time: (%v)\n",
+			a.Renewals, a.Overlaps, a.LateRenewals, a.AverageLeadTime.Round(time.Hour))
+
+		if len(a.Gaps) == 0 {
+			fmt.Fprintln(out, "No coverage gaps")
+		}
+		for _, gap := range a.Gaps {
+			fmt.Fprintf(out, "Coverage gap: %v - %v (%v)\n",
+				gap.From.UTC().Format(time.RFC3339),
+				gap.To.UTC().Format(time.RFC3339),
+				gap.To.Sub(gap.From).Round(time.Minute),
+			)
+		}
+
+		return nil
+	})
+}
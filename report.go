@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed templates/report.html.tmpl
+var reportTemplates embed.FS
+
+var (
+	reportTemplate = template.Must(template.New("report.html.tmpl").Funcs(template.FuncMap{
+		"date": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 MST") },
+		"join": strings.Join,
+		"sub":  func(a, b int) int { return a - b },
+	}).ParseFS(reportTemplates, "templates/report.html.tmpl"))
+
+	errReportOutput = errors.New("expected -html output file")
+)
+
+// reportData is passed to the report template
+type reportData struct {
+	Query        string
+	GeneratedAt  time.Time
+	Stats        certificateStats
+	Warned       int
+	Certificates []reportCertificate
+}
+
+// reportCertificate is a certificate with the details shown in the report
+type reportCertificate struct {
+	certificateInfo
+	KeyAlgorithm       string
+	KeyBits            int
+	SignatureAlgorithm string
+	ExpiresIn          string
+	Warnings           []string
+}
+
+// newReportCertificate with the details of cert as of now
+func newReportCertificate(cert *x509.Certificate, now time.Time) reportCertificate {
+	rc := reportCertificate{
+		certificateInfo:    newCertificateInfo(cert),
+		KeyAlgorithm:       cert.PublicKeyAlgorithm.String(),
+		KeyBits:            publicKeyBits(cert),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		ExpiresIn:          "expired",
+		Warnings:           certificateWarnings(cert, now),
+	}
+	if d := cert.NotAfter.Sub(now); d > 0 {
+		rc.ExpiresIn = fmt.Sprintf("%v days", int(d.Hours()/24))
+	}
+
+	return rc
+}
+
+func runReport(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	source := addSourceFlags(fs, 100)
+	htmlPath := fs.String("html", "", "write a self-contained HTML report to this file")
+	parseFlags(fs, args)
+
+	if *htmlPath == "" {
+		return errReportOutput
+	}
+
+	query, results, err := source.certificates(ctx, fs)
+	if err != nil {
+		return err
+	}
+	certs := certificatesOf(results)
+
+	now := time.Now()
+	data := reportData{
+		Query:       query,
+		GeneratedAt: now,
+		Stats:       computeStats(certs, now),
+	}
+	for _, cert := range certs {
+		rc := newReportCertificate(cert, now)
+		if len(rc.Warnings) > 0 {
+			data.Warned++
+		}
+
+		data.Certificates = append(data.Certificates, rc)
+	}
+	sort.SliceStable(data.Certificates, func(i, j int) bool {
+		return data.Certificates[i].NotAfter.Before(data.Certificates[j].NotAfter)
+	})
+
+	f, err := os.Create(*htmlPath)
+	if err != nil {
+		return fmt.Errorf("could not create report (%w)", err)
+	}
+
+	if err = reportTemplate.Execute(f, data); err != nil {
+		f.Close()
+		return fmt.Errorf("could not render report (%w)", err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("could not write report (%w)", err)
+	}
+
+	log.Printf("wrote report of (%v) certificates to (%v)\n", len(certs), *htmlPath)
+
+	return nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// oneCRLURL lists Mozilla's OneCRL entries, the certificates Firefox distrusts by issuer and serial
+// or by subject and public key
+const oneCRLURL = "https://firefox.settings.services.mozilla.com/v1/buckets/security-state/collections/onecrl/records"
+
+var errRevokedFound = errors.New("revoked certificates found")
+
+// oneCRLRecord is an entry of OneCRL, either IssuerName and SerialNumber or Subject and PubKeyHash
+// are set, all base64 (DER names, the serial's bytes and SHA-256 of the SubjectPublicKeyInfo)
+type oneCRLRecord struct {
+	IssuerName   string `json:"issuerName"`
+	SerialNumber string `json:"serialNumber"`
+	Subject      string `json:"subject"`
+	PubKeyHash   string `json:"pubKeyHash"`
+	Details      struct {
+		Bug  string `json:"bug"`
+		Why  string `json:"why"`
+		Name string `json:"name"`
+	} `json:"details"`
+}
+
+// revocationSet of OneCRL entries keyed by issuer and serial or by subject and public key
+type revocationSet map[string]oneCRLRecord
+
+// revokedCertificate of the results found in a revocationSet
+type revokedCertificate struct {
+	Reason string `json:"reason,omitempty"`
+	Bug    string `json:"bug,omitempty"`
+	certificateInfo
+}
+
+func issuerSerialKey(issuer []byte, serial *big.Int) string {
+	return "issuer:" + base64.StdEncoding.EncodeToString(issuer) + "/" + serial.Text(16)
+}
+
+func subjectKeyKey(subject []byte, pubKeyHash []byte) string {
+	return "subject:" + base64.StdEncoding.EncodeToString(subject) + "/" + base64.StdEncoding.EncodeToString(pubKeyHash)
+}
+
+// newRevocationSet of records, skipping those that can't be decoded
+func newRevocationSet(records []oneCRLRecord) revocationSet {
+	set := make(revocationSet, len(records))
+	for _, r := range records {
+		switch {
+		case r.IssuerName != "" && r.SerialNumber != "":
+			issuer, err := base64.StdEncoding.DecodeString(r.IssuerName)
+			if err != nil {
+				continue
+			}
+			serial, err := base64.StdEncoding.DecodeString(r.SerialNumber)
+			if err != nil {
+				continue
+			}
+			set[issuerSerialKey(issuer, new(big.Int).SetBytes(serial))] = r
+		case r.Subject != "" && r.PubKeyHash != "":
+			subject, err := base64.StdEncoding.DecodeString(r.Subject)
+			if err != nil {
+				continue
+			}
+			hash, err := base64.StdEncoding.DecodeString(r.PubKeyHash)
+			if err != nil {
+				continue
+			}
+			set[subjectKeyKey(subject, hash)] = r
+		}
+	}
+
+	return set
+}
+
+// revoked entry of cert, by its issuer and serial or its subject and public key
+func (s revocationSet) revoked(cert *x509.Certificate) (oneCRLRecord, bool) {
+	if r, ok := s[issuerSerialKey(cert.RawIssuer, cert.SerialNumber)]; ok {
+		return r, true
+	}
+
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	r, ok := s[subjectKeyKey(cert.RawSubject, sum[:])]
+
+	return r, ok
+}
+
+// loadOneCRL from an http(s) URL or a file previously downloaded from one
+func loadOneCRL(ctx context.Context, location string) (revocationSet, error) {
+	var body io.ReadCloser
+	if strings.HasPrefix(location, "https://") || strings.HasPrefix(location, "http://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not create request (%w)", err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch OneCRL (%w)", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%w (%v)", errHTTPStatus, resp.Status)
+		}
+		body = resp.Body
+	} else {
+		f, err := os.Open(location)
+		if err != nil {
+			return nil, fmt.Errorf("could not open OneCRL (%w)", err)
+		}
+		body = f
+	}
+	defer body.Close()
+
+	var records struct {
+		Data []oneCRLRecord `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(body, 1<<26)).Decode(&records); err != nil {
+		return nil, fmt.Errorf("could not decode OneCRL (%w)", err)
+	}
+
+	return newRevocationSet(records.Data), nil
+}
+
+func runRevoked(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	source := addSourceFlags(fs, 1000)
+	oneCRL := fs.String("onecrl", oneCRLURL, "URL or file of the OneCRL records to check against")
+	format := fs.String("format", "text", "output format: text or json")
+	output := addOutputFileFlag(fs)
+	parseFlags(fs, args)
+
+	switch *format {
+	case "text", "json":
+	default:
+		return fmt.Errorf("%w (%v)", errUnknownFormat, *format)
+	}
+
+	set, err := loadOneCRL(ctx, *oneCRL)
+	if err != nil {
+		return err
+	}
+
+	_, results, err := source.certificates(ctx, fs)
+	if err != nil {
+		return err
+	}
+
+	revoked := []revokedCertificate{}
+	for _, r := range results {
+		record, ok := set.revoked(r.cert())
+		if !ok {
+			continue
+		}
+		revoked = append(revoked, revokedCertificate{
+			Reason:          record.Details.Why,
+			Bug:             record.Details.Bug,
+			certificateInfo: r.info(),
+		})
+	}
+
+	err = writeOutput(*output, func(out io.Writer) error {
+		if *format == "json" {
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(revoked); err != nil {
+				return fmt.Errorf("could not write JSON (%w)", err)
+			}
+		} else {
+			for _, c := range revoked {
+				fmt.Fprintf(out, "Revoked: (%v) CommonName: (%v) Issuer: (%v) SHA-256: (%v) Bug: (%v)\n",
+					c.Reason,
+					displayIDN(c.displayName()),
+					c.IssuerName,
+					c.SHA256,
+					c.Bug,
+				)
+			}
+			fmt.Fprintf(out, "OneCRL entries: (%v) Certificates checked: (%v) Revoked: (%v)\n", len(set), len(results), len(revoked))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(revoked) > 0 {
+		return fmt.Errorf("%w (%v)", errRevokedFound, len(revoked))
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// sarifLog is the subset of SARIF 2.1.0 code scanning dashboards need to track findings
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation  `json:"physicalLocation"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// sarifLevel of a violation of severity sev
+func sarifLevel(sev severity) string {
+	switch sev {
+	case severityCritical:
+		return "error"
+	case severityWarning:
+		return "warning"
+	}
+
+	return "note"
+}
+
+// writeSARIF of the violations in verdicts to w, each located in the policy file at policyPath so
+// dashboards that only accept files in the repository can show them, and fingerprinted by the
+// certificate and rule so a finding is tracked across runs
+func writeSARIF(w io.Writer, verdicts []policyVerdict, policyPath string) error {
+	rules := make([]sarifRule, 0, len(policyRules))
+	for _, rule := range policyRules {
+		rules = append(rules, sarifRule{ID: rule.id, ShortDescription: sarifMessage{Text: rule.description}})
+	}
+
+	results := []sarifResult{}
+	for _, v := range verdicts {
+		for _, violation := range v.Violations {
+			results = append(results, sarifResult{
+				RuleID: violation.Rule,
+				Level:  sarifLevel(violation.Severity),
+				Message: sarifMessage{Text: fmt.Sprintf("%v: %v (https://crt.sh/?sha256=%v)",
+					v.displayName(), violation.Detail, v.SHA256)},
+				Locations: []sarifLocation{{
+					PhysicalLocation: sarifPhysicalLocation{
+						ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(policyPath)},
+					},
+					LogicalLocations: []sarifLogicalLocation{{
+						Name:               v.displayName(),
+						FullyQualifiedName: v.SHA256,
+						Kind:               "certificate",
+					}},
+				}},
+				PartialFingerprints: map[string]string{"certificateSHA256/v1": v.SHA256 + ":" + violation.Rule},
+			})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(sarifLog{
+		Version: "2.1.0",
+		Schema:  sarifSchema,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "findcert",
+				InformationURI: "https://github.com/simplylib/findcert",
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("could not write SARIF (%w)", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errSchedule = errors.New("invalid schedule")
+
+// schedule decides when a monitor next polls crt.sh
+type schedule interface {
+	// next time strictly after t
+	next(t time.Time) time.Time
+}
+
+// every polls at a fixed interval
+type every time.Duration
+
+func (e every) next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// cronSchedule is a 5 field cron expression, each field the set of values it matches
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar are set when the field starts with *, cron matches either day field
+	// when both are restricted and only the restricted one otherwise
+	domStar, dowStar bool
+}
+
+// cronDescriptors are the @ shorthands cron supports
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseSchedule of a cron expression (ex: */15 * * * *), a descriptor (ex: @daily) or @every <duration> (ex: @every 1h30m)
+func parseSchedule(spec string) (schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if strings.HasPrefix(spec, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil || interval < time.Minute {
+			return nil, fmt.Errorf("%w (%v), @every needs a duration of at least 1m", errSchedule, spec)
+		}
+		return every(interval), nil
+	}
+
+	if expr, ok := cronDescriptors[spec]; ok {
+		spec = expr
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w (%v), expected 5 fields: minute hour day-of-month month day-of-week", errSchedule, spec)
+	}
+
+	var (
+		c   cronSchedule
+		err error
+	)
+	bounds := []struct {
+		set      *uint64
+		min, max int
+	}{
+		{&c.minute, 0, 59},
+		{&c.hour, 0, 23},
+		{&c.dom, 1, 31},
+		{&c.month, 1, 12},
+		{&c.dow, 0, 7},
+	}
+	for i, b := range bounds {
+		*b.set, err = parseCronField(fields[i], b.min, b.max)
+		if err != nil {
+			return nil, fmt.Errorf("%w (%v) (%v)", errSchedule, spec, err)
+		}
+	}
+
+	// 7 is another name for Sunday
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domStar = strings.HasPrefix(fields[2], "*")
+	c.dowStar = strings.HasPrefix(fields[4], "*")
+
+	if c.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("%w (%v), it never matches a date", errSchedule, spec)
+	}
+
+	return c, nil
+}
+
+// parseCronField of comma separated values, ranges (a-b) and steps (*/n, a-b/n) into a bit set
+func parseCronField(field string, min int, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepText, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepText)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("bad step (%v)", part)
+			}
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			loText, hiText, isRange := strings.Cut(rng, "-")
+
+			var err error
+			lo, err = strconv.Atoi(loText)
+			if err != nil {
+				return 0, fmt.Errorf("bad value (%v)", part)
+			}
+			hi = lo
+			if isRange {
+				hi, err = strconv.Atoi(hiText)
+				if err != nil {
+					return 0, fmt.Errorf("bad range (%v)", part)
+				}
+			} else if hasStep {
+				// a/n runs from a to the end of the field
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("(%v) out of range %v-%v", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+
+	return set, nil
+}
+
+// next minute after t matching the expression in t's location, zero if it never matches
+func (c cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// every matching expression has a match within 5 years, Feb 29 on a given weekday included
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	// an expression such as 0 0 31 2 * never matches
+	return time.Time{}
+}
+
+// matchesDay of the month and week of t
+func (c cronSchedule) matchesDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case c.domStar && c.dowStar:
+		return true
+	case c.domStar:
+		return dow
+	case c.dowStar:
+		return dom
+	}
+
+	return dom || dow
+}
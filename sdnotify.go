@@ -0,0 +1,75 @@
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// serviceState the daemon reports to a service manager
+type serviceState int
+
+const (
+	// serviceReady once the monitors are running, after start and each reload
+	serviceReady serviceState = iota
+	// serviceReloading while the config is reloaded
+	serviceReloading
+	// serviceStopping once the daemon has been asked to exit
+	serviceStopping
+	// serviceStatus only updates the status line
+	serviceStatus
+)
+
+// serviceNotifier tells a service manager of the daemon's state, status is a human readable summary
+type serviceNotifier interface {
+	notify(state serviceState, status string)
+}
+
+// systemdNotifier implements the sd_notify protocol, doing nothing unless started by systemd with Type=notify
+type systemdNotifier struct {
+	socket string
+}
+
+// newSystemdNotifier from $NOTIFY_SOCKET
+func newSystemdNotifier() systemdNotifier {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	// a leading @ is a Linux abstract socket
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+
+	return systemdNotifier{socket: socket}
+}
+
+func (n systemdNotifier) notify(state serviceState, status string) {
+	if n.socket == "" {
+		return
+	}
+
+	var lines []string
+	switch state {
+	case serviceReady:
+		lines = append(lines, "READY=1")
+	case serviceReloading:
+		lines = append(lines, "RELOADING=1")
+	case serviceStopping:
+		lines = append(lines, "STOPPING=1")
+	}
+	if status != "" {
+		lines = append(lines, "STATUS="+status)
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: n.socket, Net: "unixgram"})
+	if err != nil {
+		log.Printf("could not connect to systemd notify socket (%v)\n", err)
+		return
+	}
+	defer conn.Close()
+
+	_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+	if _, err = conn.Write([]byte(strings.Join(lines, "\n"))); err != nil {
+		log.Printf("could not notify systemd (%v)\n", err)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// splunkFlags configure an optional Splunk HEC sink
+type splunkFlags struct {
+	url   *string
+	token *string
+}
+
+func addSplunkFlags(fs *flag.FlagSet) splunkFlags {
+	return splunkFlags{
+		url:   fs.String("splunk-url", "", "send results to a Splunk HTTP Event Collector at this URL"),
+		token: fs.String("splunk-token", "", "Splunk HEC token (default $SPLUNK_HEC_TOKEN)"),
+	}
+}
+
+// sink configured by the flags, nil if no Splunk URL was given
+func (f splunkFlags) sink() (*splunkSink, error) {
+	if *f.url == "" {
+		return nil, nil
+	}
+	token := *f.token
+	if token == "" {
+		token = os.Getenv("SPLUNK_HEC_TOKEN")
+	}
+	if token == "" {
+		return nil, errSplunkToken
+	}
+
+	return newSplunkSink(*f.url, token), nil
+}
+
+func runSearch(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	source := addSourceFlags(fs, 1)
+	output := addOutputFlags(fs)
+	count := fs.Bool("count", false, "print only the number of matching certificates, counted on crt.sh without fetching them")
+	parseFlags(fs, args)
+
+	if err := output.validate(); err != nil {
+		return err
+	}
+	defer output.quietLogs()()
+
+	if *count {
+		n, err := source.count(ctx, fs)
+		if err != nil {
+			return err
+		}
+		return writeOutput(*output.output, func(out io.Writer) error {
+			fmt.Fprintln(out, n)
+			return nil
+		})
+	}
+
+	domain, results, err := source.certificates(ctx, fs)
+	if err != nil {
+		return err
+	}
+
+	return output.write(ctx, "search", domain, results)
+}
+
+// printResult to w as text prefixed by indent, followed by any warnings and optionally its PEM,
+// logging more than maxSkew from NotBefore is a warning
+func printResult(w io.Writer, r result, now time.Time, maxSkew time.Duration, printPEM bool, indent string) error {
+	cert := r.cert()
+	issuer := friendlyIssuer(cert)
+	if r.issuerCAID != 0 {
+		issuer += fmt.Sprintf(" CA ID: %v", r.issuerCAID)
+	}
+	fmt.Fprintf(w, "%vCommonName: (%v) Issued On: (%v) Issuer: (%v)\n",
+		indent,
+		displayIDN(cert.Subject.CommonName),
+		cert.NotBefore,
+		issuer,
+	)
+	fmt.Fprintf(w, "%v  Subject: (%v) Issuer DN: (%v)\n", indent, rfc2253(cert.RawSubject, cert.Subject), rfc2253(cert.RawIssuer, cert.Issuer))
+	if !r.firstSeen.IsZero() {
+		fmt.Fprintf(w, "%v  First Logged: (%v) Expires: (%v)\n", indent, r.firstSeen, cert.NotAfter)
+	}
+	if warnings := resultWarnings(r, now, maxSkew); len(warnings) > 0 {
+		fmt.Fprintf(w, "%v  Warnings: (%v)\n", indent, strings.Join(warnings, "; "))
+	}
+
+	if printPEM {
+		err := pem.Encode(w, &pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: cert.Raw,
+		})
+		if err != nil {
+			return fmt.Errorf("could not encode PEM (%w)", err)
+		}
+	}
+
+	return nil
+}
+
+// issuerGroup is the results issued by one CA
+type issuerGroup struct {
+	name    string
+	caID    int64
+	results []result
+}
+
+// groupByIssuer ordered by most results, then name
+func groupByIssuer(results []result) []issuerGroup {
+	var (
+		groups []issuerGroup
+		index  = make(map[string]int)
+	)
+	for _, r := range results {
+		name := friendlyIssuer(r.cert())
+		key := fmt.Sprintf("%v/%v", r.issuerCAID, r.cert().Issuer.String())
+
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, issuerGroup{name: name, caID: r.issuerCAID})
+		}
+		groups[i].results = append(groups[i].results, r)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		if len(groups[i].results) != len(groups[j].results) {
+			return len(groups[i].results) > len(groups[j].results)
+		}
+		return groups[i].name < groups[j].name
+	})
+
+	return groups
+}
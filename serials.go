@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"sort"
+)
+
+// serialCollision is a serial number an issuer put on more than one distinct certificate
+type serialCollision struct {
+	issuer  string
+	serial  string
+	results []result
+}
+
+// issuanceKey of cert, equal for a precertificate and the certificate issued from it which
+// legitimately share a serial number, but differs when anything they should agree on does not
+func issuanceKey(cert *x509.Certificate) [sha256.Size]byte {
+	var b bytes.Buffer
+	b.Write(cert.RawSubject)
+	b.Write(cert.RawSubjectPublicKeyInfo)
+	b.WriteString(cert.NotBefore.UTC().String())
+	b.WriteString(cert.NotAfter.UTC().String())
+	for _, name := range cert.DNSNames {
+		b.WriteString(name + "\x00")
+	}
+
+	return sha256.Sum256(b.Bytes())
+}
+
+// serialCollisions in results, serial numbers reused by an issuer for different certificates, which
+// RFC 5280 forbids and CAs must report as an incident
+func serialCollisions(results []result) []serialCollision {
+	type group struct {
+		serialCollision
+		issuances map[[sha256.Size]byte]struct{}
+	}
+
+	var (
+		groups []*group
+		index  = make(map[string]*group)
+	)
+	for _, r := range results {
+		key := string(r.cert().RawIssuer) + "/" + r.cert().SerialNumber.String()
+		g, ok := index[key]
+		if !ok {
+			g = &group{
+				serialCollision: serialCollision{issuer: friendlyIssuer(r.cert()), serial: r.cert().SerialNumber.Text(16)},
+				issuances:       make(map[[sha256.Size]byte]struct{}),
+			}
+			index[key] = g
+			groups = append(groups, g)
+		}
+		g.results = append(g.results, r)
+		g.issuances[issuanceKey(r.cert())] = struct{}{}
+	}
+
+	var collisions []serialCollision
+	for _, g := range groups {
+		if len(g.issuances) > 1 {
+			collisions = append(collisions, g.serialCollision)
+		}
+	}
+	sort.SliceStable(collisions, func(i, j int) bool {
+		return collisions[i].issuer < collisions[j].issuer
+	})
+
+	return collisions
+}
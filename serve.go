@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func runServe(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	maxLimit := fs.Int("max-n", 100, "maximum number of entries a request may ask for")
+	cacheSize := fs.Int("cache-size", 256, "number of responses to cache, 0 to disable caching")
+	cacheTTL := fs.Duration("cache-ttl", 5*time.Minute, "how long a cached response is served before crt.sh is queried again")
+	cacheRedis := fs.String("cache-redis", "", "share cached responses between replicas in Redis at this redis://[user:password@]host[:port][/db] URL, rediss:// for TLS, behind the -cache-size responses kept in memory")
+	tokensFile := fs.String("tokens-file", "", "require an API token from this JSON file of {\"tokens\": [{\"name\", \"sha256\", \"rate_per_minute\", \"admin\"}]}, admin tokens may POST /admin/tokens/rotate?name=<name>")
+	tlsFlags := addServeTLSFlags(fs)
+	parseFlags(fs, args)
+
+	tlsConfig, acme, err := tlsFlags.config()
+	if err != nil {
+		return err
+	}
+
+	cache := newResponseCache(*cacheSize, *cacheTTL)
+	if cache != nil && *cacheRedis != "" {
+		if cache.remote, err = newRedisClient(*cacheRedis, 5*time.Second); err != nil {
+			return err
+		}
+	}
+
+	var auth *tokenAuth
+	if *tokensFile != "" {
+		if auth, err = newTokenAuth(*tokensFile); err != nil {
+			return err
+		}
+	}
+	// protect is next behind an API token when a tokens file is given
+	protect := func(admin bool, next http.Handler) http.Handler {
+		if auth == nil {
+			return next
+		}
+		return auth.require(admin, next)
+	}
+
+	mux := http.NewServeMux()
+	// -force is for the operator's own queries, requests are always admitted by counting
+	admit := &admission{timeout: crtshAdmission.timeout, maxMatches: crtshAdmission.maxMatches}
+	mux.Handle("/search", protect(false, searchHandler{maxLimit: *maxLimit, cache: cache, admission: admit}))
+	mux.Handle("/metrics", protect(false, metricsHandler{cache: cache}))
+	if auth != nil {
+		mux.Handle("/admin/tokens/rotate", protect(true, auth))
+	}
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig:         tlsConfig,
+	}
+	servers := []*http.Server{srv}
+
+	if *tlsFlags.redirectAddr != "" {
+		var handler http.Handler = redirectHandler{httpsAddr: *addr}
+		if acme != nil {
+			handler = acme.HTTPHandler(handler)
+		}
+		redirect := &http.Server{
+			Addr:              *tlsFlags.redirectAddr,
+			Handler:           handler,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		servers = append(servers, redirect)
+
+		go func() {
+			log.Printf("redirecting HTTP to HTTPS on (%v)\n", redirect.Addr)
+			if err := redirect.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("could not serve HTTP redirects (%v)\n", err)
+			}
+		}()
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		for _, s := range servers {
+			if err := s.Shutdown(shutdownCtx); err != nil {
+				log.Printf("could not shutdown HTTP server (%v)\n", err)
+			}
+		}
+	}()
+
+	log.Printf("serving on (%v)\n", *addr)
+
+	switch {
+	case acme != nil:
+		err = srv.ListenAndServeTLS("", "")
+	case tlsFlags.enabled():
+		err = srv.ListenAndServeTLS(*tlsFlags.cert, *tlsFlags.key)
+	default:
+		err = srv.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return fmt.Errorf("could not serve HTTP (%w)", err)
+}
+
+// searchResponse is the JSON body returned by /search
+type searchResponse struct {
+	// SchemaVersion is jsonSchemaVersion
+	SchemaVersion int               `json:"schema_version"`
+	Query         string            `json:"query"`
+	Certificates  []certificateInfo `json:"certificates"`
+}
+
+// searchHandler serves GET /search?q=<domain name>&n=<limit>, from cache unless the request has
+// Cache-Control: no-cache, a pattern too broad for crt.sh is refused
+type searchHandler struct {
+	maxLimit  int
+	cache     *responseCache
+	admission *admission
+}
+
+func (h searchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		writeJSONError(w, http.StatusBadRequest, "missing query parameter q")
+		return
+	}
+	set, err := newPatternSet([]string{q}, nil, nil)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	domain := set.include[0]
+
+	limit := 1
+	if n := r.URL.Query().Get("n"); n != "" {
+		limit, err = strconv.Atoi(n)
+		if err != nil || limit < 1 || limit > h.maxLimit {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("n must be between 1 and %v", h.maxLimit))
+			return
+		}
+	}
+
+	key := cacheKey(domain, limit)
+	if h.cache != nil {
+		if bypassCache(r) {
+			h.cache.bypasses.Add(1)
+			w.Header().Set("X-Cache", "BYPASS")
+		} else if resp, ok := h.cache.get(key, time.Now()); ok {
+			w.Header().Set("X-Cache", "HIT")
+			writeJSON(w, http.StatusOK, resp)
+			return
+		} else {
+			w.Header().Set("X-Cache", "MISS")
+		}
+	}
+
+	if err = h.admission.admit(r.Context(), set); err != nil {
+		if errors.Is(err, errBroadPattern) {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%v (%v)", errBroadPattern, domain))
+			return
+		}
+		log.Printf("could not admit (%v) error (%v)\n", domain, err)
+		writeJSONError(w, http.StatusBadGateway, "could not query crt.sh")
+		return
+	}
+
+	results, err := getCertificates(r.Context(), domain, limit)
+	if err != nil {
+		log.Printf("could not getCertificates of (%v) error (%v)\n", domain, err)
+		var queryErr *queryError
+		if errors.As(err, &queryErr) && queryErr.retryable {
+			w.Header().Set("Retry-After", "30")
+			writeJSONError(w, http.StatusServiceUnavailable, "crt.sh is unavailable, try again later")
+			return
+		}
+		writeJSONError(w, http.StatusBadGateway, "could not query crt.sh")
+		return
+	}
+
+	resp := searchResponse{
+		SchemaVersion: jsonSchemaVersion,
+		Query:         domain,
+		Certificates:  make([]certificateInfo, 0, len(results)),
+	}
+	now := time.Now()
+	for _, res := range results {
+		resp.Certificates = append(resp.Certificates, res.info().notYetValid(now))
+	}
+
+	if h.cache != nil {
+		h.cache.put(key, resp, now)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// metricsHandler serves GET /metrics in the Prometheus text format, of the cache if there is one
+// and the circuit of each crt.sh host
+type metricsHandler struct {
+	cache *responseCache
+}
+
+func (h metricsHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if h.cache != nil {
+		h.cache.writeMetrics(w)
+	}
+	crtshMirrors.writeMetrics(w)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("could not write JSON response (%v)\n", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{msg})
+}
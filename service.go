@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+var (
+	errExpectedServiceAction = errors.New("expected 1 argument: install, uninstall or run")
+	errUnknownServiceAction  = errors.New("unknown service action")
+	errServiceUnsupported    = errors.New("installing a service is only supported with systemd or on Windows")
+)
+
+const serviceDescription = "Monitors Certificate Transparency logs for new certificates of configured domains"
+
+func runService(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	name := fs.String("name", "findcert", "name of the service")
+	configPath := fs.String("config", "", "JSON config file of the daemon, see findcert daemon")
+	logFile := fs.String("log-file", "", "with run, append logs to this file instead of stderr")
+	parseFlags(fs, args)
+
+	if fs.NArg() != 1 {
+		return errExpectedServiceAction
+	}
+
+	switch fs.Arg(0) {
+	case "install":
+		if *configPath == "" {
+			return errExpectedConfig
+		}
+
+		// the service manager starts the daemon from another working directory
+		config, err := filepath.Abs(*configPath)
+		if err != nil {
+			return fmt.Errorf("could not resolve config path (%w)", err)
+		}
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("could not find the findcert executable (%w)", err)
+		}
+
+		runArgs := []string{"service", "-name", *name, "-config", config}
+		if *logFile != "" {
+			logPath, err := filepath.Abs(*logFile)
+			if err != nil {
+				return fmt.Errorf("could not resolve log file path (%w)", err)
+			}
+			runArgs = append(runArgs, "-log-file", logPath)
+		}
+		runArgs = append(runArgs, "run")
+
+		if err = installService(*name, exe, runArgs); err != nil {
+			return fmt.Errorf("could not install service (%v) (%w)", *name, err)
+		}
+		log.Printf("installed and started service (%v)\n", *name)
+	case "uninstall":
+		if err := uninstallService(*name); err != nil {
+			return fmt.Errorf("could not uninstall service (%v) (%w)", *name, err)
+		}
+		log.Printf("uninstalled service (%v)\n", *name)
+	case "run":
+		if *configPath == "" {
+			return errExpectedConfig
+		}
+
+		if *logFile != "" {
+			f, err := os.OpenFile(*logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				return fmt.Errorf("could not open log file (%w)", err)
+			}
+			defer f.Close()
+
+			log.SetOutput(f)
+			log.SetFlags(log.LstdFlags)
+		}
+
+		return runAsService(ctx, *name, *configPath)
+	default:
+		return fmt.Errorf("%w (%v)", errUnknownServiceAction, fs.Arg(0))
+	}
+
+	return nil
+}
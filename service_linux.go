@@ -0,0 +1,90 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const systemdUnitDir = "/etc/systemd/system"
+
+// systemdUnit of the daemon, it notifies systemd once its monitors are running and reloads on SIGHUP
+const systemdUnit = `[Unit]
+Description=%v
+Documentation=https://github.com/simplylib/findcert
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=notify
+NotifyAccess=main
+ExecStart=%v
+ExecReload=/bin/kill -HUP $MAINPID
+Restart=on-failure
+RestartSec=30
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// systemdQuote an ExecStart argument, % and $ would otherwise be expanded by systemd
+func systemdQuote(arg string) string {
+	arg = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$").Replace(arg)
+	return `"` + arg + `"`
+}
+
+// systemctl runs systemctl with args, returning its output in the error when it fails
+func systemctl(args ...string) error {
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("could not run systemctl %v (%w) %v", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// installService as a systemd unit, enabling and starting it
+func installService(name string, exe string, args []string) error {
+	quoted := []string{systemdQuote(exe)}
+	for _, arg := range args {
+		quoted = append(quoted, systemdQuote(arg))
+	}
+
+	unit := fmt.Sprintf(systemdUnit, serviceDescription, strings.Join(quoted, " "))
+	path := filepath.Join(systemdUnitDir, name+".service")
+	if err := os.WriteFile(path, []byte(unit), 0o644); err != nil {
+		return fmt.Errorf("could not write unit file (%w)", err)
+	}
+
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+
+	return systemctl("enable", "--now", name+".service")
+}
+
+// uninstallService stopping and disabling its systemd unit before removing it
+func uninstallService(name string) error {
+	if err := systemctl("disable", "--now", name+".service"); err != nil {
+		// the unit file may be all that is left of a partial install, remove it regardless
+		log.Println(err)
+	}
+
+	path := filepath.Join(systemdUnitDir, name+".service")
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("could not remove unit file (%w)", err)
+	}
+
+	return systemctl("daemon-reload")
+}
+
+// runAsService under systemd, which is told of readiness and reloads through sd_notify
+func runAsService(ctx context.Context, name string, configPath string) error {
+	return runDaemonConfig(ctx, configPath)
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !windows
+
+package main
+
+import "context"
+
+func installService(name string, exe string, args []string) error {
+	return errServiceUnsupported
+}
+
+func uninstallService(name string) error {
+	return errServiceUnsupported
+}
+
+// runAsService in the foreground, leaving supervision to whatever started it (ex: launchd, rc.d)
+func runAsService(ctx context.Context, name string, configPath string) error {
+	return runDaemonConfig(ctx, configPath)
+}
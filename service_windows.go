@@ -0,0 +1,327 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// the service control manager API of advapi32.dll, see https://learn.microsoft.com/en-us/windows/win32/services/services
+var (
+	advapi32 = syscall.NewLazyDLL("advapi32.dll")
+
+	procOpenSCManagerW                = advapi32.NewProc("OpenSCManagerW")
+	procCloseServiceHandle            = advapi32.NewProc("CloseServiceHandle")
+	procCreateServiceW                = advapi32.NewProc("CreateServiceW")
+	procOpenServiceW                  = advapi32.NewProc("OpenServiceW")
+	procDeleteService                 = advapi32.NewProc("DeleteService")
+	procStartServiceW                 = advapi32.NewProc("StartServiceW")
+	procControlService                = advapi32.NewProc("ControlService")
+	procChangeServiceConfig2W         = advapi32.NewProc("ChangeServiceConfig2W")
+	procStartServiceCtrlDispatcherW   = advapi32.NewProc("StartServiceCtrlDispatcherW")
+	procRegisterServiceCtrlHandlerExW = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procSetServiceStatus              = advapi32.NewProc("SetServiceStatus")
+)
+
+const (
+	scManagerAllAccess = 0xf003f
+	serviceAllAccess   = 0xf01ff
+	serviceStop        = 0x0020
+	serviceQueryStatus = 0x0004
+	accessDelete       = 0x10000
+
+	serviceWin32OwnProcess = 0x10
+	serviceAutoStart       = 2
+	serviceErrorNormal     = 1
+	serviceConfigDesc      = 1
+
+	serviceStopped      = 1
+	serviceStartPending = 2
+	serviceStopPending  = 3
+	serviceRunning      = 4
+
+	serviceAcceptStop        = 0x1
+	serviceAcceptShutdown    = 0x4
+	serviceAcceptParamChange = 0x8
+
+	serviceControlStop        = 1
+	serviceControlInterrogate = 4
+	serviceControlShutdown    = 5
+	serviceControlParamChange = 6
+
+	errorCallNotImplemented             = 120
+	errorServiceSpecificError           = 1066
+	errorServiceNotActive               = syscall.Errno(1062)
+	errorFailedServiceControllerConnect = syscall.Errno(1063)
+)
+
+// windowsServiceStatus is SERVICE_STATUS
+type windowsServiceStatus struct {
+	serviceType             uint32
+	currentState            uint32
+	controlsAccepted        uint32
+	win32ExitCode           uint32
+	serviceSpecificExitCode uint32
+	checkPoint              uint32
+	waitHint                uint32
+}
+
+// serviceTableEntry is SERVICE_TABLE_ENTRYW
+type serviceTableEntry struct {
+	name *uint16
+	proc uintptr
+}
+
+// serviceDescriptionW is SERVICE_DESCRIPTIONW
+type serviceDescriptionW struct {
+	description *uint16
+}
+
+// openSCManager on the local machine, close the handle with closeServiceHandle
+func openSCManager() (uintptr, error) {
+	h, _, err := procOpenSCManagerW.Call(0, 0, scManagerAllAccess)
+	if h == 0 {
+		return 0, fmt.Errorf("could not connect to the service control manager (%w)", err)
+	}
+
+	return h, nil
+}
+
+func closeServiceHandle(h uintptr) {
+	_, _, _ = procCloseServiceHandle.Call(h)
+}
+
+// installService with the service control manager to start automatically, and start it
+func installService(name string, exe string, args []string) error {
+	cmd := []string{syscall.EscapeArg(exe)}
+	for _, arg := range args {
+		cmd = append(cmd, syscall.EscapeArg(arg))
+	}
+
+	namePtr, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	cmdPtr, err := syscall.UTF16PtrFromString(strings.Join(cmd, " "))
+	if err != nil {
+		return err
+	}
+	descPtr, err := syscall.UTF16PtrFromString(serviceDescription)
+	if err != nil {
+		return err
+	}
+
+	scm, err := openSCManager()
+	if err != nil {
+		return err
+	}
+	defer closeServiceHandle(scm)
+
+	h, _, err := procCreateServiceW.Call(
+		scm,
+		uintptr(unsafe.Pointer(namePtr)),
+		uintptr(unsafe.Pointer(namePtr)),
+		serviceAllAccess,
+		serviceWin32OwnProcess,
+		serviceAutoStart,
+		serviceErrorNormal,
+		uintptr(unsafe.Pointer(cmdPtr)),
+		0, 0, 0, 0, 0,
+	)
+	if h == 0 {
+		return fmt.Errorf("could not create service (%w)", err)
+	}
+	defer closeServiceHandle(h)
+
+	desc := serviceDescriptionW{description: descPtr}
+	if ok, _, err := procChangeServiceConfig2W.Call(h, serviceConfigDesc, uintptr(unsafe.Pointer(&desc))); ok == 0 {
+		log.Printf("could not set service description (%v)\n", err)
+	}
+
+	if ok, _, err := procStartServiceW.Call(h, 0, 0); ok == 0 {
+		return fmt.Errorf("could not start service (%w)", err)
+	}
+
+	return nil
+}
+
+// uninstallService stopping it if it is running
+func uninstallService(name string) error {
+	namePtr, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+
+	scm, err := openSCManager()
+	if err != nil {
+		return err
+	}
+	defer closeServiceHandle(scm)
+
+	h, _, err := procOpenServiceW.Call(scm, uintptr(unsafe.Pointer(namePtr)), serviceStop|serviceQueryStatus|accessDelete)
+	if h == 0 {
+		return fmt.Errorf("could not open service (%w)", err)
+	}
+	defer closeServiceHandle(h)
+
+	var status windowsServiceStatus
+	if ok, _, err := procControlService.Call(h, serviceControlStop, uintptr(unsafe.Pointer(&status))); ok == 0 && !errors.Is(err, errorServiceNotActive) {
+		log.Printf("could not stop service (%v)\n", err)
+	}
+
+	if ok, _, err := procDeleteService.Call(h); ok == 0 {
+		return fmt.Errorf("could not delete service (%w)", err)
+	}
+
+	return nil
+}
+
+// windowsService runs the daemon for the service control manager, which calls back into it from its own threads
+type windowsService struct {
+	name       *uint16
+	configPath string
+	ctx        context.Context
+	cancel     context.CancelFunc
+	reload     chan os.Signal
+
+	mu     sync.Mutex
+	handle uintptr
+	status windowsServiceStatus
+}
+
+// service being run, the callbacks given to the service control manager can't carry it themselves
+var service *windowsService
+
+// setStatus of the service reported to the service control manager
+func (s *windowsService) setStatus(state uint32, exitCode uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status = windowsServiceStatus{
+		serviceType:  serviceWin32OwnProcess,
+		currentState: state,
+	}
+	switch state {
+	case serviceRunning:
+		s.status.controlsAccepted = serviceAcceptStop | serviceAcceptShutdown | serviceAcceptParamChange
+	case serviceStartPending, serviceStopPending:
+		s.status.waitHint = 30000
+	}
+	if exitCode != 0 {
+		s.status.win32ExitCode = errorServiceSpecificError
+		s.status.serviceSpecificExitCode = exitCode
+	}
+
+	s.reportStatus()
+}
+
+// reportStatus to the service control manager, s.mu must be held
+func (s *windowsService) reportStatus() {
+	if ok, _, err := procSetServiceStatus.Call(s.handle, uintptr(unsafe.Pointer(&s.status))); ok == 0 {
+		log.Printf("could not set service status (%v)\n", err)
+	}
+}
+
+// notify the service control manager, which only knows running and stopping
+func (s *windowsService) notify(state serviceState, status string) {
+	switch state {
+	case serviceReady:
+		s.setStatus(serviceRunning, 0)
+	case serviceStopping:
+		s.setStatus(serviceStopPending, 0)
+	}
+}
+
+// serviceMain is the ServiceMain callback, run by the service control manager on its own thread
+func serviceMain(argc uint32, argv **uint16) uintptr {
+	s := service
+
+	h, _, err := procRegisterServiceCtrlHandlerExW.Call(uintptr(unsafe.Pointer(s.name)), serviceHandlerCallback, 0)
+	if h == 0 {
+		log.Printf("could not register service control handler (%v)\n", err)
+		return 0
+	}
+	s.handle = h
+	s.setStatus(serviceStartPending, 0)
+
+	if err = serveDaemon(s.ctx, s.configPath, s.reload, s); err != nil {
+		log.Printf("daemon stopped (%v)\n", err)
+		s.setStatus(serviceStopped, 1)
+		return 0
+	}
+
+	s.setStatus(serviceStopped, 0)
+	return 0
+}
+
+// serviceHandler is the HandlerEx callback for controls sent to the service
+func serviceHandler(control uint32, eventType uint32, eventData uintptr, handlerContext uintptr) uintptr {
+	s := service
+
+	switch control {
+	case serviceControlStop, serviceControlShutdown:
+		s.cancel()
+	case serviceControlParamChange:
+		// sc control <name> paramchange reloads the config, as SIGHUP does elsewhere
+		select {
+		case s.reload <- syscall.SIGHUP:
+		default:
+		}
+	case serviceControlInterrogate:
+		s.mu.Lock()
+		s.reportStatus()
+		s.mu.Unlock()
+	default:
+		return errorCallNotImplemented
+	}
+
+	return 0
+}
+
+var (
+	serviceMainCallback    = syscall.NewCallback(serviceMain)
+	serviceHandlerCallback = syscall.NewCallback(serviceHandler)
+)
+
+// runAsService for the service control manager, or in the foreground when not started by it
+func runAsService(ctx context.Context, name string, configPath string) error {
+	namePtr, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	service = &windowsService{
+		name:       namePtr,
+		configPath: configPath,
+		ctx:        ctx,
+		cancel:     cancel,
+		reload:     make(chan os.Signal, 1),
+	}
+
+	table := []serviceTableEntry{
+		{name: namePtr, proc: serviceMainCallback},
+		{},
+	}
+
+	// blocks until serviceMain returns
+	ok, _, err := procStartServiceCtrlDispatcherW.Call(uintptr(unsafe.Pointer(&table[0])))
+	if ok == 0 {
+		if errors.Is(err, errorFailedServiceControllerConnect) {
+			return runDaemonConfig(ctx, configPath)
+		}
+		return fmt.Errorf("could not start service control dispatcher (%w)", err)
+	}
+
+	return nil
+}
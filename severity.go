@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var errUnknownSeverity = errors.New("unknown severity, expected info, warning or critical")
+
+// severity of a newly found certificate, notifiers are only sent those at or above their threshold
+type severity int
+
+const (
+	// severityInfo is any new certificate
+	severityInfo severity = iota + 1
+	// severityWarning is a new certificate with warnings or unlike the monitor's usual certificates
+	severityWarning
+	// severityCritical is a new certificate that is weak, from a CA new to the monitor or has names
+	// that impersonate another domain
+	severityCritical
+)
+
+func (s severity) String() string {
+	switch s {
+	case severityInfo:
+		return "info"
+	case severityWarning:
+		return "warning"
+	case severityCritical:
+		return "critical"
+	}
+
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// MarshalText as the severity's name
+func (s severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText from a severity's name
+func (s *severity) UnmarshalText(text []byte) error {
+	parsed, err := parseSeverity(string(text))
+	if err != nil {
+		return err
+	}
+	*s = parsed
+
+	return nil
+}
+
+// parseSeverity from its name, empty is severityInfo
+func parseSeverity(name string) (severity, error) {
+	switch name {
+	case "", "info":
+		return severityInfo, nil
+	case "warning":
+		return severityWarning, nil
+	case "critical":
+		return severityCritical, nil
+	}
+
+	return 0, fmt.Errorf("%w (%v)", errUnknownSeverity, name)
+}
+
+// certificateSeverity of a newly found cert at now
+func certificateSeverity(cert *x509.Certificate, now time.Time) severity {
+	if weakSignature(cert) || weakRSAKey(cert) {
+		return severityCritical
+	}
+	for _, name := range certificateNames(cert) {
+		if len(idnWarnings(name)) > 0 {
+			return severityCritical
+		}
+	}
+
+	if len(certificateWarnings(cert, now)) > 0 {
+		return severityWarning
+	}
+
+	return severityInfo
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errShard = errors.New("expected a shard as index/count (ex: 2/3)")
+
+// shard of the monitors of a config a daemon runs, so daemons sharing a config and a state backend
+// split a large portfolio between them, each monitor run by exactly one
+type shard struct {
+	// index from 1 to count, a count of 0 runs every monitor
+	index, count int
+}
+
+// daemonShard is set by the -shard flag of the daemon, or $FINDCERT_SHARD
+var daemonShard = defaultShard()
+
+// defaultShard from $FINDCERT_SHARD, every monitor if it isn't set or valid
+func defaultShard() shard {
+	var s shard
+	if env := os.Getenv("FINDCERT_SHARD"); env != "" {
+		_ = s.Set(env)
+	}
+
+	return s
+}
+
+func (s *shard) String() string {
+	if s.count == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%v/%v", s.index, s.count)
+}
+
+func (s *shard) Set(value string) error {
+	index, count, ok := strings.Cut(value, "/")
+	if !ok {
+		return fmt.Errorf("%w (%v)", errShard, value)
+	}
+	i, err := strconv.Atoi(index)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", errShard, value)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 1 || i < 1 || i > n {
+		return fmt.Errorf("%w (%v)", errShard, value)
+	}
+	s.index, s.count = i, n
+
+	return nil
+}
+
+// owns is whether the monitor with key is in s
+func (s shard) owns(key string) bool {
+	return s.count == 0 || shardOf(key, s.count) == s.index
+}
+
+// shardOf the monitor with key among count shards, from 1, by the FNV hash of its key so it stays
+// in the same shard across restarts and reloads
+func shardOf(key string, count int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	return int(h.Sum32()%uint32(count)) + 1
+}
+
+// monitors of all in s
+func (s shard) monitors(all []*monitor) []*monitor {
+	if s.count == 0 {
+		return all
+	}
+
+	var owned []*monitor
+	for _, m := range all {
+		if s.owns(m.key()) {
+			owned = append(owned, m)
+		}
+	}
+
+	return owned
+}
+
+// shardLeaseInterval is how often shard leases are renewed, a shard whose daemon died is taken over
+// within about this long of PostgreSQL noticing its connection is gone
+const shardLeaseInterval = 30 * time.Second
+
+// advisory lock classes of the shard leases, locked with the shard index as the second key
+const (
+	postgresShardLock   = "findcert_shard"
+	postgresReplicaLock = "findcert_replica"
+	postgresTryLock     = "SELECT pg_try_advisory_lock(hashtext($1), $2::int);"
+	postgresUnlock      = "SELECT pg_advisory_unlock(hashtext($1), $2::int);"
+)
+
+// shardLeases of daemons sharing a postgres:// state_file, each shard is run by the daemon holding a
+// session advisory lock on it. A daemon locks its own shard, and takes over any other whose lock is
+// free as its daemon's session ended, handing it back once that daemon announces itself again by
+// locking its replica lock. Losing the session loses every lease, so the monitors stop until renew
+// locks them again
+type shardLeases struct {
+	db    *sql.DB
+	shard shard
+
+	// conn is the session holding the locks, nil until renew connects
+	conn *sql.Conn
+	// present is set once this daemon's replica lock is held
+	present bool
+	owned   map[int]bool
+}
+
+func newShardLeases(db *sql.DB, s shard) *shardLeases {
+	return &shardLeases{db: db, shard: s, owned: make(map[int]bool)}
+}
+
+// leaseShards of s among the daemons sharing the state at path, nil if s runs every monitor or the
+// state isn't in PostgreSQL, as then s is a static split nothing takes over
+func leaseShards(path string, s shard) (*shardLeases, error) {
+	if s.count == 0 {
+		return nil, nil
+	}
+	backend, err := backendOf(path)
+	if err != nil {
+		return nil, err
+	}
+	pg, ok := backend.(*postgresBackend)
+	if !ok {
+		log.Printf("running shard (%v) without a postgres:// state_file, its monitors aren't taken over if this daemon stops\n", s.String())
+		return nil, nil
+	}
+
+	return newShardLeases(pg.db, s), nil
+}
+
+// renew the leases, returning whether the shards owned changed, on an error the session is closed
+// and every lease given up
+func (l *shardLeases) renew(ctx context.Context) (changed bool, err error) {
+	if err = l.acquire(ctx, &changed); err != nil {
+		l.drop()
+		if len(l.owned) > 0 {
+			l.owned = make(map[int]bool)
+			changed = true
+		}
+		return changed, fmt.Errorf("could not renew shard leases (%w)", err)
+	}
+
+	return changed, nil
+}
+
+// acquire the daemon's own shard and orphaned ones, handing back those whose daemon is present,
+// setting changed when the shards owned change
+func (l *shardLeases) acquire(ctx context.Context, changed *bool) (err error) {
+	if l.conn == nil {
+		if l.conn, err = l.db.Conn(ctx); err != nil {
+			return err
+		}
+	} else if err = l.conn.PingContext(ctx); err != nil {
+		return err
+	}
+
+	if !l.present {
+		if l.present, err = l.tryLock(ctx, postgresReplicaLock, l.shard.index); err != nil {
+			return err
+		}
+	}
+
+	for i := 1; i <= l.shard.count; i++ {
+		// a shard is left to its own daemon while that is running, this one's own is always wanted
+		present := false
+		if i != l.shard.index {
+			if present, err = l.replicaPresent(ctx, i); err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case l.owned[i] && present:
+			if err = l.unlock(ctx, postgresShardLock, i); err != nil {
+				return err
+			}
+			delete(l.owned, i)
+			*changed = true
+			log.Printf("handing shard (%v/%v) back to its daemon\n", i, l.shard.count)
+		case !l.owned[i] && !present:
+			ok, err := l.tryLock(ctx, postgresShardLock, i)
+			if err != nil {
+				return err
+			}
+			if ok {
+				l.owned[i] = true
+				*changed = true
+				if i != l.shard.index {
+					log.Printf("taking over shard (%v/%v) as its daemon is gone\n", i, l.shard.count)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// replicaPresent is whether the daemon of shard index holds its replica lock
+func (l *shardLeases) replicaPresent(ctx context.Context, index int) (bool, error) {
+	ok, err := l.tryLock(ctx, postgresReplicaLock, index)
+	if err != nil || !ok {
+		return !ok, err
+	}
+
+	return false, l.unlock(ctx, postgresReplicaLock, index)
+}
+
+func (l *shardLeases) tryLock(ctx context.Context, class string, index int) (ok bool, err error) {
+	err = l.conn.QueryRowContext(ctx, postgresTryLock, class, index).Scan(&ok)
+	return ok, err
+}
+
+func (l *shardLeases) unlock(ctx context.Context, class string, index int) error {
+	var ok bool
+	return l.conn.QueryRowContext(ctx, postgresUnlock, class, index).Scan(&ok)
+}
+
+// monitors of all in the shards leased, those of daemonShard for a nil l
+func (l *shardLeases) monitors(all []*monitor) []*monitor {
+	if l == nil {
+		return daemonShard.monitors(all)
+	}
+
+	var owned []*monitor
+	for _, m := range all {
+		if l.owned[shardOf(m.key(), l.shard.count)] {
+			owned = append(owned, m)
+		}
+	}
+
+	return owned
+}
+
+// String lists the shards leased
+func (l *shardLeases) String() string {
+	shards := make([]string, 0, len(l.owned))
+	for i := 1; i <= l.shard.count; i++ {
+		if l.owned[i] {
+			shards = append(shards, fmt.Sprintf("%v/%v", i, l.shard.count))
+		}
+	}
+
+	return strings.Join(shards, ", ")
+}
+
+// drop the session, releasing every lease, rather than return it to the pool still holding them
+func (l *shardLeases) drop() {
+	if l.conn != nil {
+		_ = l.conn.Raw(func(any) error { return driver.ErrBadConn })
+		l.conn = nil
+	}
+	l.present = false
+}
+
+// Close the session, releasing every lease
+func (l *shardLeases) Close() {
+	l.drop()
+	l.owned = make(map[int]bool)
+}
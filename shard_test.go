@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestShardSet(t *testing.T) {
+	tests := []struct {
+		value string
+		want  shard
+		err   bool
+	}{
+		{value: "1/1", want: shard{index: 1, count: 1}},
+		{value: "2/3", want: shard{index: 2, count: 3}},
+		{value: "0/3", err: true},
+		{value: "4/3", err: true},
+		{value: "1/0", err: true},
+		{value: "a/3", err: true},
+		{value: "2", err: true},
+	}
+
+	for _, tt := range tests {
+		var s shard
+		err := s.Set(tt.value)
+		if (err != nil) != tt.err {
+			t.Errorf("%v: error (%v), want error (%v)", tt.value, err, tt.err)
+			continue
+		}
+		if !tt.err && s != tt.want {
+			t.Errorf("%v: (%+v), want (%+v)", tt.value, s, tt.want)
+		}
+	}
+}
+
+func TestShardMonitors(t *testing.T) {
+	var all []*monitor
+	for i := 0; i < 50; i++ {
+		all = append(all, &monitor{project: "p", config: monitorConfig{Name: fmt.Sprintf("m%v", i)}})
+	}
+
+	// every monitor is run by exactly one of the shards
+	runs := make(map[*monitor]int)
+	for i := 1; i <= 3; i++ {
+		for _, m := range (shard{index: i, count: 3}).monitors(all) {
+			runs[m]++
+		}
+	}
+	for _, m := range all {
+		if runs[m] != 1 {
+			t.Errorf("(%v) run by (%v) shards, want 1", m.key(), runs[m])
+		}
+	}
+
+	if got := (shard{}).monitors(all); len(got) != len(all) {
+		t.Errorf("unsharded runs (%v) monitors, want (%v)", len(got), len(all))
+	}
+
+	// a daemon that took over shard 3 runs its monitors as well as those of its own shard
+	leases := &shardLeases{shard: shard{index: 1, count: 3}, owned: map[int]bool{1: true, 3: true}}
+	want := len((shard{index: 1, count: 3}).monitors(all)) + len((shard{index: 3, count: 3}).monitors(all))
+	if got := leases.monitors(all); len(got) != want {
+		t.Errorf("leased runs (%v) monitors, want (%v)", len(got), want)
+	}
+	if got := leases.String(); got != "1/3, 3/3" {
+		t.Errorf("leased (%v), want (1/3, 3/3)", got)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshotVersion is incremented whenever the snapshot format changes incompatibly
+const snapshotVersion = 1
+
+var (
+	errSnapshotVersion = errors.New("unsupported snapshot schema version")
+	errSnapshotNoDER   = errors.New("snapshot does not contain certificate DER, it predates schema version 1")
+)
+
+// snapshot of the results of a query at a point in time
+type snapshot struct {
+	SchemaVersion int                   `json:"schema_version"`
+	Query         string                `json:"query"`
+	TakenAt       time.Time             `json:"taken_at"`
+	Certificates  []snapshotCertificate `json:"certificates"`
+}
+
+// snapshotCertificate keeps the DER alongside its summary so snapshots can be re-analyzed offline
+type snapshotCertificate struct {
+	certificateInfo
+	DER []byte `json:"der"`
+}
+
+// newSnapshot of results found by query
+func newSnapshot(query string, results []result) snapshot {
+	s := snapshot{
+		SchemaVersion: snapshotVersion,
+		Query:         query,
+		TakenAt:       time.Now().UTC(),
+		Certificates:  make([]snapshotCertificate, 0, len(results)),
+	}
+	for _, r := range results {
+		s.Certificates = append(s.Certificates, snapshotCertificate{
+			certificateInfo: r.info(),
+			DER:             r.cert().Raw,
+		})
+	}
+
+	return s
+}
+
+// infos of every certificate in the snapshot
+func (s snapshot) infos() []certificateInfo {
+	infos := make([]certificateInfo, 0, len(s.Certificates))
+	for _, c := range s.Certificates {
+		infos = append(infos, c.certificateInfo)
+	}
+
+	return infos
+}
+
+// parse the certificates stored in the snapshot
+func (s snapshot) parse() ([]result, error) {
+	results := make([]result, 0, len(s.Certificates))
+	for _, c := range s.Certificates {
+		if len(c.DER) == 0 {
+			return nil, errSnapshotNoDER
+		}
+
+		r := newResult(c.ID, c.IssuerCAID, c.DER)
+		if _, err := r.parse(); err != nil {
+			return nil, fmt.Errorf("could not parse x509 certificate (%w)", err)
+		}
+		if c.FirstSeen != nil {
+			r.firstSeen = *c.FirstSeen
+		}
+		results = append(results, r)
+	}
+
+	return results, nil
+}
+
+// readSnapshot from the JSON file at path
+func readSnapshot(path string) (snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return snapshot{}, fmt.Errorf("could not read snapshot (%w)", err)
+	}
+
+	var s snapshot
+	if err = json.Unmarshal(data, &s); err != nil {
+		return snapshot{}, fmt.Errorf("could not decode snapshot (%v) (%w)", path, err)
+	}
+
+	if s.SchemaVersion > snapshotVersion {
+		return snapshot{}, fmt.Errorf("%w (%v) in (%v), expected at most (%v)", errSnapshotVersion, s.SchemaVersion, path, snapshotVersion)
+	}
+
+	return s, nil
+}
+
+// writeSnapshot as JSON to path, replacing any existing file only once fully written
+func writeSnapshot(path string, s snapshot) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode snapshot (%w)", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not create snapshot (%w)", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write snapshot (%w)", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("could not write snapshot (%w)", err)
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("could not replace snapshot (%w)", err)
+	}
+
+	return nil
+}
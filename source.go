@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// largeFetchRows is the estimated row count above which -n 0 asks before fetching
+	largeFetchRows = 10000
+	// fetchPageSize is the rows fetched per query with -n 0
+	fetchPageSize = 1000
+)
+
+var (
+	errExpectedNoArguments = errors.New("expected no arguments when loading a snapshot")
+	errLargeFetch          = errors.New("-n 0 would fetch too many certificates, narrow the patterns or pass -yes")
+	errCountPurpose        = errors.New("-count can't be combined with -eku or -key-usage")
+	errCountValidity       = errors.New("-count can't be combined with -only-expired, -only-currently-valid or -valid-during")
+	errCountLatest         = errors.New("-count can't be combined with -latest-per-name")
+	errExpiredAndValid     = errors.New("-only-expired and -only-currently-valid are mutually exclusive")
+	errValidDuring         = errors.New("expected -valid-during as start,end (ex: 2024-01-01,2024-02-01T12:00:00Z)")
+	// errQueryPrinted stops a command once -print-query has printed its query, it is not a failure
+	errQueryPrinted = errors.New("query printed")
+)
+
+// sourceFlags select whether certificates come from crt.sh or a saved snapshot
+type sourceFlags struct {
+	limit        *int
+	yes          *bool
+	patterns     patternFlags
+	purpose      purposeFlags
+	loadSnapshot *string
+	saveSnapshot *string
+	printQuery   *bool
+	onlyExpired  *bool
+	onlyValid    *bool
+	validDuring  *string
+	history      *bool
+	latest       *bool
+}
+
+func addSourceFlags(fs *flag.FlagSet, defaultLimit int) sourceFlags {
+	return sourceFlags{
+		limit:        fs.Int("n", defaultLimit, "number of entries to return, 0 for all of them"),
+		yes:          fs.Bool("yes", false, "with -n 0, fetch without asking however many certificates match"),
+		patterns:     addPatternFlags(fs),
+		purpose:      addPurposeFlags(fs),
+		loadSnapshot: fs.String("load-snapshot", "", "read certificates from a snapshot file instead of querying crt.sh"),
+		saveSnapshot: fs.String("save-snapshot", "", "save the certificates found to a snapshot file"),
+		printQuery:   fs.Bool("print-query", false, "print the SQL and parameters that would be run on crt.sh instead of running it, with -v also its query plan"),
+		onlyExpired:  fs.Bool("only-expired", false, "only certificates that have expired"),
+		onlyValid:    fs.Bool("only-currently-valid", false, "only certificates within their validity period now, neither expired nor not yet valid"),
+		validDuring:  fs.String("valid-during", "", "only certificates valid at some point between start,end (ex: 2024-01-01,2024-01-31)"),
+		history:      fs.Bool("history", false, "for forensic timelines, fetch every certificate unless -n is given and order them by when they were first logged to CT"),
+		latest:       fs.Bool("latest-per-name", false, "only the newest certificate for each distinct set of names, what each is currently served with, fetching every certificate unless -n is given"),
+	}
+}
+
+// parseDate as RFC 3339 or a date in UTC (ex: 2024-01-31)
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	return time.Parse("2006-01-02", s)
+}
+
+// validityFilter of the -only-expired, -only-currently-valid and -valid-during flags at now
+func (f sourceFlags) validityFilter(now time.Time) (func(r result) bool, error) {
+	if *f.onlyExpired && *f.onlyValid {
+		return nil, errExpiredAndValid
+	}
+
+	var start, end time.Time
+	if *f.validDuring != "" {
+		from, to, ok := strings.Cut(*f.validDuring, ",")
+		if !ok {
+			return nil, errValidDuring
+		}
+		var err error
+		if start, err = parseDate(strings.TrimSpace(from)); err != nil {
+			return nil, fmt.Errorf("%w (%v)", errValidDuring, err)
+		}
+		if end, err = parseDate(strings.TrimSpace(to)); err != nil {
+			return nil, fmt.Errorf("%w (%v)", errValidDuring, err)
+		}
+	}
+
+	return func(r result) bool {
+		if *f.onlyExpired && !r.cert().NotAfter.Before(now) {
+			return false
+		}
+		if *f.onlyValid && (r.cert().NotBefore.After(now) || r.cert().NotAfter.Before(now)) {
+			return false
+		}
+		if *f.validDuring != "" && (r.cert().NotBefore.After(end) || r.cert().NotAfter.Before(start)) {
+			return false
+		}
+		return true
+	}, nil
+}
+
+// certificates for the domain name and pattern arguments of fs, or from the snapshot to load,
+// returning the query they were found by
+func (f sourceFlags) certificates(ctx context.Context, fs *flag.FlagSet) (string, []result, error) {
+	var (
+		query   string
+		results []result
+	)
+
+	purpose, err := f.purpose.filter()
+	if err != nil {
+		return "", nil, err
+	}
+	valid, err := f.validityFilter(time.Now())
+	if err != nil {
+		return "", nil, err
+	}
+
+	limit := *f.limit
+	if (*f.history || *f.latest) && !flagGiven(fs, "n") {
+		limit = 0
+	}
+
+	if *f.loadSnapshot != "" {
+		if fs.NArg() != 0 {
+			return "", nil, errExpectedNoArguments
+		}
+
+		s, err := readSnapshot(*f.loadSnapshot)
+		if err != nil {
+			return "", nil, err
+		}
+
+		results, err = s.parse()
+		if err != nil {
+			return "", nil, fmt.Errorf("could not load snapshot (%v) (%w)", *f.loadSnapshot, err)
+		}
+		query = s.Query
+	} else {
+		patterns, err := f.patterns.patterns(fs)
+		if err != nil {
+			return "", nil, err
+		}
+		query = patterns.String()
+
+		if *f.printQuery {
+			if limit == 0 {
+				return "", nil, printQuery(ctx, patternsPageQuery, patterns.pageQueryArgs(math.MaxInt64, fetchPageSize))
+			}
+			return "", nil, printQuery(ctx, patternsQuery, patterns.queryArgs(limit))
+		}
+
+		if err = crtshAdmission.admit(ctx, patterns); err != nil {
+			return "", nil, err
+		}
+
+		if limit == 0 {
+			if err = f.confirmFetchAll(ctx, patterns); err != nil {
+				return "", nil, err
+			}
+			results, err = getAllCertificatesByPatterns(ctx, patterns, fetchPageSize)
+		} else {
+			results, err = getCertificatesByPatterns(ctx, patterns, limit)
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("could not getCertificates of (%v) error (%w)", query, err)
+		}
+	}
+
+	results = purpose.apply(results)
+
+	kept := results[:0]
+	for _, r := range results {
+		if valid(r) {
+			kept = append(kept, r)
+		}
+	}
+	results = kept
+
+	if *f.latest {
+		results = latestPerNameSet(results)
+	}
+
+	if *f.history {
+		sort.SliceStable(results, func(i, j int) bool {
+			return firstLogged(results[i]).Before(firstLogged(results[j]))
+		})
+	}
+
+	if *f.saveSnapshot != "" {
+		if err := writeSnapshot(*f.saveSnapshot, newSnapshot(query, results)); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return query, results, nil
+}
+
+// count the certificates for the domain name and pattern arguments of fs, or in the snapshot to load,
+// without fetching them from crt.sh
+func (f sourceFlags) count(ctx context.Context, fs *flag.FlagSet) (int64, error) {
+	if *f.loadSnapshot != "" {
+		_, results, err := f.certificates(ctx, fs)
+		if err != nil {
+			return 0, err
+		}
+		return int64(len(results)), nil
+	}
+
+	// crt.sh can only count by name, the purpose of a certificate is only known once it is parsed
+	if *f.purpose.eku != "" || *f.purpose.keyUsage != "" {
+		return 0, errCountPurpose
+	}
+	if *f.onlyExpired || *f.onlyValid || *f.validDuring != "" {
+		return 0, errCountValidity
+	}
+	if *f.latest {
+		return 0, errCountLatest
+	}
+
+	patterns, err := f.patterns.patterns(fs)
+	if err != nil {
+		return 0, err
+	}
+
+	if *f.printQuery {
+		return 0, printQuery(ctx, patternsCountQuery, patterns.queryArgs(0)[:2])
+	}
+
+	if err = crtshAdmission.admit(ctx, patterns); err != nil {
+		return 0, err
+	}
+
+	count, err := countCertificatesByPatterns(ctx, patterns)
+	if err != nil {
+		return 0, fmt.Errorf("could not count certificates of (%v) (%w)", patterns, err)
+	}
+
+	return count, nil
+}
+
+// confirmFetchAll of patterns, asking on a terminal when crt.sh estimates more than largeFetchRows match
+func (f sourceFlags) confirmFetchAll(ctx context.Context, patterns patternSet) error {
+	if *f.yes {
+		return nil
+	}
+
+	estimate, err := estimateCertificatesByPatterns(ctx, patterns)
+	if err != nil {
+		return fmt.Errorf("could not estimate the certificates of (%v) (%w)", patterns, err)
+	}
+	if estimate <= largeFetchRows {
+		return nil
+	}
+
+	stat, err := os.Stdin.Stat()
+	if err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		return fmt.Errorf("%w (about %v rows)", errLargeFetch, estimate)
+	}
+
+	fmt.Fprintf(os.Stderr, "(%v) matches about (%v) rows on crt.sh, fetch them all? [y/N] ", patterns, estimate)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("could not read answer (%w)", err)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+
+	return fmt.Errorf("%w (about %v rows)", errLargeFetch, estimate)
+}
+
+// printQuery with its parameters as SQL comments, and in verbose mode its plan, returning errQueryPrinted
+func printQuery(ctx context.Context, query string, args []any) error {
+	fmt.Println(query)
+	for i, arg := range args {
+		// arrays print as postgres array literals (ex: {%.example.com})
+		if v, ok := arg.(driver.Valuer); ok {
+			if value, err := v.Value(); err == nil {
+				arg = value
+			}
+		}
+		fmt.Printf("-- $%v = %v\n", i+1, arg)
+	}
+
+	if verbose {
+		plan, err := explainQuery(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		for _, line := range plan {
+			fmt.Println("-- " + line)
+		}
+	}
+
+	return errQueryPrinted
+}
+
+// firstLogged is when r was first logged to CT, its NotBefore when that isn't known
+func firstLogged(r result) time.Time {
+	if r.firstSeen.IsZero() {
+		return r.cert().NotBefore
+	}
+
+	return r.firstSeen
+}
+
+// flagGiven is whether the flag name was set on the command line of fs
+func flagGiven(fs *flag.FlagSet, name string) bool {
+	given := false
+	fs.Visit(func(f *flag.Flag) {
+		given = given || f.Name == name
+	})
+
+	return given
+}
+
+// latestPerNameSet of results, the newest certificate of each distinct set of names in the order
+// found, a certificate preferred over its precertificate
+func latestPerNameSet(results []result) []result {
+	key := func(r result) string {
+		names := nameSet(r.cert())
+		if len(names) == 0 {
+			return "CN=" + strings.ToLower(r.cert().Subject.CommonName)
+		}
+		return strings.Join(names, ",")
+	}
+	newer := func(a, b result) bool {
+		if !a.cert().NotBefore.Equal(b.cert().NotBefore) {
+			return a.cert().NotBefore.After(b.cert().NotBefore)
+		}
+		return !isPrecertificate(a.cert()) && isPrecertificate(b.cert())
+	}
+
+	latest := make(map[string]int)
+	for i, r := range results {
+		k := key(r)
+		if j, ok := latest[k]; !ok || newer(r, results[j]) {
+			latest[k] = i
+		}
+	}
+
+	kept := make([]result, 0, len(latest))
+	for i, r := range results {
+		if latest[key(r)] == i {
+			kept = append(kept, r)
+		}
+	}
+
+	return kept
+}
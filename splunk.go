@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/simplylib/multierror"
+)
+
+const (
+	splunkDefaultBatchSize  = 50
+	splunkDefaultMaxRetries = 3
+	splunkSourcetype        = "findcert"
+)
+
+var errSplunkStatus = errors.New("unexpected HTTP status from Splunk HEC")
+
+// splunkEvent is the envelope expected by the Splunk HTTP Event Collector
+type splunkEvent struct {
+	Time       int64  `json:"time"`
+	Source     string `json:"source"`
+	Sourcetype string `json:"sourcetype"`
+	Event      any    `json:"event"`
+}
+
+// splunkSink batches events and sends them to a Splunk HTTP Event Collector
+type splunkSink struct {
+	url        string
+	token      string
+	batchSize  int
+	maxRetries int
+	client     *http.Client
+
+	batch bytes.Buffer
+	count int
+}
+
+// newSplunkSink that posts to url (ex: https://splunk:8088/services/collector/event) using token
+func newSplunkSink(url string, token string) *splunkSink {
+	return &splunkSink{
+		url:        url,
+		token:      token,
+		batchSize:  splunkDefaultBatchSize,
+		maxRetries: splunkDefaultMaxRetries,
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Send an event of source kind, flushing the full batch to Splunk first so an error means event
+// wasn't taken
+func (s *splunkSink) Send(ctx context.Context, source string, event any) error {
+	if s.count >= s.batchSize {
+		if err := s.Flush(ctx); err != nil {
+			return err
+		}
+	}
+
+	err := json.NewEncoder(&s.batch).Encode(splunkEvent{
+		Time:       time.Now().Unix(),
+		Source:     source,
+		Sourcetype: splunkSourcetype,
+		Event:      event,
+	})
+	if err != nil {
+		return fmt.Errorf("could not encode Splunk event (%w)", err)
+	}
+	s.count++
+
+	return nil
+}
+
+// Flush any batched events to Splunk, retrying on network errors and retryable statuses
+func (s *splunkSink) Flush(ctx context.Context) error {
+	if s.count == 0 {
+		return nil
+	}
+
+	body := s.batch.Bytes()
+
+	var err error
+	for attempt := 0; attempt <= s.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("could not send events to Splunk (%w)", multierror.Append(err, ctx.Err()))
+			case <-time.After(time.Duration(1<<(attempt-1)) * time.Second):
+			}
+		}
+
+		var retry bool
+		retry, err = s.post(ctx, body)
+		if err == nil || !retry {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("could not send %v events to Splunk (%w)", s.count, err)
+	}
+
+	s.batch.Reset()
+	s.count = 0
+
+	return nil
+}
+
+// post body to the collector, returning whether a failure is worth retrying
+func (s *splunkSink) post(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("could not create request (%w)", err)
+	}
+	req.Header.Set("Authorization", "Splunk "+s.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, fmt.Errorf("could not POST to Splunk HEC (%w)", err)
+	}
+	defer resp.Body.Close()
+
+	// drain so the connection can be reused between batches
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode == http.StatusOK {
+		return false, nil
+	}
+
+	retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+
+	return retry, fmt.Errorf("%w (%v)", errSplunkStatus, resp.Status)
+}
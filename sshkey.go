@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"time"
+)
+
+var errUnsupportedSSHKey = errors.New("public key type has no SSH form")
+
+// sshCurves names the curves SSH has ECDSA key types for
+var sshCurves = map[string]string{
+	"P-256": "nistp256",
+	"P-384": "nistp384",
+	"P-521": "nistp521",
+}
+
+// sshWireKey is the SSH wire encoding of a public key (RFC 4253 section 6.6)
+type sshWireKey struct {
+	bytes.Buffer
+}
+
+func (w *sshWireKey) writeString(b []byte) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(b)))
+	w.Write(n[:])
+	w.Write(b)
+}
+
+// writeMPInt as a positive mpint, with a leading zero byte when its high bit is set
+func (w *sshWireKey) writeMPInt(i *big.Int) {
+	b := i.Bytes()
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	w.writeString(b)
+}
+
+// sshAuthorizedKey of cert's public key as an authorized_keys line, commented with its name and SHA-256
+func sshAuthorizedKey(cert *x509.Certificate) (string, error) {
+	var (
+		typ string
+		w   sshWireKey
+	)
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		typ = "ssh-rsa"
+		w.writeString([]byte(typ))
+		w.writeMPInt(big.NewInt(int64(key.E)))
+		w.writeMPInt(key.N)
+	case *ecdsa.PublicKey:
+		curve, ok := sshCurves[key.Curve.Params().Name]
+		if !ok {
+			return "", fmt.Errorf("%w (%v)", errUnsupportedSSHKey, key.Curve.Params().Name)
+		}
+		typ = "ecdsa-sha2-" + curve
+
+		// the uncompressed point, 0x04 then X and Y at the size of the curve
+		size := (key.Curve.Params().BitSize + 7) / 8
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		key.X.FillBytes(point[1 : 1+size])
+		key.Y.FillBytes(point[1+size:])
+
+		w.writeString([]byte(typ))
+		w.writeString([]byte(curve))
+		w.writeString(point)
+	case ed25519.PublicKey:
+		typ = "ssh-ed25519"
+		w.writeString([]byte(typ))
+		w.writeString(key)
+	default:
+		return "", fmt.Errorf("%w (%v)", errUnsupportedSSHKey, cert.PublicKeyAlgorithm)
+	}
+
+	info := newCertificateInfo(cert)
+	return fmt.Sprintf("%v %v %v sha256:%v", typ, base64.StdEncoding.EncodeToString(w.Bytes()), info.displayName(), info.SHA256), nil
+}
+
+func init() {
+	registerOutputFormat("ssh", func(_ outputFlags, w io.Writer, _ time.Time) outputFormatter {
+		return &collectFormatter{flushCerts: func(_ string, certs []*x509.Certificate) error {
+			for _, cert := range certs {
+				line, err := sshAuthorizedKey(cert)
+				if err != nil {
+					log.Printf("Warning: (skipping certificate of (%v), %v)\n", cert.Subject.CommonName, err)
+					continue
+				}
+				if _, err = fmt.Fprintln(w, line); err != nil {
+					return fmt.Errorf("could not write SSH key (%w)", err)
+				}
+			}
+			return nil
+		}}
+	})
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// watchStateVersion is bumped when the state file changes incompatibly
+const watchStateVersion = 1
+
+var (
+	errExpectedStateAction = errors.New("expected 1 argument: export or import")
+	errExpectedStateTarget = errors.New("expected -state or -config with state_file")
+	errStateVersion        = errors.New("unsupported state schema version")
+)
+
+// watcherState is what a watcher has seen, so a restarted or migrated watcher only reports
+// certificates that are new to it
+type watcherState struct {
+	Query string `json:"query"`
+	// Seen are the SHA-256 fingerprints of the certificates already reported or in the baseline
+	Seen []string `json:"seen"`
+	// Issuers, ValiditySeconds and Issued are the issuanceProfile new certificates are compared against
+	Issuers         []string    `json:"issuers,omitempty"`
+	ValiditySeconds []int64     `json:"validity_seconds,omitempty"`
+	Issued          []time.Time `json:"issued,omitempty"`
+	// Names on the certificates seen, a new certificate for only these is a renewal
+	Names []string `json:"names,omitempty"`
+}
+
+// watchState of every watcher, keyed by monitor (ex: team-a/ops) or the query of findcert watch
+type watchState struct {
+	SchemaVersion int                     `json:"schema_version"`
+	SavedAt       time.Time               `json:"saved_at"`
+	Watchers      map[string]watcherState `json:"watchers"`
+	// Suppressions by fingerprint apply to every watcher, see findcert ack
+	Suppressions map[string]suppression `json:"suppressions,omitempty"`
+}
+
+// stateMu serializes updates of state files within the process
+var stateMu sync.Mutex
+
+// state of w
+func (w *watcher) state() watcherState {
+	s := watcherState{Query: w.query, Seen: make([]string, 0, len(w.seen))}
+	for sum := range w.seen {
+		s.Seen = append(s.Seen, hex.EncodeToString(sum[:]))
+	}
+	sort.Strings(s.Seen)
+
+	for issuer := range w.profile.issuers {
+		s.Issuers = append(s.Issuers, issuer)
+	}
+	sort.Strings(s.Issuers)
+	for _, v := range w.profile.validities {
+		s.ValiditySeconds = append(s.ValiditySeconds, int64(v/time.Second))
+	}
+	s.Issued = append(s.Issued, w.profile.issued...)
+	for name := range w.profile.names {
+		s.Names = append(s.Names, name)
+	}
+	sort.Strings(s.Names)
+
+	return s
+}
+
+// restore w to s, skipping the baseline poll when s has seen certificates
+func (w *watcher) restore(s watcherState) {
+	for _, fingerprint := range s.Seen {
+		var sum [sha256.Size]byte
+		if b, err := hex.DecodeString(fingerprint); err == nil && len(b) == sha256.Size {
+			copy(sum[:], b)
+			w.seen[sum] = struct{}{}
+		}
+	}
+
+	for _, issuer := range s.Issuers {
+		w.profile.issuers[issuer] = struct{}{}
+	}
+	for _, v := range s.ValiditySeconds {
+		w.profile.validities = append(w.profile.validities, time.Duration(v)*time.Second)
+	}
+	w.profile.issued = append(w.profile.issued, s.Issued...)
+	for _, name := range s.Names {
+		w.profile.names[name] = struct{}{}
+	}
+
+	if len(w.seen) > 0 {
+		w.baseline = true
+	}
+}
+
+// merge of s and other, the union of what either has seen
+func (s watcherState) merge(other watcherState) watcherState {
+	union := func(a, b []string) []string {
+		set := make(map[string]struct{}, len(a)+len(b))
+		for _, v := range append(append([]string(nil), a...), b...) {
+			set[v] = struct{}{}
+		}
+		merged := make([]string, 0, len(set))
+		for v := range set {
+			merged = append(merged, v)
+		}
+		sort.Strings(merged)
+		return merged
+	}
+
+	merged := s
+	merged.Seen = union(s.Seen, other.Seen)
+	merged.Issuers = union(s.Issuers, other.Issuers)
+	merged.Names = union(s.Names, other.Names)
+	// validities and issuance times are samples, keep whichever profile is larger rather than double count
+	if len(other.ValiditySeconds) > len(s.ValiditySeconds) {
+		merged.ValiditySeconds, merged.Issued = other.ValiditySeconds, other.Issued
+	}
+	if merged.Query == "" {
+		merged.Query = other.Query
+	}
+
+	return merged
+}
+
+// newWatchState with nothing seen or suppressed
+func newWatchState() watchState {
+	return watchState{
+		SchemaVersion: watchStateVersion,
+		Watchers:      make(map[string]watcherState),
+		Suppressions:  make(map[string]suppression),
+	}
+}
+
+// readWatchState from path, a file or a stateBackend URL, empty if nothing was saved yet
+func readWatchState(path string) (watchState, error) {
+	s := newWatchState()
+
+	backend, err := backendOf(path)
+	if err != nil {
+		return s, err
+	}
+	var data []byte
+	if backend != nil {
+		data, err = backend.loadState()
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if errors.Is(err, os.ErrNotExist) || err == nil && data == nil {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("could not read state (%w)", err)
+	}
+
+	return decodeWatchState(data)
+}
+
+func decodeWatchState(data []byte) (watchState, error) {
+	var s watchState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("could not decode state (%w)", err)
+	}
+	if s.SchemaVersion != watchStateVersion {
+		return s, fmt.Errorf("%w (%v)", errStateVersion, s.SchemaVersion)
+	}
+	if s.Watchers == nil {
+		s.Watchers = make(map[string]watcherState)
+	}
+	if s.Suppressions == nil {
+		s.Suppressions = make(map[string]suppression)
+	}
+
+	return s, nil
+}
+
+// updateWatchState at path with update, reading it first so changes made by others since, like
+// suppressions added by findcert ack, are kept
+func updateWatchState(path string, update func(*watchState)) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	backend, err := backendOf(path)
+	if err != nil {
+		return err
+	}
+	if backend != nil {
+		// the backend keeps other daemons sharing it from updating the state in between
+		return backend.updateState(func(data []byte) ([]byte, error) {
+			s := newWatchState()
+			if data != nil {
+				if s, err = decodeWatchState(data); err != nil {
+					return nil, err
+				}
+			}
+			update(&s)
+			return encodeWatchState(s)
+		})
+	}
+
+	s, err := readWatchState(path)
+	if err != nil {
+		return err
+	}
+	update(&s)
+
+	return writeWatchState(path, s)
+}
+
+// encodeWatchState as JSON stamped with its version and when it was saved
+func encodeWatchState(s watchState) ([]byte, error) {
+	s.SchemaVersion = watchStateVersion
+	s.SavedAt = time.Now().UTC()
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("could not encode state (%w)", err)
+	}
+
+	return data, nil
+}
+
+// writeWatchState as JSON to the file at path, replacing any existing file only once fully written
+func writeWatchState(path string, s watchState) error {
+	data, err := encodeWatchState(s)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not create state (%w)", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write state (%w)", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("could not write state (%w)", err)
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("could not replace state (%w)", err)
+	}
+
+	return nil
+}
+
+// runState exports the state of watch -state or the daemon's state_file to a portable file, or
+// imports one, merging it with what is already there so nothing seen on either host re-alerts
+func runState(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	statePath := fs.String("state", "", "state file of findcert watch -state")
+	configPath := fs.String("config", "", "JSON config file of the daemon, whose state_file is used")
+	file := fs.String("file", "-", "portable file to export to or import from, - for stdout or stdin")
+	parseFlags(fs, args)
+
+	if fs.NArg() != 1 {
+		return errExpectedStateAction
+	}
+
+	path := *statePath
+	if *configPath != "" {
+		cfg, _, err := readDaemonConfig(*configPath)
+		if err != nil {
+			return err
+		}
+		path = cfg.StateFile
+	}
+	if path == "" {
+		return errExpectedStateTarget
+	}
+
+	current, err := readWatchState(path)
+	if err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "export":
+		data, err := json.MarshalIndent(current, "", "  ")
+		if err != nil {
+			return fmt.Errorf("could not encode state (%w)", err)
+		}
+		if *file == "-" {
+			_, err = os.Stdout.Write(append(data, '\n'))
+		} else {
+			err = os.WriteFile(*file, append(data, '\n'), 0o600)
+		}
+		if err != nil {
+			return fmt.Errorf("could not write exported state (%w)", err)
+		}
+		log.Printf("exported (%v) watchers from (%v)\n", len(current.Watchers), path)
+	case "import":
+		var data []byte
+		if *file == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(*file)
+		}
+		if err != nil {
+			return fmt.Errorf("could not read exported state (%w)", err)
+		}
+		imported, err := decodeWatchState(data)
+		if err != nil {
+			return err
+		}
+
+		err = updateWatchState(path, func(current *watchState) {
+			for key, s := range imported.Watchers {
+				current.Watchers[key] = current.Watchers[key].merge(s)
+			}
+			for fingerprint, s := range imported.Suppressions {
+				if existing, ok := current.Suppressions[fingerprint]; !ok || s.At.After(existing.At) {
+					current.Suppressions[fingerprint] = s
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("imported (%v) watchers into (%v), restart findcert for it to take effect\n", len(imported.Watchers), path)
+	default:
+		return errExpectedStateAction
+	}
+
+	return nil
+}
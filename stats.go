@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// issuerCount is the number of certificates issued by an issuer
+type issuerCount struct {
+	Name  string
+	Count int
+}
+
+// certificateStats summarize a set of certificates
+type certificateStats struct {
+	Total    int
+	Valid    int
+	Earliest time.Time
+	Latest   time.Time
+	Issuers  []issuerCount
+}
+
+// computeStats of certs at now, issuers are ordered by most certificates issued
+func computeStats(certs []*x509.Certificate, now time.Time) certificateStats {
+	s := certificateStats{Total: len(certs)}
+
+	issuers := make(map[string]int)
+	for _, cert := range certs {
+		if now.After(cert.NotBefore) && now.Before(cert.NotAfter) {
+			s.Valid++
+		}
+
+		issuers[cert.Issuer.String()]++
+
+		if s.Earliest.IsZero() || cert.NotBefore.Before(s.Earliest) {
+			s.Earliest = cert.NotBefore
+		}
+		if cert.NotAfter.After(s.Latest) {
+			s.Latest = cert.NotAfter
+		}
+	}
+
+	for name, count := range issuers {
+		s.Issuers = append(s.Issuers, issuerCount{Name: name, Count: count})
+	}
+	sort.Slice(s.Issuers, func(i, j int) bool {
+		if s.Issuers[i].Count != s.Issuers[j].Count {
+			return s.Issuers[i].Count > s.Issuers[j].Count
+		}
+		return s.Issuers[i].Name < s.Issuers[j].Name
+	})
+
+	return s
+}
+
+// subjectAttributes broken down by subjectBreakdown, with their names in subjects
+var subjectAttributes = []struct {
+	name   string
+	values func(pkix.Name) []string
+}{
+	{"Organization (O)", func(n pkix.Name) []string { return n.Organization }},
+	{"Organizational unit (OU)", func(n pkix.Name) []string { return n.OrganizationalUnit }},
+	{"Country (C)", func(n pkix.Name) []string { return n.Country }},
+	{"State or province (ST)", func(n pkix.Name) []string { return n.Province }},
+	{"Locality (L)", func(n pkix.Name) []string { return n.Locality }},
+}
+
+// valueCount is the number of certificates with a value of an attribute
+type valueCount struct {
+	Value string
+	Count int
+}
+
+// subjectBreakdown of certs, for each of subjectAttributes the certificates with each value, most
+// first, those without the attribute (ex: domain validated) counted as (none)
+func subjectBreakdown(certs []*x509.Certificate) [][]valueCount {
+	breakdown := make([][]valueCount, 0, len(subjectAttributes))
+	for _, attr := range subjectAttributes {
+		counts := make(map[string]int)
+		for _, cert := range certs {
+			values := attr.values(cert.Subject)
+			if len(values) == 0 {
+				counts["(none)"]++
+				continue
+			}
+			for _, v := range values {
+				counts[v]++
+			}
+		}
+
+		values := make([]valueCount, 0, len(counts))
+		for v, count := range counts {
+			values = append(values, valueCount{Value: v, Count: count})
+		}
+		sort.Slice(values, func(i, j int) bool {
+			if values[i].Count != values[j].Count {
+				return values[i].Count > values[j].Count
+			}
+			return values[i].Value < values[j].Value
+		})
+		breakdown = append(breakdown, values)
+	}
+
+	return breakdown
+}
+
+func runStats(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	source := addSourceFlags(fs, 1000)
+	maxSkew := fs.Duration("max-log-skew", defaultMaxLoggingSkew, "flag certificates first logged to CT longer than this before or after their NotBefore")
+	subjects := fs.Bool("subjects", false, "break certificates down by subject organization, unit, country, state and locality, to spot unexpected entities or geographies")
+	output := addOutputFileFlag(fs)
+	parseFlags(fs, args)
+
+	_, results, err := source.certificates(ctx, fs)
+	if err != nil {
+		return err
+	}
+	certs := certificatesOf(results)
+
+	s := computeStats(certs, time.Now())
+
+	return writeOutput(*output, func(out io.Writer) error {
+		fmt.Fprintf(out, "Certificates: (%v) Valid: (%v) Expired or not yet valid: (%v)\n", s.Total, s.Valid, s.Total-s.Valid)
+		if s.Total == 0 {
+			return nil
+		}
+		fmt.Fprintf(out, "Earliest NotBefore: (%v) Latest NotAfter: (%v)\n", s.Earliest, s.Latest)
+
+		fmt.Fprintln(out, "Issuers:")
+		for _, issuer := range s.Issuers {
+			fmt.Fprintf(out, "  %6v %v\n", issuer.Count, issuer.Name)
+		}
+
+		if *subjects {
+			for i, values := range subjectBreakdown(certs) {
+				fmt.Fprintf(out, "%v:\n", subjectAttributes[i].name)
+				for _, v := range values {
+					fmt.Fprintf(out, "  %6v %v\n", v.Count, v.Value)
+				}
+			}
+		}
+
+		for _, r := range results {
+			if w := loggingSkewWarning(r, *maxSkew); w != "" {
+				fmt.Fprintf(out, "Warning: (%v) crt.sh ID: (%v) CommonName: (%v) NotBefore: (%v) First Logged: (%v)\n", w, r.id, r.cert().Subject.CommonName, r.cert().NotBefore, r.firstSeen)
+			}
+		}
+
+		for _, c := range serialCollisions(results) {
+			fmt.Fprintf(out, "Warning: (serial number reused for different certificates) Issuer: (%v) Serial: (%v)\n", c.issuer, c.serial)
+			for _, r := range c.results {
+				fmt.Fprintf(out, "  crt.sh ID: (%v) SHA-256: (%v) CommonName: (%v) Issued On: (%v)\n", r.id, r.info().SHA256, r.cert().Subject.CommonName, r.cert().NotBefore)
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	_ "modernc.org/sqlite"
+)
+
+var errStateBackend = errors.New("unknown state backend, expected a file path, sqlite://, bolt:// or postgres://")
+
+// stateBackend keeps the watch state and the history of observed certificates somewhere other than
+// the JSON state file and NDJSON history file, chosen by giving a URL (ex: sqlite:///var/lib/findcert.db
+// or postgres://findcert@db/findcert) in place of their path
+type stateBackend interface {
+	// loadState is the encoded state, nil if none was saved yet
+	loadState() ([]byte, error)
+	// updateState with update of the encoded state, nil if none was saved yet, locking it against
+	// other processes sharing the backend until the update is saved
+	updateState(update func(data []byte) ([]byte, error)) error
+	// appendHistory of the encoded event of the certificate with fingerprint sha256, once per certificate
+	appendHistory(sha256 string, data []byte) error
+	// loadHistory is the encoded events in the order they were appended
+	loadHistory() ([][]byte, error)
+}
+
+// stateBackends by URL scheme
+var stateBackends = map[string]func(url string) (stateBackend, error){
+	"sqlite":     openSQLiteBackend,
+	"bolt":       openBoltBackend,
+	"postgres":   openPostgresBackend,
+	"postgresql": openPostgresBackend,
+}
+
+var (
+	openBackendsMu sync.Mutex
+	// openBackends by URL, each opened once and shared by the process as a bolt file can only be
+	// opened once at a time
+	openBackends = make(map[string]stateBackend)
+)
+
+// backendOf path, nil for a file path
+func backendOf(path string) (stateBackend, error) {
+	scheme, _, ok := strings.Cut(path, "://")
+	if !ok {
+		return nil, nil
+	}
+	open, ok := stateBackends[scheme]
+	if !ok {
+		return nil, fmt.Errorf("%w (%v)", errStateBackend, scheme)
+	}
+
+	openBackendsMu.Lock()
+	defer openBackendsMu.Unlock()
+
+	if b, ok := openBackends[path]; ok {
+		return b, nil
+	}
+	b, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	openBackends[path] = b
+
+	return b, nil
+}
+
+var (
+	boltStateBucket   = []byte("state")
+	boltHistoryBucket = []byte("history")
+	boltHistoryIndex  = []byte("history_sha256")
+	boltStateKey      = []byte("watch")
+)
+
+// boltBackend keeps state and history in a single bbolt file, for small deployments
+type boltBackend struct {
+	db *bolt.DB
+}
+
+// openBoltBackend of a bolt:///path/to/file URL, creating the file if missing
+func openBoltBackend(url string) (stateBackend, error) {
+	path := strings.TrimPrefix(url, "bolt://")
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("could not open bolt state (%w)", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{boltStateBucket, boltHistoryBucket, boltHistoryIndex} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create bolt buckets (%w)", err)
+	}
+
+	return &boltBackend{db: db}, nil
+}
+
+func (b *boltBackend) loadState() ([]byte, error) {
+	var data []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		// the value is only valid during the transaction
+		if v := tx.Bucket(boltStateBucket).Get(boltStateKey); v != nil {
+			data = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read bolt state (%w)", err)
+	}
+
+	return data, nil
+}
+
+func (b *boltBackend) updateState(update func(data []byte) ([]byte, error)) error {
+	// bolt allows one writable transaction at a time, and one process to open the file
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltStateBucket)
+		var current []byte
+		if v := bucket.Get(boltStateKey); v != nil {
+			current = append([]byte(nil), v...)
+		}
+		data, err := update(current)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(boltStateKey, data)
+	})
+	if err != nil {
+		return fmt.Errorf("could not write bolt state (%w)", err)
+	}
+
+	return nil
+}
+
+func (b *boltBackend) appendHistory(sha256 string, data []byte) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		index := tx.Bucket(boltHistoryIndex)
+		if index.Get([]byte(sha256)) != nil {
+			return nil
+		}
+
+		history := tx.Bucket(boltHistoryBucket)
+		seq, err := history.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		if err = history.Put(key, data); err != nil {
+			return err
+		}
+		return index.Put([]byte(sha256), key)
+	})
+	if err != nil {
+		return fmt.Errorf("could not write bolt history (%w)", err)
+	}
+
+	return nil
+}
+
+func (b *boltBackend) loadHistory() ([][]byte, error) {
+	var events [][]byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		// keys are big endian sequence numbers, so in the order appended
+		return tx.Bucket(boltHistoryBucket).ForEach(func(_, v []byte) error {
+			events = append(events, append([]byte(nil), v...))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read bolt history (%w)", err)
+	}
+
+	return events, nil
+}
+
+const (
+	sqliteSchema = `CREATE TABLE IF NOT EXISTS findcert_state (id integer PRIMARY KEY, state blob NOT NULL, saved_at text NOT NULL DEFAULT CURRENT_TIMESTAMP);
+CREATE TABLE IF NOT EXISTS findcert_history (id integer PRIMARY KEY AUTOINCREMENT, sha256 text NOT NULL UNIQUE, event blob NOT NULL);`
+	sqliteLoadState     = "SELECT state FROM findcert_state WHERE id = 1;"
+	sqliteSaveState     = "INSERT INTO findcert_state (id, state) VALUES (1, ?) ON CONFLICT (id) DO UPDATE SET state = excluded.state, saved_at = CURRENT_TIMESTAMP;"
+	sqliteAppendHistory = "INSERT INTO findcert_history (sha256, event) VALUES (?, ?) ON CONFLICT (sha256) DO NOTHING;"
+	sqliteLoadHistory   = "SELECT event FROM findcert_history ORDER BY id;"
+)
+
+// sqliteBackend keeps state and history in a single SQLite file, for small deployments that want
+// to query it with the sqlite3 shell, several processes may share it
+type sqliteBackend struct {
+	db *sql.DB
+}
+
+// openSQLiteBackend of a sqlite:///path/to/file URL, creating the file and its tables if missing
+func openSQLiteBackend(url string) (stateBackend, error) {
+	path := strings.TrimPrefix(url, "sqlite://")
+	// writers wait for each other rather than fail with SQLITE_BUSY, and updates lock the file as
+	// they begin so two can't both read the state before either writes it
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(10000)&_txlock=immediate")
+	if err != nil {
+		return nil, fmt.Errorf("could not open SQLite state (%w)", err)
+	}
+	if _, err = db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create SQLite state tables (%w)", err)
+	}
+
+	return &sqliteBackend{db: db}, nil
+}
+
+func (b *sqliteBackend) loadState() ([]byte, error) {
+	var data []byte
+	err := b.db.QueryRow(sqliteLoadState).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read SQLite state (%w)", err)
+	}
+
+	return data, nil
+}
+
+func (b *sqliteBackend) updateState(update func(data []byte) ([]byte, error)) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not begin SQLite state update (%w)", err)
+	}
+	defer tx.Rollback()
+
+	var current []byte
+	if err = tx.QueryRow(sqliteLoadState).Scan(&current); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("could not read SQLite state (%w)", err)
+	}
+	data, err := update(current)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(sqliteSaveState, data); err != nil {
+		return fmt.Errorf("could not write SQLite state (%w)", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit SQLite state (%w)", err)
+	}
+
+	return nil
+}
+
+func (b *sqliteBackend) appendHistory(sha256 string, data []byte) error {
+	if _, err := b.db.Exec(sqliteAppendHistory, sha256, data); err != nil {
+		return fmt.Errorf("could not write SQLite history (%w)", err)
+	}
+
+	return nil
+}
+
+func (b *sqliteBackend) loadHistory() ([][]byte, error) {
+	rows, err := b.db.Query(sqliteLoadHistory)
+	if err != nil {
+		return nil, fmt.Errorf("could not read SQLite history (%w)", err)
+	}
+	defer rows.Close()
+
+	var events [][]byte
+	for rows.Next() {
+		var data []byte
+		if err = rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("could not read SQLite history (%w)", err)
+		}
+		events = append(events, data)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not read SQLite history (%w)", err)
+	}
+
+	return events, nil
+}
+
+const (
+	postgresSchema = `CREATE TABLE IF NOT EXISTS findcert_state (id int PRIMARY KEY, state jsonb NOT NULL, saved_at timestamptz NOT NULL DEFAULT now());
+CREATE TABLE IF NOT EXISTS findcert_history (id bigserial PRIMARY KEY, sha256 text NOT NULL UNIQUE, event jsonb NOT NULL);`
+	postgresLoadState     = "SELECT state FROM findcert_state WHERE id = 1;"
+	postgresLockState     = "SELECT pg_advisory_xact_lock(hashtext('findcert_state'));"
+	postgresSaveState     = "INSERT INTO findcert_state (id, state) VALUES (1, $1) ON CONFLICT (id) DO UPDATE SET state = EXCLUDED.state, saved_at = now();"
+	postgresAppendHistory = "INSERT INTO findcert_history (sha256, event) VALUES ($1, $2) ON CONFLICT (sha256) DO NOTHING;"
+	postgresLoadHistory   = "SELECT event FROM findcert_history ORDER BY id;"
+)
+
+// postgresBackend keeps state and history in a PostgreSQL database, for larger deployments sharing
+// a managed database
+type postgresBackend struct {
+	db *sql.DB
+}
+
+// openPostgresBackend of a postgres:// connection URL, creating its tables if missing
+func openPostgresBackend(url string) (stateBackend, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, fmt.Errorf("could not open PostgreSQL state (%w)", err)
+	}
+	if _, err = db.Exec(postgresSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create PostgreSQL state tables (%w)", err)
+	}
+
+	return &postgresBackend{db: db}, nil
+}
+
+func (b *postgresBackend) loadState() ([]byte, error) {
+	var data []byte
+	err := b.db.QueryRow(postgresLoadState).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read PostgreSQL state (%w)", err)
+	}
+
+	return data, nil
+}
+
+func (b *postgresBackend) updateState(update func(data []byte) ([]byte, error)) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not begin PostgreSQL state update (%w)", err)
+	}
+	defer tx.Rollback()
+
+	// held until the transaction ends, so daemons sharing the database update the state in turn
+	if _, err = tx.Exec(postgresLockState); err != nil {
+		return fmt.Errorf("could not lock PostgreSQL state (%w)", err)
+	}
+
+	var current []byte
+	if err = tx.QueryRow(postgresLoadState).Scan(&current); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("could not read PostgreSQL state (%w)", err)
+	}
+	data, err := update(current)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(postgresSaveState, string(data)); err != nil {
+		return fmt.Errorf("could not write PostgreSQL state (%w)", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit PostgreSQL state (%w)", err)
+	}
+
+	return nil
+}
+
+func (b *postgresBackend) appendHistory(sha256 string, data []byte) error {
+	if _, err := b.db.Exec(postgresAppendHistory, sha256, string(data)); err != nil {
+		return fmt.Errorf("could not write PostgreSQL history (%w)", err)
+	}
+
+	return nil
+}
+
+func (b *postgresBackend) loadHistory() ([][]byte, error) {
+	rows, err := b.db.Query(postgresLoadHistory)
+	if err != nil {
+		return nil, fmt.Errorf("could not read PostgreSQL history (%w)", err)
+	}
+	defer rows.Close()
+
+	var events [][]byte
+	for rows.Next() {
+		var data []byte
+		if err = rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("could not read PostgreSQL history (%w)", err)
+		}
+		events = append(events, data)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not read PostgreSQL history (%w)", err)
+	}
+
+	return events, nil
+}
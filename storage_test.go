@@ -0,0 +1,44 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFileBackends(t *testing.T) {
+	for _, scheme := range []string{"sqlite", "bolt"} {
+		url := scheme + "://" + filepath.Join(t.TempDir(), "findcert.db")
+		backend, err := backendOf(url)
+		if err != nil {
+			t.Fatalf("%v: (%v)", scheme, err)
+		}
+
+		if data, err := backend.loadState(); err != nil || data != nil {
+			t.Errorf("%v: state (%s) (%v), want none saved", scheme, data, err)
+		}
+		for _, want := range []string{"", "first"} {
+			err = backend.updateState(func(data []byte) ([]byte, error) {
+				if string(data) != want {
+					t.Errorf("%v: updating (%s), want (%v)", scheme, data, want)
+				}
+				return []byte("first"), nil
+			})
+			if err != nil {
+				t.Fatalf("%v: (%v)", scheme, err)
+			}
+		}
+
+		for _, sha256 := range []string{"a", "b", "a"} {
+			if err = backend.appendHistory(sha256, []byte(sha256)); err != nil {
+				t.Fatalf("%v: (%v)", scheme, err)
+			}
+		}
+		events, err := backend.loadHistory()
+		if err != nil {
+			t.Fatalf("%v: (%v)", scheme, err)
+		}
+		if len(events) != 2 || string(events[0]) != "a" || string(events[1]) != "b" {
+			t.Errorf("%v: history (%q), want each certificate once in order", scheme, events)
+		}
+	}
+}
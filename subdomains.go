@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+func runSubdomains(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	source := addSourceFlags(fs, 1000)
+	print0 := fs.Bool("print0", false, "print each name terminated by NUL, for xargs -0")
+	coverage := fs.Bool("coverage", false, "report whether each hostname has a valid certificate of its own or is covered only by a wildcard")
+	seenFlag := fs.Bool("seen", false, "report when each name first and last appeared in a certificate, longest unrenewed first, to spot abandoned and new subdomains")
+	impact := fs.Bool("wildcard-impact", false, "map each valid wildcard certificate to the hostnames it covers, for impact analysis before rotating it")
+	hostsFiles := fs.String("hosts", "", "with -wildcard-impact, comma separated files of hostnames also known from DNS: lists of one per line, DNS zone files or Terraform state")
+	output := addOutputFileFlag(fs)
+	parseFlags(fs, args)
+
+	_, results, err := source.certificates(ctx, fs)
+	if err != nil {
+		return err
+	}
+	certs := certificatesOf(results)
+
+	var inventory []string
+	if *impact {
+		for _, file := range splitList(*hostsFiles) {
+			names, err := readInventory(file, "")
+			if err != nil {
+				return err
+			}
+			inventory = append(inventory, names...)
+		}
+	}
+
+	return writeOutput(*output, func(out io.Writer) error {
+		if *coverage {
+			counts := make(map[string]int)
+			for _, h := range wildcardCoverage(certs, time.Now()) {
+				counts[h.kind()]++
+				if len(h.wildcards) == 0 {
+					fmt.Fprintf(out, "%-13v %v\n", h.kind(), h.name)
+					continue
+				}
+				fmt.Fprintf(out, "%-13v %v (%v)\n", h.kind(), h.name, strings.Join(h.wildcards, ", "))
+			}
+			fmt.Fprintf(out, "Own: (%v) Own and wildcard: (%v) Wildcard only: (%v) None: (%v)\n", counts["own"], counts["own+wildcard"], counts["wildcard only"], counts["none"])
+			return nil
+		}
+
+		if *impact {
+			for _, w := range wildcardImpacts(results, inventory, time.Now()) {
+				info := w.result.info()
+				onlyWildcard := 0
+				for _, h := range w.hosts {
+					if !h.own {
+						onlyWildcard++
+					}
+				}
+				fmt.Fprintf(out, "Wildcard: (%v) Expires: (%v) Issuer: (%v) SHA-256: (%v) Hosts: (%v) Wildcard only: (%v)\n",
+					strings.Join(w.wildcards, ", "),
+					info.NotAfter.UTC().Format("2006-01-02"),
+					info.IssuerName,
+					info.SHA256,
+					len(w.hosts),
+					onlyWildcard,
+				)
+				for _, h := range w.hosts {
+					kind := "wildcard only"
+					if h.own {
+						kind = "own"
+					}
+					var seenIn []string
+					if h.inCT {
+						seenIn = append(seenIn, "CT")
+					}
+					if h.inInventory {
+						seenIn = append(seenIn, "DNS")
+					}
+					fmt.Fprintf(out, "  %-13v %v (%v)\n", kind, displayIDN(h.name), strings.Join(seenIn, ", "))
+				}
+			}
+			return nil
+		}
+
+		if *seenFlag {
+			now := time.Now()
+			for _, s := range namesSeen(results) {
+				status := "current"
+				if s.expires.Before(now) {
+					status = "expired"
+				}
+				fmt.Fprintf(out, "%v first: (%v) last: (%v) certificates: (%v) expires: (%v) %v\n",
+					s.name,
+					s.first.UTC().Format("2006-01-02"),
+					s.last.UTC().Format("2006-01-02"),
+					s.certificates,
+					s.expires.UTC().Format("2006-01-02"),
+					status,
+				)
+			}
+			return nil
+		}
+
+		seen := make(map[string]struct{})
+		for _, cert := range certs {
+			for _, name := range cert.DNSNames {
+				seen[strings.ToLower(name)] = struct{}{}
+			}
+		}
+
+		names := make([]string, 0, len(seen))
+		for name := range seen {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		terminator := "\n"
+		if *print0 {
+			terminator = "\x00"
+		}
+		for _, name := range names {
+			fmt.Fprint(out, name, terminator)
+		}
+
+		return nil
+	})
+}
+
+// nameSeen is when a DNS name first and last appeared in a certificate
+type nameSeen struct {
+	name string
+	// first is when the name was first logged to CT, last when it was last issued a certificate
+	first time.Time
+	last  time.Time
+	// expires is when its certificate expiring last does
+	expires      time.Time
+	certificates int
+}
+
+// namesSeen in results, least recently issued first so abandoned names lead
+func namesSeen(results []result) []nameSeen {
+	index := make(map[string]*nameSeen)
+	for _, r := range results {
+		cert := r.cert()
+		logged := firstLogged(r)
+		for _, name := range nameSet(cert) {
+			s, ok := index[name]
+			if !ok {
+				s = &nameSeen{name: name, first: logged, last: cert.NotBefore, expires: cert.NotAfter}
+				index[name] = s
+			}
+			s.certificates++
+			if logged.Before(s.first) {
+				s.first = logged
+			}
+			if cert.NotBefore.After(s.last) {
+				s.last = cert.NotBefore
+			}
+			if cert.NotAfter.After(s.expires) {
+				s.expires = cert.NotAfter
+			}
+		}
+	}
+
+	seen := make([]nameSeen, 0, len(index))
+	for _, s := range index {
+		seen = append(seen, *s)
+	}
+	sort.Slice(seen, func(i, j int) bool {
+		if !seen[i].last.Equal(seen[j].last) {
+			return seen[i].last.Before(seen[j].last)
+		}
+		return seen[i].name < seen[j].name
+	})
+
+	return seen
+}
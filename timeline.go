@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const timelineLabelWidth = 30
+
+// renderTimeline draws the validity windows of certs as an ASCII Gantt chart width columns wide,
+// returning one string per line
+func renderTimeline(certs []*x509.Certificate, width int, now time.Time) []string {
+	if len(certs) == 0 || width < 10 {
+		return nil
+	}
+
+	certs = dedupeCertificates(certs)
+	sortByValidity(certs)
+
+	start, end := certs[0].NotBefore, certs[0].NotAfter
+	for _, cert := range certs {
+		if cert.NotAfter.After(end) {
+			end = cert.NotAfter
+		}
+	}
+	span := end.Sub(start)
+	if span <= 0 {
+		span = time.Second
+	}
+
+	column := func(t time.Time) int {
+		c := int(float64(t.Sub(start)) / float64(span) * float64(width-1))
+		if c < 0 {
+			return 0
+		}
+		if c > width-1 {
+			return width - 1
+		}
+		return c
+	}
+
+	nowColumn := -1
+	if !now.Before(start) && !now.After(end) {
+		nowColumn = column(now)
+	}
+
+	lines := make([]string, 0, len(certs)+2)
+	for _, cert := range certs {
+		label := cert.Subject.CommonName
+		if label == "" && len(cert.DNSNames) > 0 {
+			label = cert.DNSNames[0]
+		}
+		if len(label) > timelineLabelWidth {
+			label = label[:timelineLabelWidth-1] + "~"
+		}
+
+		bar := []byte(strings.Repeat(".", width))
+		from, to := column(cert.NotBefore), column(cert.NotAfter)
+		for i := from; i <= to; i++ {
+			bar[i] = '='
+		}
+		if nowColumn >= 0 {
+			bar[nowColumn] = '|'
+		}
+
+		lines = append(lines, fmt.Sprintf("%-*v %s", timelineLabelWidth, label, bar))
+	}
+
+	first, last := start.UTC().Format("2006-01-02"), end.UTC().Format("2006-01-02")
+	padding := width - len(first) - len(last)
+	if padding < 1 {
+		padding = 1
+	}
+	lines = append(lines, fmt.Sprintf("%-*v %v%v%v", timelineLabelWidth, "", first, strings.Repeat(" ", padding), last))
+
+	if nowColumn >= 0 {
+		lines = append(lines, fmt.Sprintf("%-*v %v| now", timelineLabelWidth, "", strings.Repeat(" ", nowColumn)))
+	}
+
+	return lines
+}
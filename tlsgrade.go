@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// tlsVersions offered one at a time when grading, oldest first
+var tlsVersions = []struct {
+	version uint16
+	name    string
+}{
+	{tls.VersionTLS10, "TLS 1.0"},
+	{tls.VersionTLS11, "TLS 1.1"},
+	{tls.VersionTLS12, "TLS 1.2"},
+	{tls.VersionTLS13, "TLS 1.3"},
+}
+
+// tlsGrade is a lightweight evaluation of a host's TLS configuration, not a full scan of its ciphers
+type tlsGrade struct {
+	// Grade A with only TLS 1.2 and later and a complete chain, B when TLS 1.0 or 1.1 is still
+	// offered, C without TLS 1.2 or later and F when the chain is incomplete
+	Grade     string   `json:"grade"`
+	Protocols []string `json:"protocols"`
+	// ChainComplete when the served chain verifies to a trusted root without fetching intermediates
+	ChainComplete bool     `json:"chain_complete"`
+	Issues        []string `json:"issues,omitempty"`
+}
+
+// gradeTLS of the host at addr serving name, its chain from the handshake already made in state,
+// offering each version in a handshake of its own within timeout
+func gradeTLS(ctx context.Context, name, addr string, timeout time.Duration, state tls.ConnectionState) *tlsGrade {
+	g := &tlsGrade{}
+
+	modern, legacy := false, false
+	for _, v := range tlsVersions {
+		if !offersVersion(ctx, name, addr, timeout, v.version) {
+			continue
+		}
+		g.Protocols = append(g.Protocols, v.name)
+		if v.version >= tls.VersionTLS12 {
+			modern = true
+		} else {
+			legacy = true
+			g.Issues = append(g.Issues, "offers legacy "+v.name)
+		}
+	}
+
+	g.Issues = append(g.Issues, chainIssues(state.PeerCertificates, time.Now())...)
+	g.ChainComplete = len(state.PeerCertificates) > 0 && chainVerifies(state.PeerCertificates, time.Now())
+
+	switch {
+	case !g.ChainComplete:
+		g.Grade = "F"
+	case !modern:
+		g.Grade = "C"
+	case legacy:
+		g.Grade = "B"
+	default:
+		g.Grade = "A"
+	}
+
+	return g
+}
+
+// offersVersion when a handshake with only version offered succeeds
+func offersVersion(ctx context.Context, name, addr string, timeout time.Duration, version uint16) bool {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dialer := tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: timeout},
+		Config: &tls.Config{
+			ServerName:         name,
+			MinVersion:         version,
+			MaxVersion:         version,
+			InsecureSkipVerify: true,
+		},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+
+	return true
+}
+
+// chainVerifies when certs, a served chain leaf first, verify to a system root at now
+func chainVerifies(certs []*x509.Certificate, now time.Time) bool {
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+
+	return err == nil
+}
+
+// chainIssues of a served chain leaf first, missing intermediates, certificates out of order and
+// expired ones
+func chainIssues(certs []*x509.Certificate, now time.Time) []string {
+	if len(certs) == 0 {
+		return []string{"no certificate served"}
+	}
+
+	var issues []string
+	for i, cert := range certs {
+		if now.After(cert.NotAfter) {
+			issues = append(issues, fmt.Sprintf("expired certificate %v in chain", cert.Subject.CommonName))
+		}
+		if i+1 < len(certs) && !bytes.Equal(cert.RawIssuer, certs[i+1].RawSubject) {
+			issues = append(issues, fmt.Sprintf("certificate %v is not followed by its issuer", cert.Subject.CommonName))
+		}
+	}
+
+	// the last certificate served should be issued by a root, a missing intermediate leaves it
+	// issued by a certificate clients must fetch or already have
+	last := certs[len(certs)-1]
+	if bytes.Equal(last.RawIssuer, last.RawSubject) {
+		return issues
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		return issues
+	}
+	_, err = last.Verify(x509.VerifyOptions{Roots: roots, CurrentTime: now, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+	var unknown x509.UnknownAuthorityError
+	if errors.As(err, &unknown) {
+		issues = append(issues, fmt.Sprintf("missing intermediate issuer of %v (%v)", last.Subject.CommonName, last.Issuer.CommonName))
+	}
+
+	return issues
+}
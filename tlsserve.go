@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+var (
+	errACMEWithCert       = errors.New("-acme-domains can't be combined with -tls-cert")
+	errTLSKey             = errors.New("-tls-cert and -tls-key must be given together")
+	errRedirectWithoutTLS = errors.New("-redirect-addr requires -tls-cert or -acme-domains")
+)
+
+// serveTLSFlags configure HTTPS for serve from certificate files or ACME
+type serveTLSFlags struct {
+	cert         *string
+	key          *string
+	clientCA     *string
+	acmeDomains  *string
+	acmeCache    *string
+	acmeEmail    *string
+	redirectAddr *string
+}
+
+func addServeTLSFlags(fs *flag.FlagSet) serveTLSFlags {
+	return serveTLSFlags{
+		cert:         fs.String("tls-cert", "", "serve HTTPS with this PEM certificate"),
+		key:          fs.String("tls-key", "", "private key of -tls-cert"),
+		clientCA:     fs.String("client-ca", "", "with HTTPS, require client certificates issued by a CA in this PEM file (mTLS)"),
+		acmeDomains:  fs.String("acme-domains", "", "serve HTTPS with certificates fetched by ACME (ex: Let's Encrypt) for these comma separated domain names"),
+		acmeCache:    fs.String("acme-cache", "", "directory to keep ACME accounts and certificates in (default the user cache directory)"),
+		acmeEmail:    fs.String("acme-email", "", "contact email for the ACME account"),
+		redirectAddr: fs.String("redirect-addr", "", "with HTTPS, also listen on this address (ex: :80) redirecting HTTP to HTTPS and answering ACME HTTP challenges"),
+	}
+}
+
+// enabled when serve should listen with TLS
+func (f serveTLSFlags) enabled() bool {
+	return *f.cert != "" || *f.acmeDomains != ""
+}
+
+// config of the TLS listener, nil without ACME or a client CA as the certificate files are loaded
+// by ListenAndServeTLS, and the ACME manager if certificates are fetched by ACME
+func (f serveTLSFlags) config() (*tls.Config, *autocert.Manager, error) {
+	switch {
+	case *f.cert != "" && *f.acmeDomains != "":
+		return nil, nil, errACMEWithCert
+	case (*f.cert == "") != (*f.key == ""):
+		return nil, nil, errTLSKey
+	case !f.enabled() && *f.clientCA != "":
+		return nil, nil, errClientCAWithTLS
+	case !f.enabled() && *f.redirectAddr != "":
+		return nil, nil, errRedirectWithoutTLS
+	}
+
+	var (
+		cfg     *tls.Config
+		manager *autocert.Manager
+	)
+	if *f.acmeDomains != "" {
+		cache := *f.acmeCache
+		if cache == "" {
+			dir, err := os.UserCacheDir()
+			if err != nil {
+				return nil, nil, err
+			}
+			cache = filepath.Join(dir, "findcert", "acme")
+		}
+
+		var domains []string
+		for _, d := range strings.Split(*f.acmeDomains, ",") {
+			if d = strings.TrimSpace(d); d != "" {
+				domains = append(domains, d)
+			}
+		}
+
+		manager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(domains...),
+			Cache:      autocert.DirCache(cache),
+			Email:      *f.acmeEmail,
+		}
+		cfg = manager.TLSConfig()
+	}
+
+	if *f.clientCA != "" {
+		clientCfg, err := clientCATLSConfig(*f.clientCA)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cfg == nil {
+			cfg = clientCfg
+		} else {
+			cfg.ClientCAs, cfg.ClientAuth, cfg.MinVersion = clientCfg.ClientCAs, clientCfg.ClientAuth, clientCfg.MinVersion
+		}
+	}
+
+	return cfg, manager, nil
+}
+
+// redirectHandler redirects requests to the same host and path over HTTPS on the port of httpsAddr
+type redirectHandler struct {
+	httpsAddr string
+}
+
+func (h redirectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if _, port, err := net.SplitHostPort(h.httpsAddr); err == nil && port != "443" && port != "" {
+		host = net.JoinHostPort(host, port)
+	}
+
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+}
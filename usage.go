@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+var (
+	errQueryBudget = errors.New("query budget exhausted")
+	errRowBudget   = errors.New("row budget exhausted")
+)
+
+// crtshUsage counts what this process has consumed from crt.sh, set by the -max-queries and -max-rows flags
+var crtshUsage = &queryUsage{}
+
+// queryUsage of crt.sh against optional budgets, a budget is unlimited when not positive
+type queryUsage struct {
+	maxQueries int64
+	maxRows    int64
+
+	queries atomic.Int64
+	rows    atomic.Int64
+	bytes   atomic.Int64
+	// coalesced queries shared the results of an identical query already running instead of being sent
+	coalesced atomic.Int64
+}
+
+// query counts a query about to be sent, erroring instead when it would exceed the budget
+func (u *queryUsage) query() error {
+	if n := u.queries.Add(1); u.maxQueries > 0 && n > u.maxQueries {
+		u.queries.Add(-1)
+		return fmt.Errorf("%w (-max-queries %v)", errQueryBudget, u.maxQueries)
+	}
+
+	return nil
+}
+
+// row counts a row received of size bytes, erroring when it exceeds the budget
+func (u *queryUsage) row(size int) error {
+	u.bytes.Add(int64(size))
+	if n := u.rows.Add(1); u.maxRows > 0 && n > u.maxRows {
+		return fmt.Errorf("%w (-max-rows %v)", errRowBudget, u.maxRows)
+	}
+
+	return nil
+}
+
+// budgeted is whether either budget is set
+func (u *queryUsage) budgeted() bool {
+	return u.maxQueries > 0 || u.maxRows > 0
+}
+
+// report what was consumed
+func (u *queryUsage) report() {
+	log.Printf("Queries: (%v) Coalesced: (%v) Rows: (%v) Bytes: (%v)\n", u.queries.Load(), u.coalesced.Load(), u.rows.Load(), u.bytes.Load())
+}
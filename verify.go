@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	errExpectedVerifyArguments = errors.New("expected 1 argument: PEM certificate file")
+	errNoPEMCertificate        = errors.New("no PEM encoded CERTIFICATE block found")
+)
+
+func runVerify(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	output := addOutputFileFlag(fs)
+	parseFlags(fs, args)
+
+	if fs.NArg() != 1 {
+		return errExpectedVerifyArguments
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("could not read certificate (%w)", err)
+	}
+
+	var block *pem.Block
+	for {
+		block, data = pem.Decode(data)
+		if block == nil {
+			return errNoPEMCertificate
+		}
+		if block.Type == "CERTIFICATE" {
+			break
+		}
+	}
+
+	sum := sha256.Sum256(block.Bytes)
+	id, err := getCertificateID(ctx, sum[:])
+	if err != nil {
+		return fmt.Errorf("could not verify (%v) (%w)", fs.Arg(0), err)
+	}
+
+	return writeOutput(*output, func(out io.Writer) error {
+		fmt.Fprintf(out, "logged as https://crt.sh/?id=%v\n", id)
+		return nil
+	})
+}
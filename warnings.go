@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	expiringSoon        = 30 * 24 * time.Hour
+	maxValidityDuration = 398 * 24 * time.Hour
+	minRSAKeyBits       = 2048
+	// defaultMaxLoggingSkew between NotBefore and a certificate's first CT entry before it is flagged,
+	// CAs commonly backdate NotBefore by an hour or so
+	defaultMaxLoggingSkew = 24 * time.Hour
+)
+
+// certificateWarnings about cert at now worth drawing attention to
+func certificateWarnings(cert *x509.Certificate, now time.Time) []string {
+	var warnings []string
+
+	switch {
+	case now.After(cert.NotAfter):
+		warnings = append(warnings, "expired")
+	case cert.NotAfter.Sub(now) < expiringSoon:
+		warnings = append(warnings, fmt.Sprintf("expires in %v", cert.NotAfter.Sub(now).Round(time.Hour)))
+	}
+
+	if now.Before(cert.NotBefore) {
+		warnings = append(warnings, "not yet valid")
+	}
+
+	if validity := cert.NotAfter.Sub(cert.NotBefore); validity > maxValidityDuration {
+		warnings = append(warnings, fmt.Sprintf("validity of %v days exceeds 398", int(validity.Hours()/24)))
+	}
+
+	if weakSignature(cert) {
+		warnings = append(warnings, "weak signature algorithm "+cert.SignatureAlgorithm.String())
+	}
+
+	if weakRSAKey(cert) {
+		warnings = append(warnings, fmt.Sprintf("weak RSA key of %v bits", publicKeyBits(cert)))
+	}
+
+	for _, name := range certificateNames(cert) {
+		warnings = append(warnings, idnWarnings(name)...)
+	}
+
+	warnings = append(warnings, internalWarnings(cert)...)
+
+	return warnings
+}
+
+// resultWarnings are the certificateWarnings of r and whether it was logged unusually long before or
+// after its NotBefore
+func resultWarnings(r result, now time.Time, maxSkew time.Duration) []string {
+	warnings := certificateWarnings(r.cert(), now)
+	if w := loggingSkewWarning(r, maxSkew); w != "" {
+		warnings = append(warnings, w)
+	}
+
+	return warnings
+}
+
+// loggingSkewWarning when r was first logged to CT more than maxSkew from its NotBefore, a NotBefore
+// long before logging suggests backdating, "" when it wasn't or isn't known
+func loggingSkewWarning(r result, maxSkew time.Duration) string {
+	if r.firstSeen.IsZero() {
+		return ""
+	}
+
+	switch skew := r.firstSeen.Sub(r.cert().NotBefore); {
+	case skew > maxSkew:
+		return fmt.Sprintf("first logged %v after NotBefore, possibly backdated", skew.Round(time.Minute))
+	case -skew > maxSkew:
+		return fmt.Sprintf("first logged %v before NotBefore", (-skew).Round(time.Minute))
+	}
+
+	return ""
+}
+
+// weakSignature reports whether cert is signed with a broken hash
+func weakSignature(cert *x509.Certificate) bool {
+	switch cert.SignatureAlgorithm {
+	case x509.MD5WithRSA, x509.SHA1WithRSA, x509.ECDSAWithSHA1, x509.DSAWithSHA1:
+		return true
+	}
+
+	return false
+}
+
+// weakRSAKey reports whether cert has an RSA key shorter than minRSAKeyBits
+func weakRSAKey(cert *x509.Certificate) bool {
+	return cert.PublicKeyAlgorithm == x509.RSA && publicKeyBits(cert) < minRSAKeyBits
+}
+
+// publicKeyBits is the size of cert's RSA modulus or ECDSA curve, 0 for other keys
+func publicKeyBits(cert *x509.Certificate) int {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return key.Curve.Params().BitSize
+	}
+
+	return 0
+}
+
+// certificateNames are the DNS names of cert and its CommonName if not among them
+func certificateNames(cert *x509.Certificate) []string {
+	names := cert.DNSNames
+	if cn := cert.Subject.CommonName; cn != "" {
+		for _, name := range names {
+			if strings.EqualFold(name, cn) {
+				return names
+			}
+		}
+		names = append([]string{cn}, names...)
+	}
+
+	return names
+}
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/simplylib/multierror"
+)
+
+var errInitialBehavior = errors.New("unknown initial behavior, expected baseline or alert")
+
+// alertsExisting is whether initial, what to do on first observing a query, is to alert on every
+// certificate already logged rather than silently record them as the baseline
+func alertsExisting(initial string) (bool, error) {
+	switch initial {
+	case "", "baseline":
+		return false, nil
+	case "alert":
+		return true, nil
+	}
+
+	return false, fmt.Errorf("%w (%v)", errInitialBehavior, initial)
+}
+
+func runWatch(ctx context.Context, fs *flag.FlagSet, args []string) (err error) {
+	limit := fs.Int("n", 100, "number of latest entries to check on each poll")
+	interval := fs.Duration("interval", time.Hour, "time between polls of crt.sh")
+	patternOpts := addPatternFlags(fs)
+	purposeOpts := addPurposeFlags(fs)
+	historyPath := fs.String("history", "", "append every certificate observed to this history file or sqlite://, bolt:// or postgres:// URL, see findcert history")
+	splunkOpts := addSplunkFlags(fs)
+	statePath := fs.String("state", "", "keep what has been seen in this file or sqlite://, bolt:// or postgres:// URL, so a restart doesn't take a new baseline, see findcert state")
+	execHook := fs.String("exec", "", "run this command for each new or expiring certificate, placeholders like {} (its name), {event}, {sha256} and {not_after} are filled in and set as $FINDCERT_NAME and so on")
+	allowedCAs := fs.String("allowed-cas", "", "comma separated crt.sh CA IDs or issuer names (ex: Let's Encrypt), renewals from these are info and certificates from others critical")
+	initial := fs.String("initial", "baseline", "on first observing the domains, baseline to silently record the certificates already logged and alert only on new ones, or alert to alert on all of them")
+	events := fs.Bool("events", false, "write new_certificate, expiring, policy_violation and backend_error events as NDJSON in place of the new certificates as text")
+	output := addOutputFileFlag(fs)
+	policyFile := fs.String("policy", "", "with -events, check new certificates against this policy file, see findcert check")
+	ledgerPath := fs.String("ledger", "", "record the events sent in this file, so a restart or a failed poll doesn't send them twice")
+	fs.BoolVar(&replayEvents, "replay", false, "with -ledger, send events again even if the ledger has them")
+	parseFlags(fs, args)
+
+	patterns, err := patternOpts.patterns(fs)
+	if err != nil {
+		return err
+	}
+	if err = crtshAdmission.admit(ctx, patterns); err != nil {
+		return err
+	}
+
+	purpose, err := purposeOpts.filter()
+	if err != nil {
+		return err
+	}
+
+	splunk, err := splunkOpts.sink()
+	if err != nil {
+		return err
+	}
+
+	routes := splunkRoutes(splunk)
+	var hook *hookSink
+	if *execHook != "" {
+		if hook, err = newHookSink(*execHook); err != nil {
+			return err
+		}
+		routes = append(routes, notifyRoute{name: "exec", sink: hook, minSeverity: severityInfo})
+	}
+
+	w := newWatcher(patterns.String(), *limit, routes, func(ctx context.Context) ([]result, error) {
+		results, err := getCertificatesByPatterns(ctx, patterns, *limit)
+		if err != nil {
+			return nil, err
+		}
+		return purpose.apply(results), nil
+	})
+	w.policy = newAlertPolicy(*allowedCAs)
+	if w.baseline, err = alertsExisting(*initial); err != nil {
+		return err
+	}
+	if *ledgerPath != "" {
+		if w.ledger, err = openEventLedger(*ledgerPath, replayEvents); err != nil {
+			return err
+		}
+		defer w.ledger.Close()
+	}
+	out, closeOutput, err := openOutput(*output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := closeOutput(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+	if !*events {
+		w.out = out
+	}
+
+	// the hook runs for expiring certificates found as events are, whether or not they are written
+	if *events || hook != nil {
+		stream := io.Discard
+		if *events {
+			stream = out
+		}
+		w.events = newEventStream(stream)
+		w.events.ledger = w.ledger
+		if hook != nil {
+			w.events.expiring = append(w.events.expiring, hook)
+		}
+	}
+	if *policyFile != "" {
+		if w.checkPolicy, err = readCertificatePolicy(*policyFile); err != nil {
+			return err
+		}
+	}
+
+	if *historyPath != "" {
+		if w.history, err = openHistory(*historyPath); err != nil {
+			return err
+		}
+		defer w.history.Close()
+	}
+
+	if *statePath != "" {
+		state, err := readWatchState(*statePath)
+		if err != nil {
+			return err
+		}
+		if s, ok := state.Watchers[w.query]; ok {
+			w.restore(s)
+		}
+		w.save = func(s watcherState) {
+			err := updateWatchState(*statePath, func(state *watchState) {
+				state.Watchers[w.query] = s
+			})
+			if err != nil {
+				log.Printf("could not save state (%v)\n", err)
+			}
+		}
+		w.suppressions = stateSuppressions(*statePath)
+	}
+
+	w.watch(ctx, *interval)
+
+	return nil
+}
+
+// watcher tracks which certificates of a query have already been seen
+type watcher struct {
+	query  string
+	source string
+	routes []notifyRoute
+	fetch  func(ctx context.Context) ([]result, error)
+	// history, if set, records every certificate observed
+	history *historyStore
+	// profile of the certificates seen, new ones unlike it are flagged as anomalies
+	profile *issuanceProfile
+	// floor is the least severity of a new certificate, a lookalike's is critical however it looks
+	floor severity
+	// policy, if set, grades new certificates by their CA and whether they are renewals
+	policy *alertPolicy
+	// out, if set, is where new certificates are written as the results of watch and lookalikes,
+	// they are logged otherwise as by the daemon
+	out io.Writer
+	// events, if set, is the NDJSON event stream of the watcher
+	events *eventStream
+	// ledger, if set, keeps the events sent so they aren't sent again after a restart or failed poll
+	ledger *eventLedger
+	// checkPolicy, if set, is checked against new certificates for policy_violation events
+	checkPolicy *certificatePolicy
+	// save, if set, is handed the watcher's state after each successful poll
+	save func(watcherState)
+	// suppressions, if set, returns the acknowledged and snoozed fingerprints once a poll
+	suppressions func() map[string]suppression
+
+	seen map[[sha256.Size]byte]struct{}
+	// pending new certificates, oldest first, not yet delivered to every route they are for, they
+	// are only seen once they are so a failed send or flush is retried by the next poll
+	pending []*pendingAlert
+	// baseline is set once existing certificates have been recorded, only later ones are reported, or
+	// from the start to report the existing ones too
+	baseline bool
+}
+
+// pendingAlert is the event of a new certificate on its way to the watcher's routes
+type pendingAlert struct {
+	sum   [sha256.Size]byte
+	event certificateEvent
+	// sent to the routes by name whose sinks took it, they may still be buffering it
+	sent map[string]bool
+	// delivered by the routes by name whose sinks flushed it
+	delivered map[string]bool
+	// held is the batch of each heldSink route's sink the alert is kept in
+	held map[string]uint64
+}
+
+// heldSink is an eventSink that may keep events past a successful Flush, as a digest does until its
+// period has passed. It numbers the batches it keeps them in, held is that of the batch an event just
+// sent is in and deliveries that of the last batch passed on, with every batch before it
+type heldSink interface {
+	held() uint64
+	deliveries() uint64
+}
+
+// newWatcher of the certificates returned by fetch for query, notifying routes of new ones
+func newWatcher(query string, limit int, routes []notifyRoute, fetch func(ctx context.Context) ([]result, error)) *watcher {
+	return &watcher{
+		query:   query,
+		source:  "watch",
+		routes:  routes,
+		fetch:   fetch,
+		profile: newIssuanceProfile(),
+		seen:    make(map[[sha256.Size]byte]struct{}, limit),
+	}
+}
+
+// watch polls every interval until ctx is done
+func (w *watcher) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.poll(ctx); err != nil {
+			// crt.sh is regularly overloaded, keep watching and try again next interval
+			log.Printf("could not poll crt.sh for (%v) (%v)\n", w.query, err)
+			w.events.emit(watchEvent{Type: eventBackendError, Query: w.query, Error: err.Error()})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll crt.sh once reporting certificates not seen before, the first poll only records a baseline
+func (w *watcher) poll(ctx context.Context) error {
+	results, err := w.fetch(ctx)
+	if err != nil {
+		return fmt.Errorf("could not getCertificates of (%v) error (%w)", w.query, err)
+	}
+
+	var suppressions map[string]suppression
+	if w.suppressions != nil && w.baseline {
+		suppressions = w.suppressions()
+	}
+
+	// crt.sh returns newest first, report oldest first
+	for i := len(results) - 1; i >= 0; i-- {
+		sum := results[i].fingerprint()
+		if _, ok := w.seen[sum]; ok || w.isPending(sum) {
+			continue
+		}
+		cert := results[i].cert()
+
+		if !w.baseline {
+			w.seen[sum] = struct{}{}
+			w.profile.observe(results[i])
+			w.recordHistory("baseline", 0, results[i])
+			continue
+		}
+
+		renewal := w.profile.renews(results[i])
+		anomalies, newCA := w.profile.anomalies(results[i])
+		w.profile.observe(results[i])
+
+		now := time.Now()
+		sev := certificateSeverity(cert, now)
+		switch {
+		case newCA && w.policy == nil:
+			sev = severityCritical
+		case len(anomalies) > 0 && sev < severityWarning:
+			sev = severityWarning
+		}
+		if w.policy != nil {
+			// an anomalous certificate isn't an expected renewal even from an allowed CA
+			sev = w.policy.apply(results[i], sev, renewal && len(anomalies) == 0)
+		}
+		if sev < w.floor {
+			sev = w.floor
+		}
+		w.report("New certificate CommonName: (%v) Names: (%v) Issued On: (%v) Severity: (%v)\n", cert.Subject.CommonName, cert.DNSNames, cert.NotBefore, sev)
+		if len(anomalies) > 0 {
+			w.report("  Anomalies: (%v)\n", strings.Join(anomalies, "; "))
+		}
+		w.recordHistory("new", sev, results[i])
+
+		if s, ok := suppressionOf(suppressions, results[i], now); ok {
+			w.report("  Suppressed: (%v)\n", s)
+			w.seen[sum] = struct{}{}
+			continue
+		}
+
+		event := certificateEvent{
+			Query:       w.query,
+			Severity:    sev,
+			Warnings:    resultWarnings(results[i], now, defaultMaxLoggingSkew),
+			Anomalies:   anomalies,
+			Certificate: results[i].info(),
+		}
+		w.events.emitOnce(watchEvent{
+			Type:        eventNewCertificate,
+			Query:       w.query,
+			Severity:    sev,
+			Warnings:    event.Warnings,
+			Anomalies:   anomalies,
+			Certificate: &event.Certificate,
+		}, sum)
+		if w.checkPolicy != nil && w.events != nil {
+			if v := w.checkPolicy.evaluate(results[i]); len(v.Violations) > 0 {
+				w.events.emitOnce(watchEvent{Type: eventPolicyViolation, Query: w.query, Violations: v.Violations, Certificate: &event.Certificate}, sum)
+			}
+		}
+
+		w.pending = append(w.pending, &pendingAlert{
+			sum:       sum,
+			event:     event,
+			sent:      make(map[string]bool),
+			delivered: make(map[string]bool),
+			held:      make(map[string]uint64),
+		})
+	}
+
+	w.events.emitExpiring(w.query, results, time.Now())
+
+	if !w.baseline {
+		log.Printf("watching (%v), (%v) existing certificates recorded\n", w.query, len(w.seen))
+		w.baseline = true
+	}
+
+	err = w.deliver(ctx)
+
+	if w.save != nil {
+		w.save(w.state())
+	}
+
+	return err
+}
+
+// isPending is whether the certificate with fingerprint sum is waiting to be delivered
+func (w *watcher) isPending(sum [sha256.Size]byte) bool {
+	for _, p := range w.pending {
+		if p.sum == sum {
+			return true
+		}
+	}
+
+	return false
+}
+
+// deliver the pending alerts oldest first, a route that fails to take one is skipped for the rest
+// of the poll, an alert is recorded in the ledger for a route once its sink flushed it and is seen
+// once every route it is for has
+func (w *watcher) deliver(ctx context.Context) error {
+	var errs error
+	failed := make(map[string]bool)
+	for _, p := range w.pending {
+		for _, route := range w.routes {
+			if p.event.Severity < route.minSeverity || p.sent[route.name] || failed[route.name] {
+				continue
+			}
+			if w.ledger.sent(newLedgerKey(w.query, eventNewCertificate, route.name, p.sum)) {
+				p.sent[route.name], p.delivered[route.name] = true, true
+				continue
+			}
+			if err := route.sink.Send(ctx, w.source, p.event); err != nil {
+				failed[route.name] = true
+				errs = multierror.Append(errs, fmt.Errorf("could not send certificate to (%v) (%w)", route.name, err))
+				continue
+			}
+			p.sent[route.name] = true
+			if h, ok := route.sink.(heldSink); ok {
+				p.held[route.name] = h.held()
+			}
+		}
+	}
+
+	for _, route := range w.routes {
+		// a sink that fails to flush keeps its events for the next Flush, so they aren't sent again
+		if err := route.sink.Flush(ctx); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("could not flush events to (%v) (%w)", route.name, err))
+			continue
+		}
+		w.confirm(route)
+	}
+	w.retire()
+
+	return errs
+}
+
+// report a line about a new certificate to out, or the log without it
+func (w *watcher) report(format string, args ...any) {
+	if w.out == nil {
+		log.Printf(format, args...)
+		return
+	}
+
+	if _, err := fmt.Fprintf(w.out, format, args...); err != nil {
+		log.Printf("could not write output (%v)\n", err)
+	}
+}
+
+// confirm the alerts sent to route as delivered now its sink has flushed, recording them in the
+// ledger, those a heldSink still keeps once it has passed them on
+func (w *watcher) confirm(route notifyRoute) {
+	h, held := route.sink.(heldSink)
+	for _, p := range w.pending {
+		if !p.sent[route.name] || p.delivered[route.name] {
+			continue
+		}
+		if held && h.deliveries() < p.held[route.name] {
+			continue
+		}
+		p.delivered[route.name] = true
+		if err := w.ledger.record(newLedgerKey(w.query, eventNewCertificate, route.name, p.sum)); err != nil {
+			log.Printf("could not record certificate sent to (%v) (%v)\n", route.name, err)
+		}
+	}
+}
+
+// retire the alerts delivered to every route they are for, as seen
+func (w *watcher) retire() {
+	pending := w.pending[:0]
+	for _, p := range w.pending {
+		if w.delivered(p) {
+			w.seen[p.sum] = struct{}{}
+			continue
+		}
+		pending = append(pending, p)
+	}
+	w.pending = pending
+}
+
+// settle the alerts kept by heldSink routes that have since passed them on outside a poll, as a
+// digest sent when stopping has, saving the state if any are now seen
+func (w *watcher) settle() {
+	for _, route := range w.routes {
+		if _, ok := route.sink.(heldSink); ok {
+			w.confirm(route)
+		}
+	}
+
+	pending := len(w.pending)
+	w.retire()
+	if w.save != nil && len(w.pending) < pending {
+		w.save(w.state())
+	}
+}
+
+// setRoutes of the watcher, alerts sent to the previous routes but not delivered by them are sent
+// again to the new ones, whose sinks don't have them
+func (w *watcher) setRoutes(routes []notifyRoute) {
+	for _, p := range w.pending {
+		for name := range p.sent {
+			if !p.delivered[name] {
+				delete(p.sent, name)
+			}
+		}
+	}
+	w.routes = routes
+}
+
+// delivered is whether p was delivered to every route it is for
+func (w *watcher) delivered(p *pendingAlert) bool {
+	for _, route := range w.routes {
+		if p.event.Severity >= route.minSeverity && !p.delivered[route.name] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// recordHistory of an observed certificate, a failure is only logged so alerts still go out
+func (w *watcher) recordHistory(kind string, sev severity, r result) {
+	if w.history == nil {
+		return
+	}
+
+	err := w.history.record(historyEvent{
+		ObservedAt:  time.Now().UTC(),
+		Kind:        kind,
+		Source:      w.source,
+		Query:       w.query,
+		Severity:    sev,
+		Certificate: r.info(),
+	})
+	if err != nil {
+		log.Printf("could not record history of (%v) (%v)\n", w.query, err)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"crypto/x509"
+	"sort"
+	"strings"
+	"time"
+)
+
+// hostCoverage of a concrete hostname by the currently valid certificates naming it
+type hostCoverage struct {
+	name string
+	// own is whether a valid certificate names the host itself
+	own bool
+	// wildcards covering the host in valid certificates (ex: *.example.com)
+	wildcards []string
+}
+
+// kind of coverage: own, own+wildcard, wildcard only or none
+func (h hostCoverage) kind() string {
+	switch {
+	case h.own && len(h.wildcards) > 0:
+		return "own+wildcard"
+	case h.own:
+		return "own"
+	case len(h.wildcards) > 0:
+		return "wildcard only"
+	}
+
+	return "none"
+}
+
+// wildcardCovers is whether the wildcard name (ex: *.example.com) matches host, which it does for
+// exactly one label in place of the *
+func wildcardCovers(wildcard, host string) bool {
+	if !strings.HasPrefix(wildcard, "*.") {
+		return false
+	}
+	label, rest, ok := strings.Cut(host, ".")
+	return ok && label != "" && rest == wildcard[2:]
+}
+
+// wildcardCoverage of every concrete hostname in certs at now, sorted by name. Hosts whose own
+// certificates have all expired show whether a wildcard still covers them
+func wildcardCoverage(certs []*x509.Certificate, now time.Time) []hostCoverage {
+	var (
+		hosts     = make(map[string]*hostCoverage)
+		wildcards = make(map[string]struct{})
+	)
+	for _, cert := range certs {
+		valid := now.After(cert.NotBefore) && now.Before(cert.NotAfter)
+		for _, name := range cert.DNSNames {
+			name = strings.ToLower(name)
+			if strings.HasPrefix(name, "*.") {
+				if valid {
+					wildcards[name] = struct{}{}
+				}
+				continue
+			}
+
+			h, ok := hosts[name]
+			if !ok {
+				h = &hostCoverage{name: name}
+				hosts[name] = h
+			}
+			h.own = h.own || valid
+		}
+	}
+
+	coverage := make([]hostCoverage, 0, len(hosts))
+	for _, h := range hosts {
+		for wildcard := range wildcards {
+			if wildcardCovers(wildcard, h.name) {
+				h.wildcards = append(h.wildcards, wildcard)
+			}
+		}
+		sort.Strings(h.wildcards)
+		coverage = append(coverage, *h)
+	}
+	sort.Slice(coverage, func(i, j int) bool { return coverage[i].name < coverage[j].name })
+
+	return coverage
+}
+
+// impactedHost is a concrete hostname a wildcard certificate covers
+type impactedHost struct {
+	name string
+	// own is whether a valid certificate names the host itself, so it keeps working if the wildcard doesn't
+	own bool
+	// inCT and inInventory are where the host was observed
+	inCT        bool
+	inInventory bool
+}
+
+// wildcardImpact of a valid wildcard certificate, the hostnames that would be affected by rotating it
+type wildcardImpact struct {
+	result    result
+	wildcards []string
+	hosts     []impactedHost
+}
+
+// wildcardImpacts of the valid wildcard certificates in results at now, each with the concrete
+// hostnames it covers seen in results or inventory, those expiring first first
+func wildcardImpacts(results []result, inventory []string, now time.Time) []wildcardImpact {
+	var (
+		hosts = make(map[string]*impactedHost)
+		certs = make(map[string]result)
+		keys  []string
+	)
+	host := func(name string) *impactedHost {
+		h, ok := hosts[name]
+		if !ok {
+			h = &impactedHost{name: name}
+			hosts[name] = h
+		}
+		return h
+	}
+
+	for _, r := range results {
+		cert := r.cert()
+		valid := now.After(cert.NotBefore) && now.Before(cert.NotAfter)
+		for _, name := range cert.DNSNames {
+			if name = strings.ToLower(name); !strings.HasPrefix(name, "*.") {
+				h := host(name)
+				h.inCT = true
+				h.own = h.own || valid
+			}
+		}
+
+		// a precertificate and its certificate are one wildcard certificate, shown as the certificate
+		key := string(cert.RawIssuer) + "/" + cert.SerialNumber.String()
+		if prev, ok := certs[key]; ok {
+			if isPrecertificate(prev.cert()) && !isPrecertificate(cert) {
+				certs[key] = r
+			}
+			continue
+		}
+		if valid {
+			certs[key] = r
+			keys = append(keys, key)
+		}
+	}
+	for _, name := range inventory {
+		if name = strings.ToLower(name); !strings.HasPrefix(name, "*.") {
+			host(name).inInventory = true
+		}
+	}
+
+	var impacts []wildcardImpact
+	for _, key := range keys {
+		impact := wildcardImpact{result: certs[key]}
+		for _, name := range impact.result.cert().DNSNames {
+			if name = strings.ToLower(name); strings.HasPrefix(name, "*.") {
+				impact.wildcards = append(impact.wildcards, name)
+			}
+		}
+		if len(impact.wildcards) == 0 {
+			continue
+		}
+
+		for _, h := range hosts {
+			for _, wildcard := range impact.wildcards {
+				if wildcardCovers(wildcard, h.name) {
+					impact.hosts = append(impact.hosts, *h)
+					break
+				}
+			}
+		}
+		sort.Slice(impact.hosts, func(i, j int) bool { return impact.hosts[i].name < impact.hosts[j].name })
+		impacts = append(impacts, impact)
+	}
+	sort.SliceStable(impacts, func(i, j int) bool {
+		return impacts[i].result.cert().NotAfter.Before(impacts[j].result.cert().NotAfter)
+	})
+
+	return impacts
+}
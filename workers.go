@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// analyzeResults parses and summarizes results on workers at once, sending each once done, in the
+// order of results if ordered. The channel is closed after the last result or once ctx is done
+func analyzeResults(ctx context.Context, results []result, workers int, ordered bool) <-chan result {
+	if workers < 1 {
+		workers = 1
+	}
+
+	out := make(chan result)
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for i := range results {
+			select {
+			case <-ctx.Done():
+				return
+			case jobs <- i:
+			}
+		}
+	}()
+
+	// with ordered, done[i] is closed once results[i] is summarized
+	var done []chan struct{}
+	if ordered {
+		done = make([]chan struct{}, len(results))
+		for i := range done {
+			done[i] = make(chan struct{})
+		}
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// a certificate that can't be parsed is left for the output to report
+				if _, err := results[i].parse(); err == nil {
+					results[i].info()
+				}
+
+				if ordered {
+					close(done[i])
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case out <- results[i]:
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(out)
+		if !ordered {
+			wg.Wait()
+			return
+		}
+
+		for i := range results {
+			select {
+			case <-ctx.Done():
+				return
+			case <-done[i]:
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case out <- results[i]:
+			}
+		}
+	}()
+
+	return out
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var errZoneOrigin = errors.New("relative name in zone file without $ORIGIN")
+
+// zoneHostTypes are the DNS record types of names that could serve TLS
+var zoneHostTypes = map[string]struct{}{"A": {}, "AAAA": {}, "CNAME": {}}
+
+// readZoneFile at name for the owner names of its A, AAAA and CNAME records, once each
+func readZoneFile(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not open zone file (%w)", err)
+	}
+	defer f.Close()
+
+	var (
+		names   []string
+		origin  string
+		owner   string
+		inParen bool
+		seen    = make(map[string]struct{})
+		scanner = bufio.NewScanner(f)
+	)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), ";")
+		fields := strings.Fields(line)
+		// the rest of a record continued over several lines in parentheses
+		if inParen {
+			inParen = !strings.Contains(line, ")")
+			continue
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		inParen = strings.Contains(line, "(") && !strings.Contains(line, ")")
+
+		switch strings.ToUpper(fields[0]) {
+		case "$ORIGIN":
+			if len(fields) > 1 {
+				origin = strings.TrimSuffix(strings.ToLower(fields[1]), ".")
+			}
+			continue
+		case "$TTL", "$INCLUDE", "$GENERATE":
+			continue
+		}
+
+		// a record starting with whitespace has the previous record's owner
+		if line[0] != ' ' && line[0] != '\t' {
+			switch owner = strings.ToLower(fields[0]); {
+			case owner == "@":
+				owner = origin
+			case strings.HasSuffix(owner, "."):
+				owner = strings.TrimSuffix(owner, ".")
+			case origin == "":
+				return nil, fmt.Errorf("%w (%v)", errZoneOrigin, owner)
+			default:
+				owner += "." + origin
+			}
+			fields = fields[1:]
+		}
+
+		// skip the optional TTL and class before the type
+		for len(fields) > 0 && (isTTL(fields[0]) || isDNSClass(fields[0])) {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 || owner == "" {
+			continue
+		}
+		if _, ok := zoneHostTypes[strings.ToUpper(fields[0])]; ok {
+			if _, dup := seen[owner]; !dup {
+				seen[owner] = struct{}{}
+				names = append(names, owner)
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read zone file (%w)", err)
+	}
+
+	return names, nil
+}
+
+// isTTL is whether field is a TTL in seconds or with units (ex: 3600 or 1h)
+func isTTL(field string) bool {
+	if field == "" || field[0] < '0' || field[0] > '9' {
+		return false
+	}
+
+	return strings.Trim(strings.ToLower(field), "0123456789smhdw") == ""
+}
+
+// isDNSClass is whether field is a DNS class
+func isDNSClass(field string) bool {
+	switch strings.ToUpper(field) {
+	case "IN", "CH", "HS", "CS":
+		return true
+	}
+
+	return false
+}